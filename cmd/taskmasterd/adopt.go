@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/42Taskmaster/taskmaster/machine"
+)
+
+// pidfd_open is not exported by the syscall package.
+const sysPidfdOpen = 434
+
+const adoptedProcessPollInterval = time.Second
+
+// unadoptedProcessStoptime is the default stoptime, the configuration of these
+// processes being unknown.
+const unadoptedProcessStoptime = 10 * time.Second
+
+// processAdopt takes over the supervision of a process started by a previous daemon,
+// and returns the event leading to the state it was recorded in.
+func processAdopt(stateMachine *machine.Machine, process Processer, config ProgramConfiguration, record ProcessStateRecord) (machine.EventType, error) {
+	// Never fails on unix systems.
+	osProcess, err := os.FindProcess(record.Pid)
+	if err != nil {
+		return machine.NoopEvent, err
+	}
+
+	// The adopted process is not a child of the daemon: it can not be waited for,
+	// and its exit code will never be known.
+	process.SetCmd(&exec.Cmd{
+		Process: osProcess,
+	})
+
+	deadCh := process.CreateNewDeadChannel()
+
+	process.RestoreChronometer(record.StartedAt)
+
+	message := fmt.Sprintf("adopted with PID %d", record.Pid)
+	log.Printf("Process '%s' of program '%s': %s", record.ID, config.Name, message)
+	process.AppendHistory(ProcessStateStarting, message)
+
+	go func() {
+		defer close(deadCh)
+
+		waitForeignProcess(record.procStat())
+
+		process.StopChronometer()
+
+		stateMachine.Send(ProcessEventStopped)
+	}()
+
+	switch record.State {
+	case ProcessStateStarting:
+		remaining := time.Duration(config.Starttime)*time.Second - time.Since(record.StartedAt)
+
+		go func() {
+			select {
+			case <-time.After(remaining):
+				stateMachine.Send(ProcessEventStarted)
+			case <-deadCh:
+				return
+			}
+		}()
+
+		return machine.NoopEvent, nil
+	case ProcessStateStopping:
+		return ProcessEventStop, nil
+	case ProcessStatePaused:
+		// Sent once the running state is reached, as the lock is held until then.
+		go stateMachine.Send(ProcessEventPause)
+
+		return ProcessEventStarted, nil
+	default:
+		return ProcessEventStarted, nil
+	}
+}
+
+// terminateUnadoptedProcesses stops the processes left running by a previous daemon
+// which no loaded program adopted.
+func terminateUnadoptedProcesses() {
+	records, err := stateStore.TakeUnadopted()
+	if err != nil {
+		log.Printf("Could not persist state file: %v", err)
+	}
+
+	for _, record := range records {
+		log.Printf("Process '%s' of program '%s' with PID %d is not configured anymore, stopping it", record.ID, record.Program, record.Pid)
+
+		terminateForeignProcess(record, syscall.SIGTERM, unadoptedProcessStoptime)
+	}
+}
+
+// terminateForeignProcess stops a process left running by a previous daemon which
+// will not be adopted, and kills it if it is still alive after stoptime.
+func terminateForeignProcess(record ProcessStateRecord, signal syscall.Signal, stoptime time.Duration) {
+	stat := record.procStat()
+	if !isSameProcess(stat) {
+		return
+	}
+
+	syscall.Kill(record.Pid, signal)
+
+	go func() {
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+
+			waitForeignProcess(stat)
+		}()
+
+		select {
+		case <-exited:
+		case <-time.After(stoptime):
+			if isSameProcess(stat) {
+				syscall.Kill(record.Pid, syscall.SIGKILL)
+			}
+		}
+	}()
+}
+
+// waitForeignProcess returns when a process which is not a child of the daemon exits.
+// A pidfd is used when the kernel supports it, otherwise /proc is polled.
+func waitForeignProcess(stat ProcStat) {
+	pidfd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(stat.Pid), 0, 0)
+	if errno == 0 {
+		defer syscall.Close(int(pidfd))
+
+		// The pid could have been reused before the pidfd was opened.
+		if !isSameProcess(stat) {
+			return
+		}
+
+		if err := waitPidfd(int(pidfd)); err == nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(adoptedProcessPollInterval)
+	defer ticker.Stop()
+
+	for isSameProcess(stat) {
+		<-ticker.C
+	}
+}
+
+// waitPidfd blocks until the pidfd becomes readable, which happens when the process exits.
+func waitPidfd(pidfd int) error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(epfd)
+
+	event := syscall.EpollEvent{
+		Events: syscall.EPOLLIN,
+		Fd:     int32(pidfd),
+	}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, pidfd, &event); err != nil {
+		return err
+	}
+
+	events := make([]syscall.EpollEvent, 1)
+	for {
+		count, err := syscall.EpollWait(epfd, events, -1)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+}
@@ -5,18 +5,35 @@ import (
 )
 
 type Args struct {
-	DaemonArg     bool
-	ConfigPathArg string
-	PortArg       int
-	LogPathArg    string
-	BypassRootArg bool
+	DaemonArg       bool
+	ConfigPathArg   string
+	ConfigFormatArg string
+	PortArg         int
+	LogPathArg      string
+	StatePathArg    string
+	SocketPathArg   string
+	BypassRootArg   bool
+	CheckArg        bool
 }
 
 func (args *Args) Parse() {
 	flag.BoolVar(&args.DaemonArg, "d", false, "Launched as daemon")
 	flag.StringVar(&args.ConfigPathArg, "c", configDefaultPath, "Config file location path")
+	flag.StringVar(&args.ConfigFormatArg, "f", "", "Config file format: yaml, json or toml, guessed from its extension by default")
 	flag.IntVar(&args.PortArg, "p", 8080, "HTTP API Port")
 	flag.StringVar(&args.LogPathArg, "l", logDefaultPath, "Log file location path")
+	flag.StringVar(&args.StatePathArg, "s", stateDefaultPath, "State file location path, used to adopt processes left running by a previous daemon")
+	flag.StringVar(&args.SocketPathArg, "u", "", "Unix socket path of the HTTP API, through which unredacted configurations can be requested")
 	flag.BoolVar(&args.BypassRootArg, "r", false, "Be able to launch as root")
+	flag.BoolVar(&args.CheckArg, "t", false, "Check the config file, print the resulting configurations and exit")
 	flag.Parse()
 }
+
+// ConfigFormat is the format given with -f, or the one of the config file extension.
+func (args *Args) ConfigFormat() ConfigFormat {
+	if args.ConfigFormatArg != "" {
+		return ConfigFormat(args.ConfigFormatArg)
+	}
+
+	return configFormatFromPath(args.ConfigPathArg)
+}
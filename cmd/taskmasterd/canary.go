@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const canaryDefaultWindow = 30 * time.Second
+
+var (
+	ErrCanaryInProgress = errors.New("a canary is already in progress")
+	ErrCanaryAborted    = errors.New("canary aborted by a configuration change")
+	ErrCanaryRename     = errors.New("a canary cannot rename a program")
+)
+
+type ErrCanaryProcessNotRunning struct {
+	ProcessID string
+	State     string
+}
+
+func (err *ErrCanaryProcessNotRunning) Error() string {
+	return fmt.Sprintf("canary process %s must be RUNNING, not %s", err.ProcessID, err.State)
+}
+
+// CanaryOptions tell how to try a configuration on a single process before
+// applying it to the whole program.
+type CanaryOptions struct {
+	// ProcessID defaults to the first process of the program.
+	ProcessID string
+	// Window is how long the process must stay running, canaryDefaultWindow by default.
+	Window time.Duration
+}
+
+type ProgramCanaryArgs struct {
+	CanaryOptions
+
+	Configuration ProgramConfiguration
+	// Outcome receives nil once the configuration has been promoted, or the reason
+	// why it has not. It must be buffered.
+	Outcome chan<- error
+}
+
+// ProgramCanary is a configuration generation being tried on a single process.
+type ProgramCanary struct {
+	ProcessID  string
+	Generation int
+	Since      time.Time
+	Window     time.Duration
+
+	cancel  context.CancelFunc
+	outcome chan<- error
+}
+
+type programCanaryResult struct {
+	Generation int
+	Err        error
+}
+
+// StartCanary tries a configuration on a single running process. The configuration
+// is promoted to the whole program if the process stays running for the observation
+// window, and reverted otherwise.
+func (program *Program) StartCanary(args ProgramCanaryArgs) error {
+	if args.ProcessID == "" {
+		args.ProcessID = createProcessName(program.name, 1)
+	}
+	if args.Window == 0 {
+		args.Window = canaryDefaultWindow
+	}
+
+	processes, err := program.GetProcesses()
+	if err != nil {
+		return err
+	}
+
+	process, ok := processes[args.ProcessID]
+	if !ok {
+		return &ErrProcessNotFound{
+			ProcessID: args.ProcessID,
+		}
+	}
+
+	if state := process.GetStateMachineCurrentState(); state != ProcessStateRunning {
+		return &ErrCanaryProcessNotRunning{
+			ProcessID: args.ProcessID,
+			State:     string(state),
+		}
+	}
+
+	errorChan := make(chan error)
+
+	select {
+	case program.ProcessTaskChan <- ProgramTaskCanary{
+		ProgramTaskRootAction: ProgramTaskRootAction{
+			TaskBase: TaskBase{
+				Action: ProgramTaskActionCanary,
+			},
+		},
+		Args:      args,
+		ErrorChan: errorChan,
+	}:
+	case <-program.LocalContext.Done():
+		return ErrChannelClosed
+	}
+
+	return <-errorChan
+}
+
+func (program *Program) GetCanary() (*ProgramCanary, error) {
+	responseChan := make(chan interface{})
+
+	select {
+	case program.ProcessTaskChan <- ProgramTaskRootActionWithResponse{
+		ProgramTaskRootAction: ProgramTaskRootAction{
+			TaskBase: TaskBase{
+				Action: ProgramTaskActionGetCanary,
+			},
+		},
+
+		ResponseChan: responseChan,
+	}:
+	case <-program.LocalContext.Done():
+		return nil, ErrChannelClosed
+	}
+
+	select {
+	case res := <-responseChan:
+		return res.(*ProgramCanary), nil
+	case <-program.LocalContext.Done():
+		return nil, ErrChannelClosed
+	}
+}
+
+func (program *Program) startCanary(task Tasker) error {
+	canaryTask := task.(ProgramTaskCanary)
+
+	err := program.tryCanary(canaryTask.Args)
+	canaryTask.ErrorChan <- err
+
+	return err
+}
+
+func (program *Program) tryCanary(args ProgramCanaryArgs) error {
+	if program.canary != nil {
+		return ErrCanaryInProgress
+	}
+
+	process, err := program.getProcessByID(args.ProcessID)
+	if err != nil {
+		return err
+	}
+
+	generation := program.addGeneration(args.Configuration)
+
+	restartFields := restartTriggeringFields(program.processConfiguration(args.ProcessID), args.Configuration)
+	if len(restartFields) == 0 {
+		log.Printf("Configuration of program '%s' does not require any restart, applying it without canary", program.name)
+
+		if err := program.applyGeneration(generation); err != nil {
+			return err
+		}
+
+		args.Outcome <- nil
+		return nil
+	}
+
+	log.Printf(
+		"Trying configuration of program '%s' on process '%s' for %s, because of changes in: %s",
+		program.name,
+		args.ProcessID,
+		args.Window,
+		strings.Join(restartFields, ", "),
+	)
+
+	ctx, cancel := context.WithCancel(program.LocalContext)
+
+	canary := &ProgramCanary{
+		ProcessID:  args.ProcessID,
+		Generation: generation,
+		Since:      time.Now(),
+		Window:     args.Window,
+
+		cancel:  cancel,
+		outcome: args.Outcome,
+	}
+	program.canary = canary
+	program.processGenerations[args.ProcessID] = generation
+
+	process.Restart()
+
+	go func() {
+		err := observeCanary(ctx, process, canary.Window, canary.Since)
+
+		select {
+		case program.ProcessTaskChan <- ProgramTaskRootActionWithPayload{
+			ProgramTaskRootAction: ProgramTaskRootAction{
+				TaskBase: TaskBase{
+					Action: ProgramTaskActionEndCanary,
+				},
+			},
+			Payload: programCanaryResult{
+				Generation: generation,
+				Err:        err,
+			},
+		}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return nil
+}
+
+func (program *Program) endCanary(task Tasker) error {
+	programTaskWithPayload := task.(ProgramTaskRootActionWithPayload)
+
+	result := programTaskWithPayload.Payload.(programCanaryResult)
+
+	// The canary may have been aborted in-between.
+	canary := program.canary
+	if canary == nil || canary.Generation != result.Generation {
+		return nil
+	}
+
+	program.canary = nil
+	canary.cancel()
+
+	if result.Err != nil {
+		log.Printf("Canary of program '%s' failed on process '%s': %v; reverting its configuration", program.name, canary.ProcessID, result.Err)
+
+		program.revertCanary(canary)
+		canary.outcome <- result.Err
+		return nil
+	}
+
+	log.Printf("Canary of program '%s' succeeded on process '%s', promoting its configuration", program.name, canary.ProcessID)
+
+	err := program.applyGeneration(canary.Generation)
+	canary.outcome <- err
+
+	return err
+}
+
+// revertCanary brings the canary process back to the current configuration.
+// It is not started again if an operator stopped it.
+func (program *Program) revertCanary(canary *ProgramCanary) {
+	program.processGenerations[canary.ProcessID] = program.currentGeneration
+	program.pruneGenerations()
+
+	process, err := program.getProcessByID(canary.ProcessID)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		switch process.GetStateMachineCurrentState() {
+		case ProcessStateStopping, ProcessStateStopped:
+			return
+		}
+
+		process.Restart()
+	}()
+}
+
+// abortCanary leaves the canary process with its configuration generation,
+// which the caller is about to replace.
+func (program *Program) abortCanary() {
+	log.Printf("Canary of program '%s' on process '%s' aborted by a configuration change", program.name, program.canary.ProcessID)
+
+	program.canary.cancel()
+	program.canary.outcome <- ErrCanaryAborted
+	program.canary = nil
+}
+
+func (program *Program) getCanary(task Tasker) error {
+	programTaskWithResponse := task.(ProgramTaskRootActionWithResponse)
+
+	var canary *ProgramCanary
+	if program.canary != nil {
+		canaryCopy := *program.canary
+		canary = &canaryCopy
+	}
+	programTaskWithResponse.ResponseChan <- canary
+
+	return nil
+}
+
+// observeCanary returns nil once the process has stayed running for the whole window,
+// or an error as soon as it backs off, becomes fatal or leaves the running state.
+func observeCanary(ctx context.Context, process Processer, window time.Duration, since time.Time) error {
+	if err := waitBatchRunning(ctx, []Processer{process}, since); err != nil {
+		return err
+	}
+
+	runningSince := since
+	for _, entry := range process.Serialize().History {
+		if entry.State == ProcessStateRunning && entry.Time.After(runningSince) {
+			runningSince = entry.Time
+		}
+	}
+
+	ticker := time.NewTicker(rollingRestartPollInterval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(window)
+
+	for {
+		serializedProcess := process.Serialize()
+
+		for _, entry := range serializedProcess.History {
+			if entry.Time.After(runningSince) && entry.State != ProcessStateRunning {
+				return &ErrProcessUnhealthy{
+					ProcessID: serializedProcess.ID,
+					State:     string(entry.State),
+				}
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
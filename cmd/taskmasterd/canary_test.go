@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func newTestProgram(config ProgramConfiguration) *Program {
+	program := &Program{
+		name:               config.Name,
+		processes:          make(map[string]Processer),
+		generations:        make(map[int]ProgramConfiguration),
+		processGenerations: make(map[string]int),
+	}
+	program.currentGeneration = program.addGeneration(config)
+
+	for index := 1; index <= config.Numprocs; index++ {
+		program.processGenerations[createProcessName(config.Name, index)] = program.currentGeneration
+	}
+
+	return program
+}
+
+func TestCanaryProcessRunsWithItsOwnGeneration(t *testing.T) {
+	program := newTestProgram(ProgramConfiguration{
+		Name:     "web",
+		Cmd:      "/bin/web",
+		Numprocs: 2,
+	})
+
+	canaryGeneration := program.addGeneration(ProgramConfiguration{
+		Name:     "web",
+		Cmd:      "/bin/web --new",
+		Numprocs: 2,
+	})
+	if !program.switchProcessGeneration("web_1", canaryGeneration) {
+		t.Fatalf("Switching to a new command should require a restart")
+	}
+
+	if cmd := program.processConfiguration("web_1").Cmd; cmd != "/bin/web --new" {
+		t.Errorf("Canary process runs with %q; expected %q", cmd, "/bin/web --new")
+	}
+	if cmd := program.processConfiguration("web_2").Cmd; cmd != "/bin/web" {
+		t.Errorf("Other process runs with %q; expected %q", cmd, "/bin/web")
+	}
+	if cmd := program.configuration().Cmd; cmd != "/bin/web" {
+		t.Errorf("Current configuration is %q; expected %q", cmd, "/bin/web")
+	}
+
+	// Promoting the canary generation leaves the canary process running as it is.
+	program.currentGeneration = canaryGeneration
+	if program.switchProcessGeneration("web_1", canaryGeneration) {
+		t.Errorf("Canary process should not be restarted on promotion")
+	}
+	if !program.switchProcessGeneration("web_2", canaryGeneration) {
+		t.Errorf("Other process should be restarted on promotion")
+	}
+
+	program.pruneGenerations()
+	if len(program.generations) != 1 {
+		t.Errorf("Unused generations have been kept: %v", program.generations)
+	}
+}
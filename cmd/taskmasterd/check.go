@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"github.com/42Taskmaster/taskmaster/parser"
+)
+
+// W_OK, for access(2).
+const checkAccessWritable = 0x2
+
+var (
+	ValidationIssueCommandNotFound = errors.New("command not found or not executable")
+	ValidationIssueMissingDir      = errors.New("directory does not exist")
+	ValidationIssueNotWritable     = errors.New("path is not writable")
+)
+
+// checkModeMain validates the configuration file and prints the resulting
+// configurations, then exits. It neither forks, takes the lock nor binds the port,
+// so it can run beside a daemon or in CI.
+func checkModeMain(args Args) {
+	data, err := ioutil.ReadFile(args.ConfigPathArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args.ConfigPathArg, err)
+		os.Exit(1)
+	}
+
+	issues, err := configCheck(bytes.NewReader(data), args.ConfigFormat())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args.ConfigPathArg, err)
+		os.Exit(1)
+	}
+
+	var programsConfigurations ProgramsConfigurations
+	if len(issues) == 0 {
+		_, programsConfigurations, _ = configParse(bytes.NewReader(data), args.ConfigFormat())
+
+		issues = checkProgramsConfigurations(programsConfigurations)
+		configLocateValidationErrors(data, &ErrProgramsYamlValidations{
+			Errors: issues,
+		})
+	}
+
+	if len(issues) > 0 {
+		checkPrintIssues(os.Stderr, args.ConfigPathArg, issues)
+		fmt.Fprintf(os.Stderr, "%s: %d issue(s) found\n", args.ConfigPathArg, len(issues))
+		os.Exit(1)
+	}
+
+	// The output ends up in terminals and CI logs.
+	for programName, config := range programsConfigurations {
+		programsConfigurations[programName] = config.Redacted()
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(programsConfigurations); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: configuration is valid\n", args.ConfigPathArg)
+	os.Exit(0)
+}
+
+func checkPrintIssues(w io.Writer, path string, issues []*ErrProgramsYamlValidation) {
+	for _, issue := range issues {
+		location := path
+		if issue.Line > 0 {
+			location += ":" + strconv.Itoa(issue.Line)
+			if issue.Column > 0 {
+				location += ":" + strconv.Itoa(issue.Column)
+			}
+		}
+
+		if issue.Field == "" {
+			fmt.Fprintf(w, "%s: %v\n", location, issue.Issue)
+		} else {
+			fmt.Fprintf(w, "%s: %s: %v\n", location, issue.Field, issue.Issue)
+		}
+	}
+}
+
+// checkProgramsConfigurations finds the problems that would otherwise only show
+// up when processes are started. Paths are checked with the privileges of the
+// current user, which the daemon may not share with its programs.
+func checkProgramsConfigurations(configs ProgramsConfigurations) []*ErrProgramsYamlValidation {
+	programNames := make([]string, 0, len(configs))
+	for programName := range configs {
+		programNames = append(programNames, programName)
+	}
+	sort.Strings(programNames)
+
+	var errs ErrProgramsYamlValidations
+
+	for _, programName := range programNames {
+		// Expressions are checked as the first process of the program expands them.
+		config := configs[programName].ForProcess(createProcessName(programName, 1))
+		field := "Programs[" + programName + "]."
+
+		if err := checkCommand(config); err != nil {
+			errs.Add(field+"Cmd", err)
+		}
+
+		if config.Workingdir != "" {
+			if info, err := os.Stat(config.Workingdir); err != nil || !info.IsDir() {
+				errs.Add(field+"Workingdir", ValidationIssueMissingDir)
+			}
+		}
+
+		if err := checkOutputPath(config.Stdout); err != nil {
+			errs.Add(field+"Stdout", err)
+		}
+		if err := checkOutputPath(config.Stderr); err != nil {
+			errs.Add(field+"Stderr", err)
+		}
+
+		if _, err := dotenvReadFiles(config.EnvFilePaths()); err != nil {
+			errs.Add(field+"EnvFile", err)
+		}
+
+		// Secrets are read to be checked, but never printed.
+		if _, err := config.ResolveEnvSecrets(); err != nil {
+			var secretErr *ErrEnvSecret
+			if errors.As(err, &secretErr) {
+				errs.Add(field+"Env["+secretErr.Name+"]", secretErr.Err)
+			} else {
+				errs.Add(field+"Env", err)
+			}
+		}
+
+		envNames := make([]string, 0, len(config.Env))
+		for name := range config.Env {
+			envNames = append(envNames, name)
+		}
+		sort.Strings(envNames)
+
+		for _, name := range envNames {
+			if hasNullChar(config.Env[name]) {
+				errs.Add(field+"Env["+name+"]", ValidationIssueNullChar)
+			}
+		}
+	}
+
+	return errs.Errors
+}
+
+// checkCommand parses the command as it is when processes start, and resolves
+// its executable from their environment. Issues of env files are reported on
+// their own field.
+func checkCommand(config ProgramConfiguration) error {
+	env, err := config.CreateCmdEnvironment(nil)
+	if err != nil {
+		return nil
+	}
+
+	parsedCommand, err := parser.ParseCommand(config.ExpandCmd(env))
+	if err != nil {
+		return err
+	}
+	if parsedCommand.Cmd == "" {
+		return ValidationIssueEmptyField
+	}
+
+	if _, err := config.lookPath(parsedCommand.Cmd, env); err != nil {
+		return ValidationIssueCommandNotFound
+	}
+
+	return nil
+}
+
+// checkOutputPath tells whether the standard output or error of processes could
+// be written to path, without creating it.
+func checkOutputPath(path string) error {
+	switch path {
+	case "", string(StdTypeNone):
+		return nil
+	case string(StdTypeAuto):
+		path = os.TempDir()
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		path = filepath.Dir(path)
+
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			return ValidationIssueMissingDir
+		}
+	}
+
+	if err := syscall.Access(path, checkAccessWritable); err != nil {
+		return ValidationIssueNotWritable
+	}
+
+	return nil
+}
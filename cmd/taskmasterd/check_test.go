@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckProgramsConfigurations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskmasterd-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := ProgramsConfigurations{
+		"valid": {
+			Cmd:        "./$SCRIPT --flag",
+			Workingdir: dir,
+			Stdout:     filepath.Join(dir, "valid.stdout"),
+			Stderr:     string(StdTypeNone),
+			Env: map[string]string{
+				"KEY":    "value",
+				"SCRIPT": "script.sh",
+			},
+		},
+		"isolated": {
+			Cmd:    "sh -c true",
+			Stdout: string(StdTypeNone),
+			Stderr: string(StdTypeNone),
+		},
+		"invalid": {
+			Cmd:        "taskmasterd-missing-command",
+			Workingdir: filepath.Join(dir, "missing"),
+			Stdout:     filepath.Join(dir, "missing", "invalid.stdout"),
+			Stderr:     string(StdTypeAuto),
+			Env: map[string]string{
+				"KEY": "a\x00b",
+			},
+		},
+		"unparsable": {
+			Cmd:    "sh -c 'unterminated",
+			Stdout: string(StdTypeNone),
+			Stderr: string(StdTypeNone),
+		},
+	}
+
+	expected := []ErrProgramsYamlValidation{
+		{Field: "Programs[invalid].Cmd", Issue: ValidationIssueCommandNotFound},
+		{Field: "Programs[invalid].Workingdir", Issue: ValidationIssueMissingDir},
+		{Field: "Programs[invalid].Stdout", Issue: ValidationIssueMissingDir},
+		{Field: "Programs[invalid].Env[KEY]", Issue: ValidationIssueNullChar},
+		{Field: "Programs[isolated].Cmd", Issue: ValidationIssueCommandNotFound},
+		{Field: "Programs[unparsable].Cmd"},
+	}
+
+	issues := checkProgramsConfigurations(configs)
+	if len(issues) != len(expected) {
+		t.Fatalf("Found issues %v; expected %v", issues, expected)
+	}
+
+	for index, issue := range issues {
+		if issue.Field != expected[index].Field {
+			t.Errorf("Issue %d is for field %s; expected %s", index, issue.Field, expected[index].Field)
+		}
+		if expected[index].Issue != nil && issue.Issue != expected[index].Issue {
+			t.Errorf("Issue %d is %v; expected %v", index, issue.Issue, expected[index].Issue)
+		}
+	}
+}
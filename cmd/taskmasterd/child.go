@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/42Taskmaster/taskmaster/parser"
+)
+
+// When taskmasterd is launched with childHelperArg as first argument, it does not start
+// the daemon but applies the attributes found in childAttributesEnv to itself, then
+// executes the program. This is the only way to tweak a child between fork and exec
+// without altering the daemon itself, whose umask for instance must never change.
+const (
+	childHelperArg     = "__taskmasterd_child"
+	childAttributesEnv = "TASKMASTERD_CHILD_ATTRIBUTES"
+)
+
+type ChildRlimit struct {
+	Resource int
+	Value    uint64
+}
+
+// ChildAttributes are applied by the child helper before executing the program.
+type ChildAttributes struct {
+	Umask       *int                `json:",omitempty"`
+	Rlimits     []ChildRlimit       `json:",omitempty"`
+	Nice        *int                `json:",omitempty"`
+	OomScoreAdj *int                `json:",omitempty"`
+	Credential  *syscall.Credential `json:",omitempty"`
+}
+
+func (attributes *ChildAttributes) needsHelper() bool {
+	return attributes.Umask != nil ||
+		len(attributes.Rlimits) > 0 ||
+		attributes.Nice != nil ||
+		attributes.OomScoreAdj != nil
+}
+
+func (config *ProgramConfiguration) createChildAttributes() ChildAttributes {
+	attributes := ChildAttributes{
+		Rlimits:     config.Rlimits.toChildRlimits(),
+		Nice:        config.Nice,
+		OomScoreAdj: config.Oomscoreadj,
+	}
+
+	if len(config.Umask) > 0 {
+		// Umask has already been validated as an octal string.
+		umask, _ := strconv.ParseInt(config.Umask, 8, 64)
+		umaskAsInt := int(umask)
+		attributes.Umask = &umaskAsInt
+	}
+
+	if config.runAs != nil {
+		credential := config.runAs.Credential
+		attributes.Credential = &credential
+	}
+
+	return attributes
+}
+
+// CreateCmd creates the command that will launch the program with its environment,
+// going through the child helper when attributes must be applied before exec.
+// The command is not bound to any context: the process must outlive the daemon
+// if it exits without stopping it.
+func (config *ProgramConfiguration) CreateCmd(parsedCommand parser.ParsedCommand, env []string) (*exec.Cmd, error) {
+	attributes := config.createChildAttributes()
+
+	path, err := config.lookPath(parsedCommand.Cmd, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if !attributes.needsHelper() {
+		cmd := exec.Command(path, parsedCommand.Args...)
+		cmd.Args[0] = parsedCommand.Cmd
+		cmd.Env = env
+		cmd.SysProcAttr = config.CreateCmdSysProcAttr()
+		return cmd, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	// Credentials are dropped by the helper, once everything requiring privileges is done.
+	attributesJSON, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	helperArgs := append([]string{childHelperArg, path, parsedCommand.Cmd}, parsedCommand.Args...)
+
+	cmd := exec.Command(self, helperArgs...)
+	cmd.Env = append(env, childAttributesEnv+"="+string(attributesJSON))
+	cmd.SysProcAttr = config.CreateCmdSysProcAttr()
+	cmd.SysProcAttr.Credential = nil
+
+	return cmd, nil
+}
+
+// lookPath resolves the executable the way exec.LookPath does, but from the
+// working directory of the program and with the PATH of its environment, as
+// processes are started there. The path returned is relative to the working
+// directory when the executable is.
+func (config *ProgramConfiguration) lookPath(file string, env []string) (string, error) {
+	isExecutable := func(path string) bool {
+		if !filepath.IsAbs(path) && config.Workingdir != "" {
+			path = filepath.Join(config.Workingdir, path)
+		}
+
+		info, err := os.Stat(path)
+		return err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0
+	}
+
+	if strings.Contains(file, "/") {
+		if !isExecutable(file) {
+			return "", &exec.Error{
+				Name: file,
+				Err:  os.ErrNotExist,
+			}
+		}
+		return file, nil
+	}
+
+	for _, dir := range filepath.SplitList(envLookup(env, "PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+
+		path := filepath.Join(dir, file)
+		if isExecutable(path) {
+			// Without a slash, the path would be looked up again by exec.Command.
+			if !strings.Contains(path, "/") {
+				path = "./" + path
+			}
+			return path, nil
+		}
+	}
+
+	return "", &exec.Error{
+		Name: file,
+		Err:  exec.ErrNotFound,
+	}
+}
+
+func childHelperIsRequested() bool {
+	return len(os.Args) > 1 && os.Args[1] == childHelperArg
+}
+
+// childHelperMain never returns: it either replaces itself with the program or exits.
+func childHelperMain() {
+	// Some attributes, like the nice value, are bound to the calling thread,
+	// which must be the one calling exec.
+	runtime.LockOSThread()
+
+	if len(os.Args) < 4 {
+		childHelperFail(errors.New("missing command to execute"))
+	}
+
+	path := os.Args[2]
+	argv := os.Args[3:]
+
+	var attributes ChildAttributes
+	env := make([]string, 0, len(os.Environ()))
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, childAttributesEnv+"=") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(variable, childAttributesEnv+"=")), &attributes); err != nil {
+				childHelperFail(err)
+			}
+			continue
+		}
+		env = append(env, variable)
+	}
+
+	if err := attributes.apply(); err != nil {
+		childHelperFail(err)
+	}
+
+	childHelperFail(syscall.Exec(path, argv, env))
+}
+
+func childHelperFail(err error) {
+	fmt.Fprintf(os.Stderr, "taskmasterd: could not execute program: %v\n", err)
+	os.Exit(127)
+}
+
+func (attributes *ChildAttributes) apply() error {
+	if attributes.Umask != nil {
+		syscall.Umask(*attributes.Umask)
+	}
+
+	for _, rlimit := range attributes.Rlimits {
+		limit := syscall.Rlimit{
+			Cur: rlimit.Value,
+			Max: rlimit.Value,
+		}
+		if err := syscall.Setrlimit(rlimit.Resource, &limit); err != nil {
+			return fmt.Errorf("setrlimit %d: %w", rlimit.Resource, err)
+		}
+	}
+
+	if attributes.Nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *attributes.Nice); err != nil {
+			return fmt.Errorf("setpriority: %w", err)
+		}
+	}
+
+	if attributes.OomScoreAdj != nil {
+		value := []byte(strconv.Itoa(*attributes.OomScoreAdj))
+		if err := ioutil.WriteFile("/proc/self/oom_score_adj", value, 0644); err != nil {
+			return fmt.Errorf("oom_score_adj: %w", err)
+		}
+	}
+
+	if credential := attributes.Credential; credential != nil {
+		if !credential.NoSetGroups {
+			groups := make([]int, 0, len(credential.Groups))
+			for _, group := range credential.Groups {
+				groups = append(groups, int(group))
+			}
+			if err := syscall.Setgroups(groups); err != nil {
+				return fmt.Errorf("setgroups: %w", err)
+			}
+		}
+		// Since Go 1.16, these apply to every thread of the helper.
+		if err := syscall.Setgid(int(credential.Gid)); err != nil {
+			return fmt.Errorf("setgid: %w", err)
+		}
+		if err := syscall.Setuid(int(credential.Uid)); err != nil {
+			return fmt.Errorf("setuid: %w", err)
+		}
+	}
+
+	return nil
+}
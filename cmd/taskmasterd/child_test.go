@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/42Taskmaster/taskmaster/parser"
+)
+
+// TestMain lets the test binary act as the child helper, which programs needing
+// attributes are started through, and as a new daemon taking over on upgrade.
+func TestMain(m *testing.M) {
+	if childHelperIsRequested() {
+		childHelperMain()
+	}
+	if upgradeIsRequested() {
+		upgradeTestDaemonMain()
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestChildHelperAppliesUmask(t *testing.T) {
+	daemonUmask := syscall.Umask(022)
+	syscall.Umask(daemonUmask)
+
+	config := ProgramConfiguration{
+		Umask:      "027",
+		InheritEnv: true,
+	}
+
+	parsedCommand, err := parser.ParseCommand("/bin/sh -c umask")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := config.CreateCmdEnvironment(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := config.CreateCmd(parsedCommand, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmd.Args) < 2 || cmd.Args[1] != childHelperArg {
+		t.Fatalf("Program is not started through the helper: %v", cmd.Args)
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if umask := strings.TrimSpace(string(output)); umask != "0027" {
+		t.Errorf("Program runs with umask %s; expected 0027", umask)
+	}
+
+	if umask := syscall.Umask(daemonUmask); umask != daemonUmask {
+		t.Errorf("Umask of the daemon changed from %o to %o", daemonUmask, umask)
+	}
+}
+
+func TestLookPathResolvesFromWorkingdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskmasterd-child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"run.sh", "bin/tool"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := ProgramConfiguration{
+		Workingdir: dir,
+	}
+	env := []string{"PATH=/nonexistent", "PATH=bin:/bin"}
+
+	tests := []struct {
+		File     string
+		Expected string
+	}{
+		{"./run.sh", "./run.sh"},
+		{"tool", "bin/tool"},
+		{"sh", "/bin/sh"},
+	}
+	for _, test := range tests {
+		path, err := config.lookPath(test.File, env)
+		if err != nil {
+			t.Errorf("%s: %v", test.File, err)
+		} else if path != test.Expected {
+			t.Errorf("%s resolved to %q; expected %q", test.File, path, test.Expected)
+		}
+	}
+
+	for _, file := range []string{"./missing.sh", "run.sh"} {
+		if _, err := config.lookPath(file, env); err == nil {
+			t.Errorf("%s was resolved", file)
+		}
+	}
+}
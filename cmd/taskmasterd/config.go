@@ -1,9 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 const configDefaultPath = "./taskmaster.yaml"
@@ -34,13 +45,230 @@ func configGetFileReader(path string) (io.ReadCloser, error) {
 	return os.Open(path)
 }
 
-func configParse(r io.Reader) (ProgramsYaml, ProgramsConfigurations, error) {
-	parsedPrograms, err := yamlParse(r)
+func configParse(r io.Reader, format ConfigFormat) (ProgramsYaml, ProgramsConfigurations, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ProgramsYaml{}, nil, err
+	}
+
+	parsedPrograms, err := configDecode(bytes.NewReader(data), format)
 	if err != nil {
 		return ProgramsYaml{}, nil, err
 	}
 
 	programsConfigurations, err := parsedPrograms.Validate()
 
+	// JSON documents are YAML documents too, TOML ones are not.
+	var validationErrs *ErrProgramsYamlValidations
+	if errors.As(err, &validationErrs) {
+		if format == ConfigFormatTOML {
+			configLocateTOMLValidationErrors(data, validationErrs)
+		} else {
+			configLocateValidationErrors(data, validationErrs)
+		}
+	}
+
 	return parsedPrograms, programsConfigurations, err
 }
+
+var configYamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// configCheck returns every issue of the configuration read from r, from syntax
+// errors to invalid values, rather than stopping at the first one.
+func configCheck(r io.Reader, format ConfigFormat) ([]*ErrProgramsYamlValidation, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = configParse(bytes.NewReader(data), format)
+	if err == nil {
+		return nil, nil
+	}
+
+	var validationErrs *ErrProgramsYamlValidations
+	if errors.As(err, &validationErrs) {
+		return validationErrs.Errors, nil
+	}
+
+	var formatErr *ErrConfigFormatUnknown
+	if errors.As(err, &formatErr) {
+		return nil, err
+	}
+
+	if issue := configDecodingIssue(data, err); issue != nil {
+		return []*ErrProgramsYamlValidation{issue}, nil
+	}
+
+	// Decoding type errors are all reported together, each prefixed by its line.
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	issues := make([]*ErrProgramsYamlValidation, 0, len(messages))
+	for _, message := range messages {
+		issue := &ErrProgramsYamlValidation{
+			Issue: errors.New(message),
+		}
+
+		if match := configYamlErrorLine.FindStringSubmatch(message); match != nil {
+			issue.Line, _ = strconv.Atoi(match[1])
+			issue.Issue = errors.New(match[2])
+		}
+
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
+
+// configDecodingIssue locates the errors of the JSON and TOML decoders, which
+// report a byte offset or a line rather than a message prefixed by the line.
+func configDecodingIssue(data []byte, err error) *ErrProgramsYamlValidation {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		tomlErr   toml.ParseError
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return configOffsetIssue(data, syntaxErr.Offset, err)
+	case errors.As(err, &typeErr):
+		issue := configOffsetIssue(data, typeErr.Offset, err)
+		issue.Field = typeErr.Field
+		return issue
+	case errors.As(err, &tomlErr):
+		issue := &ErrProgramsYamlValidation{
+			Issue: err,
+			Line:  tomlErr.Position.Line,
+		}
+		if tomlErr.Message != "" {
+			issue.Issue = errors.New(tomlErr.Message)
+		}
+		return issue
+	default:
+		return nil
+	}
+}
+
+func configOffsetIssue(data []byte, offset int64, err error) *ErrProgramsYamlValidation {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	return &ErrProgramsYamlValidation{
+		Issue:  err,
+		Line:   bytes.Count(before, []byte("\n")) + 1,
+		Column: len(before) - bytes.LastIndexByte(before, '\n'),
+	}
+}
+
+// configLocateValidationErrors gives each validation error the position of its field
+// in the configuration source, or of the closest enclosing one when it is missing.
+func configLocateValidationErrors(data []byte, errs *ErrProgramsYamlValidations) {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &document); err != nil || len(document.Content) == 0 {
+		return
+	}
+
+	for _, err := range errs.Errors {
+		node := configLocateField(document.Content[0], err.Field)
+		err.Line = node.Line
+		err.Column = node.Column
+	}
+}
+
+// configLocateField follows a field path such as Programs[web].Stopsequence[0].Signal
+// through the YAML nodes.
+func configLocateField(root *yamlv3.Node, field string) *yamlv3.Node {
+	located := root
+	node := root
+
+	for _, segment := range configFieldSegments(field) {
+		if node.Kind == yamlv3.AliasNode {
+			node = node.Alias
+		}
+
+		var next *yamlv3.Node
+
+		switch node.Kind {
+		case yamlv3.MappingNode:
+			segment = configMappingKey(node, segment)
+
+			if index := mappingKeyIndex(node, segment); index >= 0 {
+				located = node.Content[index]
+				next = node.Content[index+1]
+			} else if value := mergedMappingValue(node, segment); value != nil {
+				located = value
+				next = value
+			}
+		case yamlv3.SequenceNode:
+			if index, err := strconv.Atoi(segment); err == nil && index >= 0 && index < len(node.Content) {
+				located = node.Content[index]
+				next = node.Content[index]
+			}
+		}
+
+		if next == nil {
+			return located
+		}
+		node = next
+	}
+
+	// Scalars are pointed at directly, other values through their key.
+	if node.Kind == yamlv3.ScalarNode {
+		return node
+	}
+	return located
+}
+
+// configMappingKey finds the key a field name designates in a mapping, field
+// names holding no underscore.
+func configMappingKey(mapping *yamlv3.Node, segment string) string {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		key := mapping.Content[index].Value
+
+		if key != segment && strings.Replace(key, "_", "", -1) == segment {
+			return key
+		}
+	}
+
+	return segment
+}
+
+// configFieldSegments splits a field path into YAML keys and sequence indexes.
+// Field names are matched against YAML keys in lowercase, while bracketed names
+// are kept as they are.
+func configFieldSegments(field string) []string {
+	var segments []string
+
+	for len(field) > 0 {
+		switch field[0] {
+		case '.':
+			field = field[1:]
+		case '[':
+			end := strings.LastIndex(field, "]")
+			if next := strings.Index(field, "]."); next >= 0 {
+				end = next
+			}
+			if end < 0 {
+				return append(segments, field[1:])
+			}
+			segments = append(segments, field[1:end])
+			field = field[end+1:]
+		default:
+			end := strings.IndexAny(field, ".[")
+			if end < 0 {
+				end = len(field)
+			}
+			segments = append(segments, strings.ToLower(field[:end]))
+			field = field[end:]
+		}
+	}
+
+	return segments
+}
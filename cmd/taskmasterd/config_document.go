@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	configDocumentDefaultIndent = 2
+	configDocumentMergeKey      = "<<"
+)
+
+var ErrConfigDocumentNotMapping = errors.New("configuration document is not a mapping")
+
+// ConfigDocument is the node tree of a configuration file. Programs are edited in place,
+// so that comments, anchors and ordering survive changes made through the API.
+type ConfigDocument struct {
+	root yamlv3.Node
+
+	source []byte
+}
+
+func NewConfigDocument() *ConfigDocument {
+	return &ConfigDocument{
+		root: yamlv3.Node{
+			Kind: yamlv3.DocumentNode,
+			Content: []*yamlv3.Node{
+				{
+					Kind: yamlv3.MappingNode,
+					Tag:  "!!map",
+				},
+			},
+		},
+	}
+}
+
+func ParseConfigDocument(data []byte) (*ConfigDocument, error) {
+	document := &ConfigDocument{
+		source: data,
+	}
+	if err := yamlv3.Unmarshal(data, &document.root); err != nil {
+		return nil, err
+	}
+
+	// An empty file has no document at all.
+	if document.root.Kind == 0 {
+		document.root = NewConfigDocument().root
+		return document, nil
+	}
+
+	if len(document.root.Content) != 1 || document.root.Content[0].Kind != yamlv3.MappingNode {
+		return nil, ErrConfigDocumentNotMapping
+	}
+
+	return document, nil
+}
+
+func (document *ConfigDocument) Bytes() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	encoder := yamlv3.NewEncoder(&buffer)
+	encoder.SetIndent(document.indent())
+
+	inlineDanglingAliases(&document.root, make(map[*yamlv3.Node]bool))
+	untagMergeKeys(&document.root)
+
+	if err := encoder.Encode(&document.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return restoreSourceFormatting(document.source, buffer.Bytes()), nil
+}
+
+// indent guesses the indentation of the document from the one of its programs.
+func (document *ConfigDocument) indent() int {
+	programs := document.root.Content[0]
+
+	index := mappingKeyIndex(programs, "programs")
+	if index < 0 {
+		return configDocumentDefaultIndent
+	}
+
+	key, value := programs.Content[index], programs.Content[index+1]
+	if value.Kind != yamlv3.MappingNode || len(value.Content) == 0 || value.Content[0].Line == key.Line {
+		return configDocumentDefaultIndent
+	}
+
+	if indent := value.Content[0].Column - key.Column; indent > 0 {
+		return indent
+	}
+
+	return configDocumentDefaultIndent
+}
+
+// programsNode returns the mapping of programs, creating it if needed.
+func (document *ConfigDocument) programsNode() *yamlv3.Node {
+	root := document.root.Content[0]
+
+	index := mappingKeyIndex(root, "programs")
+	if index < 0 {
+		root.Content = append(root.Content, newScalarNode("programs"), &yamlv3.Node{
+			Kind: yamlv3.MappingNode,
+			Tag:  "!!map",
+		})
+		return root.Content[len(root.Content)-1]
+	}
+
+	programs := root.Content[index+1]
+	if programs.Kind != yamlv3.MappingNode {
+		programs = &yamlv3.Node{
+			Kind:        yamlv3.MappingNode,
+			Tag:         "!!map",
+			LineComment: programs.LineComment,
+		}
+		root.Content[index+1] = programs
+	}
+
+	return programs
+}
+
+// SetPrograms makes the programs of the document match the ones given. Programs which
+// did not change are left untouched, and changed ones are edited key by key.
+func (document *ConfigDocument) SetPrograms(programs map[string]ProgramYaml) error {
+	programsNode := document.programsNode()
+
+	for index := 0; index < len(programsNode.Content); {
+		key := programsNode.Content[index].Value
+		if _, ok := programs[key]; ok || key == configDocumentMergeKey {
+			index += 2
+			continue
+		}
+
+		programsNode.Content = append(programsNode.Content[:index], programsNode.Content[index+2:]...)
+	}
+
+	names := make([]string, 0, len(programs))
+	for name := range programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := setProgramNode(programsNode, name, programs[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setProgramNode(programsNode *yamlv3.Node, name string, program ProgramYaml) error {
+	var newNode yamlv3.Node
+	if err := newNode.Encode(program); err != nil {
+		return err
+	}
+
+	index := mappingKeyIndex(programsNode, name)
+	if index < 0 {
+		programsNode.Content = append(programsNode.Content, newScalarNode(name), &newNode)
+		return nil
+	}
+
+	oldNode := programsNode.Content[index+1]
+
+	same, err := sameProgramNodes(oldNode, &newNode)
+	if err != nil || same {
+		return err
+	}
+
+	// Editing an anchored node would also change the nodes aliasing it.
+	if oldNode.Kind == yamlv3.MappingNode && len(oldNode.Anchor) == 0 {
+		editMappingNode(oldNode, &newNode)
+
+		// Merge keys may still bring values which are not wanted anymore.
+		if same, err := sameProgramNodes(oldNode, &newNode); err != nil || same {
+			return err
+		}
+	}
+
+	keepComments(&newNode, oldNode)
+	programsNode.Content[index+1] = &newNode
+
+	return nil
+}
+
+// sameProgramNodes tells whether two nodes describe the same program, whatever the
+// way they are written.
+func sameProgramNodes(a, b *yamlv3.Node) (bool, error) {
+	var programA, programB ProgramYaml
+
+	if err := a.Decode(&programA); err != nil {
+		return false, nil
+	}
+	if err := b.Decode(&programB); err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(programA, programB), nil
+}
+
+// editMappingNode makes oldNode hold the keys and values of newNode, keeping the nodes
+// of oldNode whose value did not change.
+func editMappingNode(oldNode, newNode *yamlv3.Node) {
+	for index := 0; index < len(oldNode.Content); {
+		key := oldNode.Content[index].Value
+		if key == configDocumentMergeKey || mappingKeyIndex(newNode, key) >= 0 {
+			index += 2
+			continue
+		}
+
+		oldNode.Content = append(oldNode.Content[:index], oldNode.Content[index+2:]...)
+	}
+
+	for index := 0; index < len(newNode.Content); index += 2 {
+		key, newValue := newNode.Content[index], newNode.Content[index+1]
+
+		oldIndex := mappingKeyIndex(oldNode, key.Value)
+		if oldIndex < 0 {
+			if mergedValue := mergedMappingValue(oldNode, key.Value); mergedValue != nil && equivalentNodes(mergedValue, newValue) {
+				continue
+			}
+
+			oldNode.Content = append(oldNode.Content, key, newValue)
+			continue
+		}
+
+		oldValue := oldNode.Content[oldIndex+1]
+		if equivalentNodes(oldValue, newValue) {
+			continue
+		}
+
+		if oldValue.Kind == yamlv3.MappingNode && newValue.Kind == yamlv3.MappingNode && len(oldValue.Anchor) == 0 {
+			editMappingNode(oldValue, newValue)
+			continue
+		}
+
+		keepComments(newValue, oldValue)
+		oldNode.Content[oldIndex+1] = newValue
+	}
+}
+
+// equivalentNodes compares nodes by their text, so that a value keeps its quoting
+// style as long as it does not change.
+func equivalentNodes(a, b *yamlv3.Node) bool {
+	if a.Kind == yamlv3.AliasNode {
+		a = a.Alias
+	}
+	if b.Kind == yamlv3.AliasNode {
+		b = b.Alias
+	}
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+
+	switch a.Kind {
+	case yamlv3.ScalarNode:
+		return a.Value == b.Value
+	case yamlv3.MappingNode:
+		for index := 0; index < len(a.Content); index += 2 {
+			if a.Content[index].Value == configDocumentMergeKey {
+				return false
+			}
+
+			bIndex := mappingKeyIndex(b, a.Content[index].Value)
+			if bIndex < 0 || !equivalentNodes(a.Content[index+1], b.Content[bIndex+1]) {
+				return false
+			}
+		}
+		return true
+	case yamlv3.SequenceNode:
+		for index := range a.Content {
+			if !equivalentNodes(a.Content[index], b.Content[index]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// mergedMappingValue returns the value a mapping inherits for key through its merge keys.
+func mergedMappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value != configDocumentMergeKey {
+			continue
+		}
+
+		merged := []*yamlv3.Node{mapping.Content[index+1]}
+		if merged[0].Kind == yamlv3.SequenceNode {
+			merged = merged[0].Content
+		}
+
+		for _, mergedMapping := range merged {
+			if mergedMapping.Kind == yamlv3.AliasNode {
+				mergedMapping = mergedMapping.Alias
+			}
+			if mergedMapping.Kind != yamlv3.MappingNode {
+				continue
+			}
+
+			if valueIndex := mappingKeyIndex(mergedMapping, key); valueIndex >= 0 {
+				return mergedMapping.Content[valueIndex+1]
+			}
+			if value := mergedMappingValue(mergedMapping, key); value != nil {
+				return value
+			}
+		}
+	}
+
+	return nil
+}
+
+func keepComments(newNode, oldNode *yamlv3.Node) {
+	if len(newNode.HeadComment) == 0 {
+		newNode.HeadComment = oldNode.HeadComment
+	}
+	if len(newNode.LineComment) == 0 {
+		newNode.LineComment = oldNode.LineComment
+	}
+	if len(newNode.FootComment) == 0 {
+		newNode.FootComment = oldNode.FootComment
+	}
+}
+
+// inlineDanglingAliases replaces aliases to anchors which are not defined before them
+// anymore, since their node has been removed or replaced, by a copy of the node.
+func inlineDanglingAliases(node *yamlv3.Node, anchors map[*yamlv3.Node]bool) {
+	if len(node.Anchor) > 0 {
+		anchors[node] = true
+	}
+
+	for index, child := range node.Content {
+		if child.Kind == yamlv3.AliasNode && !anchors[child.Alias] {
+			inlined := copyNode(child.Alias)
+			inlined.Anchor = ""
+			node.Content[index] = inlined
+			child = inlined
+		}
+
+		inlineDanglingAliases(child, anchors)
+	}
+}
+
+// untagMergeKeys prevents merge keys from being written with an explicit tag.
+func untagMergeKeys(node *yamlv3.Node) {
+	if node.Kind == yamlv3.MappingNode {
+		for index := 0; index < len(node.Content); index += 2 {
+			if key := node.Content[index]; key.Value == configDocumentMergeKey && key.Tag == "!!merge" {
+				key.Tag = ""
+			}
+		}
+	}
+
+	for _, child := range node.Content {
+		untagMergeKeys(child)
+	}
+}
+
+// restoreSourceFormatting puts back what the encoder does not keep from source: blank
+// lines, between the lines they were separating, and the alignment of line comments.
+func restoreSourceFormatting(source, output []byte) []byte {
+	type linesPair struct {
+		previous, next string
+	}
+
+	separated := make(map[linesPair]bool)
+	commented := make(map[string]string)
+
+	previous, blank := "", false
+	for _, line := range strings.Split(string(source), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if len(line) == 0 {
+			blank = true
+			continue
+		}
+		if blank && len(previous) > 0 {
+			separated[linesPair{previous, line}] = true
+		}
+		previous, blank = line, false
+
+		// The encoder separates line comments from values by a single space.
+		for index := 1; index < len(line); index++ {
+			if line[index] == '#' && (line[index-1] == ' ' || line[index-1] == '\t') {
+				value := strings.TrimRight(line[:index], " \t")
+				if len(value) > 0 {
+					commented[value+" "+line[index:]] = line
+				}
+			}
+		}
+	}
+
+	var builder strings.Builder
+	previous = ""
+	for index, line := range strings.Split(string(output), "\n") {
+		if sourceLine, ok := commented[line]; ok {
+			line = sourceLine
+		}
+		if separated[linesPair{previous, line}] {
+			builder.WriteByte('\n')
+		}
+		if index > 0 {
+			builder.WriteByte('\n')
+		}
+		builder.WriteString(line)
+		previous = line
+	}
+
+	return []byte(builder.String())
+}
+
+func copyNode(node *yamlv3.Node) *yamlv3.Node {
+	nodeCopy := *node
+	nodeCopy.Content = make([]*yamlv3.Node, len(node.Content))
+	for index, child := range node.Content {
+		nodeCopy.Content[index] = copyNode(child)
+	}
+
+	return &nodeCopy
+}
+
+func mappingKeyIndex(mapping *yamlv3.Node, key string) int {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value == key {
+			return index
+		}
+	}
+
+	return -1
+}
+
+func newScalarNode(value string) *yamlv3.Node {
+	return &yamlv3.Node{
+		Kind:  yamlv3.ScalarNode,
+		Tag:   "!!str",
+		Value: value,
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfigDocument = `# Services reviewed in git.
+programs:
+    # The web frontend.
+    web: &web
+        cmd: "/bin/sleep 1000"   # long sleep
+        numprocs: 1
+        autostart: yes
+        env:
+            V: 1   # version
+
+    # Worker reusing the web settings.
+    worker:
+        <<: *web
+        numprocs: 2
+
+    # Batch job.
+    batch:
+        cmd: /bin/sleep 300
+        autostart: false
+`
+
+func parseTestConfigPrograms(t *testing.T, data []byte) map[string]ProgramYaml {
+	programs, err := yamlParse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Could not parse configuration: %v\n%s", err, data)
+	}
+
+	return programs.Programs
+}
+
+func rewriteTestConfigDocument(t *testing.T, programs map[string]ProgramYaml) []byte {
+	document, err := ParseConfigDocument([]byte(testConfigDocument))
+	if err != nil {
+		t.Fatalf("Could not parse document: %v", err)
+	}
+	if err := document.SetPrograms(programs); err != nil {
+		t.Fatalf("Could not set programs: %v", err)
+	}
+
+	data, err := document.Bytes()
+	if err != nil {
+		t.Fatalf("Could not encode document: %v", err)
+	}
+
+	if parsed := parseTestConfigPrograms(t, data); !reflect.DeepEqual(parsed, programs) {
+		t.Errorf("Document describes %+v; expected %+v", parsed, programs)
+	}
+
+	return data
+}
+
+func TestConfigDocumentKeepsUnchangedDocument(t *testing.T) {
+	programs := parseTestConfigPrograms(t, []byte(testConfigDocument))
+
+	if data := rewriteTestConfigDocument(t, programs); string(data) != testConfigDocument {
+		t.Errorf("Unchanged document has been rewritten:\n%s", unifiedDiff("expected", "got", testConfigDocument, string(data)))
+	}
+}
+
+func TestConfigDocumentEditsOnlyChangedValues(t *testing.T) {
+	programs := parseTestConfigPrograms(t, []byte(testConfigDocument))
+
+	cmd := "/bin/sleep 301"
+	programs["batch"] = ProgramYaml{
+		Cmd:       &cmd,
+		Autostart: programs["batch"].Autostart,
+	}
+
+	expected := strings.Replace(testConfigDocument, "/bin/sleep 300", cmd, 1)
+	if data := rewriteTestConfigDocument(t, programs); string(data) != expected {
+		t.Errorf("Unexpected document:\n%s", unifiedDiff("expected", "got", expected, string(data)))
+	}
+}
+
+func TestConfigDocumentKeepsMergeKeys(t *testing.T) {
+	programs := parseTestConfigPrograms(t, []byte(testConfigDocument))
+
+	numprocs := 3
+	worker := programs["worker"]
+	worker.Numprocs = &numprocs
+	programs["worker"] = worker
+
+	data := rewriteTestConfigDocument(t, programs)
+	if !strings.Contains(string(data), "<<: *web\n        numprocs: 3\n") {
+		t.Errorf("Worker should still merge web settings:\n%s", data)
+	}
+}
+
+func TestConfigDocumentAddsAndRemovesPrograms(t *testing.T) {
+	programs := parseTestConfigPrograms(t, []byte(testConfigDocument))
+
+	cmd := "/bin/true"
+	delete(programs, "batch")
+	programs["cron"] = ProgramYaml{
+		Cmd: &cmd,
+	}
+
+	data := rewriteTestConfigDocument(t, programs)
+	if strings.Contains(string(data), "batch") {
+		t.Errorf("Removed program is still in the document:\n%s", data)
+	}
+	if !strings.Contains(string(data), "# The web frontend.") || !strings.Contains(string(data), "# long sleep") {
+		t.Errorf("Comments of other programs have been lost:\n%s", data)
+	}
+}
+
+func TestConfigDocumentReplacesAnchoredProgram(t *testing.T) {
+	programs := parseTestConfigPrograms(t, []byte(testConfigDocument))
+
+	// Editing web in place would change worker too, through its merge key.
+	cmd := "/bin/web"
+	web := programs["web"]
+	web.Cmd = &cmd
+	programs["web"] = web
+
+	rewriteTestConfigDocument(t, programs)
+}
+
+func TestConfigDocumentFromScratch(t *testing.T) {
+	cmd := "/bin/true"
+	programs := map[string]ProgramYaml{
+		"cron": {
+			Cmd: &cmd,
+		},
+	}
+
+	document := NewConfigDocument()
+	if err := document.SetPrograms(programs); err != nil {
+		t.Fatalf("Could not set programs: %v", err)
+	}
+
+	data, err := document.Bytes()
+	if err != nil {
+		t.Fatalf("Could not encode document: %v", err)
+	}
+
+	if parsed := parseTestConfigPrograms(t, data); !reflect.DeepEqual(parsed, programs) {
+		t.Errorf("Document describes %+v; expected %+v", parsed, programs)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFormat is the language a configuration file is written in. Every format
+// is decoded into the same ProgramsYaml structure.
+type ConfigFormat string
+
+const (
+	ConfigFormatYaml ConfigFormat = "yaml"
+	ConfigFormatJSON ConfigFormat = "json"
+	ConfigFormatTOML ConfigFormat = "toml"
+)
+
+var ConfigFormatAvailable = [...]ConfigFormat{
+	ConfigFormatYaml,
+	ConfigFormatJSON,
+	ConfigFormatTOML,
+}
+
+func (format ConfigFormat) Valid() bool {
+	for _, availableFormat := range ConfigFormatAvailable {
+		if availableFormat == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ErrConfigFormatUnknown struct {
+	Format string
+}
+
+func (err *ErrConfigFormatUnknown) Error() string {
+	return fmt.Sprintf("unknown configuration format: %s", err.Format)
+}
+
+// configFormatFromPath guesses the format of a configuration file from its
+// extension, yaml being the default.
+func configFormatFromPath(path string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ConfigFormatJSON
+	case ".toml":
+		return ConfigFormatTOML
+	default:
+		return ConfigFormatYaml
+	}
+}
+
+func configDecode(r io.Reader, format ConfigFormat) (ProgramsYaml, error) {
+	switch format {
+	case ConfigFormatYaml:
+		return yamlParse(r)
+	case ConfigFormatJSON:
+		var programsYaml ProgramsYaml
+
+		decoder := json.NewDecoder(r)
+		if err := decoder.Decode(&programsYaml); err != nil {
+			return ProgramsYaml{}, err
+		}
+		return programsYaml, nil
+	case ConfigFormatTOML:
+		var programsYaml ProgramsYaml
+
+		if _, err := toml.NewDecoder(r).Decode(&programsYaml); err != nil {
+			return ProgramsYaml{}, err
+		}
+		return programsYaml, nil
+	default:
+		return ProgramsYaml{}, &ErrConfigFormatUnknown{
+			Format: string(format),
+		}
+	}
+}
+
+func configEncode(programs ProgramsYaml, format ConfigFormat) ([]byte, error) {
+	switch format {
+	case ConfigFormatYaml:
+		return yaml.Marshal(programs)
+	case ConfigFormatJSON:
+		data, err := json.MarshalIndent(configEncodablePrograms(programs), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case ConfigFormatTOML:
+		var buffer bytes.Buffer
+
+		if err := toml.NewEncoder(&buffer).Encode(configEncodablePrograms(programs)); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	default:
+		return nil, &ErrConfigFormatUnknown{
+			Format: string(format),
+		}
+	}
+}
+
+// configEncodablePrograms drops the names of programs, which are only part of
+// them for the API, and writes exitcodes as integers whatever they were decoded from.
+func configEncodablePrograms(programs ProgramsYaml) ProgramsYaml {
+	encodablePrograms := ProgramsYaml{
+		Programs: make(map[string]ProgramYaml, len(programs.Programs)),
+		Secrets:  programs.Secrets,
+
+		SensitiveEnvPatterns: programs.SensitiveEnvPatterns,
+	}
+
+	for name, program := range programs.Programs {
+		program.Name = nil
+
+		if program.Exitcodes != nil {
+			if exitcodes, err := program.NormalizedExitcodes(); err == nil {
+				program.Exitcodes = exitcodes
+			}
+		}
+
+		encodablePrograms.Programs[name] = program
+	}
+
+	return encodablePrograms
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testConfigFormats = map[ConfigFormat]string{
+	ConfigFormatYaml: `programs:
+    web:
+        cmd: /bin/web
+        numprocs: 2
+        exitcodes: [0, 2]
+        stopsequence:
+            - signal: INT
+              wait: 3
+        env:
+            PORT: "8080"
+            DB_PASSWORD: {file: /run/secrets/db}
+            API_KEY: {secret: api}
+    batch:
+        cmd: /bin/batch
+        exitcodes: 1
+        rlimits:
+            nofile: 1024
+secrets:
+    file: /etc/taskmaster/secrets
+    keyfile: /etc/taskmaster/secrets.key
+`,
+	ConfigFormatJSON: `{
+  "programs": {
+    "web": {
+      "cmd": "/bin/web",
+      "numprocs": 2,
+      "exitcodes": [0, 2],
+      "stopsequence": [{"signal": "INT", "wait": 3}],
+      "env": {"PORT": "8080", "DB_PASSWORD": {"file": "/run/secrets/db"}, "API_KEY": {"secret": "api"}}
+    },
+    "batch": {
+      "cmd": "/bin/batch",
+      "exitcodes": 1,
+      "rlimits": {"nofile": 1024}
+    }
+  },
+  "secrets": {"file": "/etc/taskmaster/secrets", "keyfile": "/etc/taskmaster/secrets.key"}
+}
+`,
+	ConfigFormatTOML: `[programs.web]
+cmd = "/bin/web"
+numprocs = 2
+exitcodes = [0, 2]
+stopsequence = [{signal = "INT", wait = 3}]
+
+[programs.web.env]
+PORT = "8080"
+DB_PASSWORD = {file = "/run/secrets/db"}
+API_KEY = {secret = "api"}
+
+[programs.batch]
+cmd = "/bin/batch"
+exitcodes = 1
+
+[programs.batch.rlimits]
+nofile = 1024
+
+[secrets]
+file = "/etc/taskmaster/secrets"
+keyfile = "/etc/taskmaster/secrets.key"
+`,
+}
+
+func TestConfigFormatsDecodeToTheSameConfigurations(t *testing.T) {
+	_, expected, err := configParse(strings.NewReader(testConfigFormats[ConfigFormatYaml]), ConfigFormatYaml)
+	if err != nil {
+		t.Fatalf("Could not parse yaml configuration: %v", err)
+	}
+
+	for format, config := range testConfigFormats {
+		_, configurations, err := configParse(strings.NewReader(config), format)
+		if err != nil {
+			t.Errorf("Could not parse %s configuration: %v", format, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(configurations, expected) {
+			t.Errorf("%s configuration is %+v; expected %+v", format, configurations, expected)
+		}
+	}
+}
+
+func TestConfigFormatsReportTheSameValidationErrors(t *testing.T) {
+	invalidConfigs := map[ConfigFormat]string{
+		ConfigFormatYaml: "programs:\n    web:\n        numprocs: 0\n",
+		ConfigFormatJSON: `{"programs": {"web": {"numprocs": 0}}}`,
+		ConfigFormatTOML: "[programs.web]\nnumprocs = 0\n",
+	}
+
+	for format, config := range invalidConfigs {
+		_, _, err := configParse(strings.NewReader(config), format)
+
+		var validationErrors *ErrProgramsYamlValidations
+		if !errors.As(err, &validationErrors) {
+			t.Errorf("Parsing %s configuration returned %v; expected validation errors", format, err)
+			continue
+		}
+
+		fields := []string{}
+		for _, validationError := range validationErrors.Errors {
+			fields = append(fields, validationError.Field+": "+validationError.Issue.Error())
+		}
+
+		expected := []string{
+			"Programs[web].Cmd: " + ValidationIssueEmptyField.Error(),
+			"Programs[web].Numprocs: " + ValidationIssueValueOutsideBounds.Error(),
+		}
+		if !reflect.DeepEqual(fields, expected) {
+			t.Errorf("%s configuration errors are %v; expected %v", format, fields, expected)
+		}
+	}
+}
+
+func TestConfigFormatsRoundTrip(t *testing.T) {
+	for format, config := range testConfigFormats {
+		programs, expected, err := configParse(strings.NewReader(config), format)
+		if err != nil {
+			t.Fatalf("Could not parse %s configuration: %v", format, err)
+		}
+
+		data, err := configEncode(programs, format)
+		if err != nil {
+			t.Errorf("Could not encode %s configuration: %v", format, err)
+			continue
+		}
+
+		_, configurations, err := configParse(bytes.NewReader(data), format)
+		if err != nil {
+			t.Errorf("Could not parse encoded %s configuration: %v\n%s", format, err, data)
+			continue
+		}
+
+		if !reflect.DeepEqual(configurations, expected) {
+			t.Errorf("Encoded %s configuration is %+v; expected %+v", format, configurations, expected)
+		}
+	}
+}
+
+func TestConfigFormatFromPath(t *testing.T) {
+	paths := map[string]ConfigFormat{
+		"taskmaster.yaml":      ConfigFormatYaml,
+		"taskmaster.yml":       ConfigFormatYaml,
+		"taskmaster":           ConfigFormatYaml,
+		"/etc/taskmaster.json": ConfigFormatJSON,
+		"taskmaster.TOML":      ConfigFormatTOML,
+	}
+
+	for path, expected := range paths {
+		if format := configFormatFromPath(path); format != expected {
+			t.Errorf("Format of %s is %s; expected %s", path, format, expected)
+		}
+	}
+}
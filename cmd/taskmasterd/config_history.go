@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Only the most recent previous versions of the configuration file are kept.
+const configHistoryMaxVersions = 20
+
+// configCurrentVersion designates the configuration file itself, rather than
+// one of its previous versions.
+const configCurrentVersion = 0
+
+type ErrConfigVersionNotFound struct {
+	Version int
+}
+
+func (err *ErrConfigVersionNotFound) Error() string {
+	return fmt.Sprintf("configuration version not found: %d", err.Version)
+}
+
+func configVersionName(version int) string {
+	if version == configCurrentVersion {
+		return "current"
+	}
+
+	return "version " + strconv.Itoa(version)
+}
+
+type ConfigVersion struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+}
+
+// ConfigHistory keeps the previous versions of the configuration file, numbered
+// from 1, in a directory beside it.
+type ConfigHistory struct {
+	configPath string
+	dir        string
+}
+
+func NewConfigHistory(configPath string) *ConfigHistory {
+	return &ConfigHistory{
+		configPath: configPath,
+		dir:        configPath + ".history",
+	}
+}
+
+func (history *ConfigHistory) versionPath(version int) string {
+	return filepath.Join(history.dir, strconv.Itoa(version)+filepath.Ext(history.configPath))
+}
+
+// Versions returns the previous versions of the configuration file, oldest first.
+func (history *ConfigHistory) Versions() ([]ConfigVersion, error) {
+	entries, err := ioutil.ReadDir(history.dir)
+	if os.IsNotExist(err) {
+		return []ConfigVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []ConfigVersion{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(history.configPath))
+
+		version, err := strconv.Atoi(name)
+		if err != nil || version <= 0 || !entry.Mode().IsRegular() {
+			continue
+		}
+
+		versions = append(versions, ConfigVersion{
+			Version: version,
+			Time:    entry.ModTime(),
+			Size:    entry.Size(),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// Read returns the content of a previous version, or of the configuration file
+// for configCurrentVersion.
+func (history *ConfigHistory) Read(version int) ([]byte, error) {
+	path := history.configPath
+	if version != configCurrentVersion {
+		path = history.versionPath(version)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, &ErrConfigVersionNotFound{
+			Version: version,
+		}
+	}
+
+	return data, err
+}
+
+// Save records data as the newest previous version, and forgets the oldest ones.
+// Versions keep the permissions of the configuration file, and only its owner
+// can list them.
+func (history *ConfigHistory) Save(data []byte, perm os.FileMode) (int, error) {
+	versions, err := history.Versions()
+	if err != nil {
+		return 0, err
+	}
+
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1].Version + 1
+	}
+
+	if err := os.MkdirAll(history.dir, 0700); err != nil {
+		return 0, err
+	}
+
+	if err := writeFileAtomic(history.versionPath(version), data, perm); err != nil {
+		return 0, err
+	}
+
+	versions = append(versions, ConfigVersion{
+		Version: version,
+	})
+	for len(versions) > configHistoryMaxVersions {
+		if err := os.Remove(history.versionPath(versions[0].Version)); err != nil && !os.IsNotExist(err) {
+			return version, err
+		}
+		versions = versions[1:]
+	}
+
+	return version, nil
+}
+
+// Write replaces the configuration file with data, saving its previous content
+// in the history if it differs.
+func (history *ConfigHistory) Write(data []byte) error {
+	path := history.configPath
+	if resolvedPath, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolvedPath
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	previous, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if string(previous) == string(data) {
+		return nil
+	}
+
+	if len(previous) > 0 {
+		if _, err := history.Save(previous, perm); err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(path, data, perm)
+}
+
+// writeFileAtomic writes data to a temporary file beside path, then renames it over
+// path, so that path holds either its previous or its new content, even after a crash.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := ioutil.TempFile(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return err
+	}
+
+	// The rename itself is durable only once the directory is synced.
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+
+	return dirFile.Sync()
+}
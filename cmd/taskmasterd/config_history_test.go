@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigHistoryKeepsPreviousVersions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "taskmaster.yaml")
+
+	history := NewConfigHistory(path)
+	for _, content := range []string{"first\n", "second\n", "second\n", "third\n"} {
+		if err := history.Write([]byte(content)); err != nil {
+			t.Fatalf("expected no error to be returned; received %v", err)
+		}
+	}
+
+	versions, err := history.Versions()
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	// Nothing is saved when the file is created, nor when its content does not change.
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+		t.Fatalf("Incorrect versions: %v; expected versions 1 and 2", versions)
+	}
+
+	for version, expected := range map[int]string{
+		1:                    "first\n",
+		2:                    "second\n",
+		configCurrentVersion: "third\n",
+	} {
+		data, err := history.Read(version)
+		if err != nil {
+			t.Fatalf("expected no error to be returned; received %v", err)
+		}
+		if string(data) != expected {
+			t.Errorf("Version %d is %q; expected %q", version, data, expected)
+		}
+	}
+
+	var notFoundError *ErrConfigVersionNotFound
+	if _, err := history.Read(3); !errors.As(err, &notFoundError) {
+		t.Errorf("Incorrect error: %v; expected configuration version not found", err)
+	}
+
+	// Only the configuration file and its history remain, without temporary files.
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Unexpected files left beside the configuration file: %v", entries)
+	}
+}
+
+func TestConfigHistoryForgetsOldestVersions(t *testing.T) {
+	history := NewConfigHistory(filepath.Join(t.TempDir(), "taskmaster.yaml"))
+
+	for index := 0; index < configHistoryMaxVersions+5; index++ {
+		if _, err := history.Save([]byte("content\n"), 0644); err != nil {
+			t.Fatalf("expected no error to be returned; received %v", err)
+		}
+	}
+
+	versions, err := history.Versions()
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if len(versions) != configHistoryMaxVersions {
+		t.Fatalf("%d versions have been kept; expected %d", len(versions), configHistoryMaxVersions)
+	}
+	if first := versions[0].Version; first != 6 {
+		t.Errorf("Oldest version kept is %d; expected %d", first, 6)
+	}
+}
+
+func TestConfigHistoryKeepsPermissionsOfConfigurationFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmaster.yaml")
+
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	history := NewConfigHistory(path)
+	if err := history.Write([]byte("second\n")); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	expectedModes := map[string]os.FileMode{
+		path:                   0600,
+		history.dir:            0700,
+		history.versionPath(1): 0600,
+	}
+	for path, expectedMode := range expectedModes {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("expected no error to be returned; received %v", err)
+		}
+		if mode := info.Mode().Perm(); mode != expectedMode {
+			t.Errorf("%s has mode %o; expected %o", path, mode, expectedMode)
+		}
+	}
+}
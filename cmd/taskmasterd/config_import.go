@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ConfigImportWarning tells what could not be imported from the configuration
+// of another process manager.
+type ConfigImportWarning struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Section string `json:"section,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (warning ConfigImportWarning) String() string {
+	if warning.File == "" {
+		return warning.Message
+	}
+
+	location := warning.File
+	if warning.Line > 0 {
+		location += ":" + strconv.Itoa(warning.Line)
+	}
+	if warning.Section != "" {
+		location += ": [" + warning.Section + "]"
+	}
+	if warning.Key != "" {
+		location += " " + warning.Key
+	}
+
+	return location + ": " + warning.Message
+}
+
+type ConfigImport struct {
+	Programs ProgramsYaml
+	Warnings []ConfigImportWarning
+}
+
+// configImportValidationWarnings reports what taskmasterd would reject in the
+// imported programs, for them to be fixed by hand.
+func configImportValidationWarnings(programs ProgramsYaml) []ConfigImportWarning {
+	var warnings []ConfigImportWarning
+
+	_, err := programs.Validate()
+
+	var validationErrs *ErrProgramsYamlValidations
+	if errors.As(err, &validationErrs) {
+		for _, validationErr := range validationErrs.Errors {
+			warnings = append(warnings, ConfigImportWarning{
+				Message: "imported configuration is invalid: " + validationErr.Error(),
+			})
+		}
+	}
+
+	return warnings
+}
+
+// configSubcommands convert configurations from and to other formats, prepare
+// the files they use, or describe them, without starting the daemon.
+var configSubcommands = map[string]func(flags *flag.FlagSet, args []string){
+	supervisordImportArg: supervisordImportMain,
+	procfileImportArg:    procfileImportMain,
+	systemdExportArg:     systemdExportMain,
+	secretsSealArg:       secretsSealMain,
+	schemaPrintArg:       schemaPrintMain,
+}
+
+func configSubcommandIsRequested() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+
+	_, ok := configSubcommands[os.Args[1]]
+	return ok
+}
+
+// configSubcommandMain runs the requested subcommand, then exits.
+func configSubcommandMain() {
+	name := os.Args[1]
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configSubcommands[name](flags, os.Args[2:])
+
+	os.Exit(0)
+}
+
+// configImportPrint prints the imported configuration, and warnings about what
+// could not be imported.
+func configImportPrint(imported *ConfigImport, format ConfigFormat) {
+	for _, warning := range imported.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+
+	data, err := configEncode(imported.Programs, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(data)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigCheckLocatesIssues(t *testing.T) {
+	const config = `programs:
+    base: &base
+        cmd: /bin/true
+        numprocs: 500
+    web:
+        <<: *base
+        autorestart: sometimes
+        stopsequence:
+            - signal: TERM
+            - wait: 5
+    batch:
+        startretries: 1
+`
+
+	issues, err := configCheck(strings.NewReader(config), ConfigFormatYaml)
+	if err != nil {
+		t.Fatalf("Could not check configuration: %v", err)
+	}
+
+	type location struct {
+		Field        string
+		Line, Column int
+	}
+
+	expected := []location{
+		// Missing fields are located at their program.
+		{"Programs[batch].Cmd", 11, 5},
+		{"Programs[base].Numprocs", 4, 19},
+		// Merged fields are located where they are defined.
+		{"Programs[web].Numprocs", 4, 19},
+		{"Programs[web].Autorestart", 7, 22},
+		{"Programs[web].Stopsequence[1].Signal", 10, 15},
+	}
+
+	located := make(map[location]bool)
+	for _, issue := range issues {
+		located[location{issue.Field, issue.Line, issue.Column}] = true
+	}
+
+	if len(issues) != len(expected) {
+		t.Errorf("Found %d issues; expected %d", len(issues), len(expected))
+	}
+	for _, location := range expected {
+		if !located[location] {
+			t.Errorf("Issue %+v has not been found in %v", location, issues)
+		}
+	}
+}
+
+func TestConfigCheckLocatesTOMLIssues(t *testing.T) {
+	const config = `# Programs
+[programs.web]
+cmd = "/bin/web"
+description = """
+numprocs = 1
+"""
+"numprocs" = 500
+autorestart = "sometimes"
+
+[[programs.web.stopsequence]]
+signal = "TERM"
+
+[[programs.web.stopsequence]]
+wait = 5
+
+[programs.batch]
+startretries = 1
+`
+
+	issues, err := configCheck(strings.NewReader(config), ConfigFormatTOML)
+	if err != nil {
+		t.Fatalf("Could not check configuration: %v", err)
+	}
+
+	type location struct {
+		Field        string
+		Line, Column int
+	}
+
+	expected := []location{
+		// Missing fields are located at their program.
+		{"Programs[batch].Cmd", 16, 1},
+		{"Programs[web].Numprocs", 7, 1},
+		{"Programs[web].Autorestart", 8, 1},
+		{"Programs[web].Stopsequence[1].Signal", 13, 1},
+	}
+
+	located := make(map[location]bool)
+	for _, issue := range issues {
+		located[location{issue.Field, issue.Line, issue.Column}] = true
+	}
+
+	if len(issues) != len(expected) {
+		t.Errorf("Found %d issues; expected %d: %v", len(issues), len(expected), issues)
+	}
+	for _, location := range expected {
+		if !located[location] {
+			t.Errorf("Issue %+v has not been found in %v", location, issues)
+		}
+	}
+}
+
+func TestConfigCheckReportsEveryDecodingError(t *testing.T) {
+	const config = `programs:
+    a:
+        cmd: /bin/true
+        numprocs: abc
+    b:
+        cmd: /bin/true
+        starttime: [1]
+`
+
+	issues, err := configCheck(strings.NewReader(config), ConfigFormatYaml)
+	if err != nil {
+		t.Fatalf("Could not check configuration: %v", err)
+	}
+
+	if len(issues) != 2 || issues[0].Line != 4 || issues[1].Line != 7 {
+		t.Errorf("Unexpected issues: %v", issues)
+	}
+}
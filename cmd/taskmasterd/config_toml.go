@@ -0,0 +1,206 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// configTOMLKey is where a key is defined in a TOML document. The decoder does not
+// expose the positions of keys, so they are found by scanning the document lines.
+type configTOMLKey struct {
+	Line, Column int
+
+	Keys map[string]*configTOMLKey
+	// Items are the tables of an array of tables.
+	Items []*configTOMLKey
+}
+
+func newConfigTOMLKey(line, column int) *configTOMLKey {
+	return &configTOMLKey{
+		Line:   line,
+		Column: column,
+		Keys:   make(map[string]*configTOMLKey),
+	}
+}
+
+// child returns the key defined in the table, or in the last table of an array of
+// tables, creating it at the given position when it is not defined yet.
+func (key *configTOMLKey) child(name string, line, column int) *configTOMLKey {
+	if len(key.Items) > 0 {
+		key = key.Items[len(key.Items)-1]
+	}
+
+	child, ok := key.Keys[name]
+	if !ok {
+		child = newConfigTOMLKey(line, column)
+		key.Keys[name] = child
+	}
+
+	return child
+}
+
+func (key *configTOMLKey) descend(names []string, line, column int) *configTOMLKey {
+	for _, name := range names {
+		key = key.child(name, line, column)
+	}
+
+	return key
+}
+
+// configScanTOMLKeys finds the tables and keys defined by a TOML document. Values
+// are not parsed, except to skip multi-line strings.
+func configScanTOMLKeys(data []byte) *configTOMLKey {
+	root := newConfigTOMLKey(1, 1)
+	current := root
+	multilineDelimiter := ""
+
+	for index, line := range strings.Split(string(data), "\n") {
+		lineNumber := index + 1
+
+		if multilineDelimiter != "" {
+			if strings.Contains(line, multilineDelimiter) {
+				multilineDelimiter = ""
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		column := strings.Index(line, trimmed) + 1
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(trimmed, "[["):
+			end := strings.Index(trimmed, "]]")
+			if end < 0 {
+				continue
+			}
+			names := configSplitTOMLKey(trimmed[2:end])
+			if len(names) == 0 {
+				continue
+			}
+
+			array := root.descend(names, lineNumber, column)
+			current = newConfigTOMLKey(lineNumber, column)
+			array.Items = append(array.Items, current)
+		case trimmed[0] == '[':
+			end := strings.Index(trimmed, "]")
+			if end < 0 {
+				continue
+			}
+			current = root.descend(configSplitTOMLKey(trimmed[1:end]), lineNumber, column)
+		default:
+			equal := configTOMLKeyEnd(trimmed)
+			if equal < 0 {
+				continue
+			}
+			current.descend(configSplitTOMLKey(trimmed[:equal]), lineNumber, column)
+
+			value := trimmed[equal+1:]
+			for _, delimiter := range []string{`"""`, `'''`} {
+				if strings.Count(value, delimiter)%2 == 1 {
+					multilineDelimiter = delimiter
+				}
+			}
+		}
+	}
+
+	return root
+}
+
+// configTOMLKeyEnd returns the index of the equal sign ending the key of a line,
+// outside of quoted keys, or -1 when the line does not define a key.
+func configTOMLKeyEnd(line string) int {
+	quote := byte(0)
+
+	for index := 0; index < len(line); index++ {
+		char := line[index]
+
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '=':
+			return index
+		case char == '{' || char == '[' || char == ',' || char == '#':
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// configSplitTOMLKey splits a dotted key into its unquoted names.
+func configSplitTOMLKey(key string) []string {
+	var (
+		names []string
+		name  strings.Builder
+		quote byte
+	)
+
+	for index := 0; index < len(key); index++ {
+		char := key[index]
+
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			} else {
+				name.WriteByte(char)
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '.':
+			names = append(names, strings.TrimSpace(name.String()))
+			name.Reset()
+		case char != ' ' && char != '\t':
+			name.WriteByte(char)
+		}
+	}
+
+	return append(names, name.String())
+}
+
+// configLocateTOMLField follows a field path such as Programs[web].Stopsequence[0].Signal
+// through the TOML keys, and returns the closest one defined.
+func configLocateTOMLField(root *configTOMLKey, field string) *configTOMLKey {
+	key := root
+
+	for _, segment := range configFieldSegments(field) {
+		var next *configTOMLKey
+
+		if index, err := strconv.Atoi(segment); err == nil && len(key.Items) > 0 {
+			if index >= 0 && index < len(key.Items) {
+				next = key.Items[index]
+			}
+		} else {
+			next = key.Keys[segment]
+			for name, child := range key.Keys {
+				if next == nil && strings.Replace(name, "_", "", -1) == segment {
+					next = child
+				}
+			}
+		}
+
+		if next == nil {
+			return key
+		}
+		key = next
+	}
+
+	return key
+}
+
+func configLocateTOMLValidationErrors(data []byte, errs *ErrProgramsYamlValidations) {
+	root := configScanTOMLKeys(data)
+
+	for _, err := range errs.Errors {
+		key := configLocateTOMLField(root, err.Field)
+		err.Line = key.Line
+		err.Column = key.Column
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around changes.
+const diffContextLines = 3
+
+type diffLine struct {
+	Kind byte // ' ', '-' or '+'
+	Text string
+}
+
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes the shortest edit script turning from into to, from their
+// longest common subsequence. Configuration files are small enough for it.
+func diffLines(from, to []string) []diffLine {
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(from)+len(to))
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			lines = append(lines, diffLine{' ', from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', from[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		lines = append(lines, diffLine{'-', from[i]})
+	}
+	for ; j < len(to); j++ {
+		lines = append(lines, diffLine{'+', to[j]})
+	}
+
+	return lines
+}
+
+// unifiedDiff returns the differences between two texts in unified format,
+// or an empty string when they are identical.
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var builder strings.Builder
+
+	for start := 0; start < len(lines); {
+		// Find the next change, then extend the hunk as long as changes are close enough
+		// for their context to overlap.
+		firstChange := start
+		for firstChange < len(lines) && lines[firstChange].Kind == ' ' {
+			firstChange++
+		}
+		if firstChange == len(lines) {
+			break
+		}
+
+		lastChange := firstChange
+		for index := firstChange; index < len(lines) && index <= lastChange+2*diffContextLines; index++ {
+			if lines[index].Kind != ' ' {
+				lastChange = index
+			}
+		}
+
+		hunkStart := firstChange - diffContextLines
+		if hunkStart < start {
+			hunkStart = start
+		}
+		hunkEnd := lastChange + diffContextLines + 1
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+
+		if builder.Len() == 0 {
+			fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeDiffHunk(&builder, lines, hunkStart, hunkEnd)
+
+		start = hunkEnd
+	}
+
+	return builder.String()
+}
+
+func writeDiffHunk(builder *strings.Builder, lines []diffLine, hunkStart, hunkEnd int) {
+	fromLine, toLine := 1, 1
+	for _, line := range lines[:hunkStart] {
+		if line.Kind != '+' {
+			fromLine++
+		}
+		if line.Kind != '-' {
+			toLine++
+		}
+	}
+
+	fromCount, toCount := 0, 0
+	for _, line := range lines[hunkStart:hunkEnd] {
+		if line.Kind != '+' {
+			fromCount++
+		}
+		if line.Kind != '-' {
+			toCount++
+		}
+	}
+
+	// An empty range is designated by the line preceding it.
+	if fromCount == 0 {
+		fromLine--
+	}
+	if toCount == 0 {
+		toLine--
+	}
+
+	fmt.Fprintf(builder, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+	for _, line := range lines[hunkStart:hunkEnd] {
+		builder.WriteByte(line.Kind)
+		builder.WriteString(line.Text)
+		builder.WriteByte('\n')
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	to := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+
+	expected := `--- version 1
++++ current
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	if diff := unifiedDiff("version 1", "current", from, to); diff != expected {
+		t.Errorf("Incorrect diff:\n%s\nexpected:\n%s", diff, expected)
+	}
+
+	if diff := unifiedDiff("version 1", "current", from, from); diff != "" {
+		t.Errorf("Diff of identical texts should be empty, received:\n%s", diff)
+	}
+}
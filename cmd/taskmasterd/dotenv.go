@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+type ErrDotenvLine struct {
+	Line int
+}
+
+func (err *ErrDotenvLine) Error() string {
+	return fmt.Sprintf("line %d is not a variable assignment", err.Line)
+}
+
+type ErrEnvFile struct {
+	Path string
+	Err  error
+}
+
+func (err *ErrEnvFile) Error() string {
+	return fmt.Sprintf("env_file %s: %v", err.Path, err.Err)
+}
+
+func (err *ErrEnvFile) Unwrap() error {
+	return err.Err
+}
+
+// dotenvParse reads KEY=value lines, which may be exported, and whose values may
+// be quoted. Double-quoted values understand the escapes of dotenv, and unquoted
+// ones end at a comment. Invalid lines are skipped and returned.
+func dotenvParse(data []byte) (map[string]string, []*ErrDotenvLine) {
+	var (
+		env  = make(map[string]string)
+		errs []*ErrDotenvLine
+	)
+
+	for index, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		separator := strings.Index(line, "=")
+		if separator <= 0 || !isValidEnvironementVariableName(strings.TrimSpace(line[:separator])) {
+			errs = append(errs, &ErrDotenvLine{
+				Line: index + 1,
+			})
+			continue
+		}
+
+		name := strings.TrimSpace(line[:separator])
+		value := strings.TrimSpace(line[separator+1:])
+
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+
+		env[name] = value
+	}
+
+	return env, errs
+}
+
+// dotenvReadFiles merges the variables of env files, later files overriding
+// earlier ones. Files must exist and be entirely valid.
+func dotenvReadFiles(paths []string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, &ErrEnvFile{
+				Path: path,
+				Err:  err,
+			}
+		}
+
+		fileEnv, errs := dotenvParse(data)
+		if len(errs) > 0 {
+			return nil, &ErrEnvFile{
+				Path: path,
+				Err:  errs[0],
+			}
+		}
+
+		for name, value := range fileEnv {
+			env[name] = value
+		}
+	}
+
+	return env, nil
+}
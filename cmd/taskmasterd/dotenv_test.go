@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDotenvParse(t *testing.T) {
+	env, errs := dotenvParse([]byte(`# comment
+export A=1
+B = two words # comment
+C="quoted\nvalue # not a comment"
+D='single $quoted'
+not a variable
+1BAD=value
+`))
+
+	expected := map[string]string{
+		"A": "1",
+		"B": "two words",
+		"C": "quoted\nvalue # not a comment",
+		"D": "single $quoted",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Parsed %v; expected %v", env, expected)
+	}
+
+	if len(errs) != 2 || errs[0].Line != 6 || errs[1].Line != 7 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestCreateCmdEnvironmentOverridesEnvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskmasterd-dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".env":       "A=base\nB=base\nC=base\n",
+		".env.local": "B=local\nC=local\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	os.Setenv("TASKMASTERD_TEST_ALLOWED", "allowed")
+	os.Setenv("TASKMASTERD_TEST_LEAKED", "leaked")
+	defer os.Unsetenv("TASKMASTERD_TEST_ALLOWED")
+	defer os.Unsetenv("TASKMASTERD_TEST_LEAKED")
+
+	config := ProgramConfiguration{
+		Workingdir:      dir,
+		EnvFiles:        []string{".env", filepath.Join(dir, ".env.local")},
+		InheritEnv:      false,
+		InheritEnvAllow: []string{"TASKMASTERD_TEST_ALLOW*"},
+		Env: map[string]string{
+			"C": "env",
+		},
+	}
+
+	env, err := config.CreateCmdEnvironment(nil)
+	if err != nil {
+		t.Fatalf("Could not create environment: %v", err)
+	}
+
+	// Later assignments win, as for exec.Cmd.
+	variables := make(map[string]string)
+	for _, variable := range env {
+		for index := range variable {
+			if variable[index] == '=' {
+				variables[variable[:index]] = variable[index+1:]
+				break
+			}
+		}
+	}
+
+	expected := map[string]string{
+		"TASKMASTERD_TEST_ALLOWED": "allowed",
+		"A":                        "base",
+		"B":                        "local",
+		"C":                        "env",
+	}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Errorf("Environment is %v; expected %v", variables, expected)
+	}
+}
+
+func TestCreateCmdEnvironmentFailsOnMissingEnvFile(t *testing.T) {
+	config := ProgramConfiguration{
+		InheritEnv: true,
+		EnvFiles:   []string{"/nonexistent/.env"},
+	}
+
+	_, err := config.CreateCmdEnvironment(nil)
+
+	var envFileErr *ErrEnvFile
+	if !errors.As(err, &envFileErr) || !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Incorrect error: %v; expected the env file not to exist", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Names of the expressions expanded for each process, written as supervisord does:
+// %(process_num)d, or %(process_num)02d to pad numbers.
+const (
+	ExpansionProgramName = "program_name"
+	ExpansionProcessNum  = "process_num"
+	ExpansionProcessID   = "process_id"
+	ExpansionPort        = "port"
+)
+
+// Variables telling processes who they are.
+const (
+	EnvTaskmasterProgram    = "TASKMASTER_PROGRAM"
+	EnvTaskmasterProcessID  = "TASKMASTER_PROCESS_ID"
+	EnvTaskmasterProcessNum = "TASKMASTER_PROCESS_NUM"
+	EnvTaskmasterPort       = "TASKMASTER_PORT"
+)
+
+var expansionPattern = regexp.MustCompile(`%\(([a-zA-Z_]+)\)(-?[0-9]*)([sd])`)
+
+// Expressions are padded to at most expansionMaxWidth characters.
+const expansionMaxWidth = 64
+
+var (
+	ValidationIssueUnknownExpansion = errors.New("unknown expression, expected program_name, process_num, process_id or port")
+	ValidationIssueNoBasePort       = errors.New("port expression requires base_port")
+	ValidationIssueExpansionWidth   = fmt.Errorf("expression width is greater than %d", expansionMaxWidth)
+)
+
+// ProcessExpansions are the values of the expressions for a process.
+type ProcessExpansions map[string]interface{}
+
+// ProcessExpansions gives the values of the expressions for the process of the
+// program with this ID. Processes are numbered from 1, as their IDs are.
+func (config *ProgramConfiguration) ProcessExpansions(processID string) ProcessExpansions {
+	processNum := processNumFromID(processID)
+
+	expansions := ProcessExpansions{
+		ExpansionProgramName: config.Name,
+		ExpansionProcessNum:  processNum,
+		ExpansionProcessID:   processID,
+	}
+	if config.BasePort != 0 {
+		expansions[ExpansionPort] = config.BasePort + processNum
+	}
+
+	return expansions
+}
+
+// Expand replaces the expressions of value. Unknown ones are kept as they are,
+// as validation already reported them.
+func (expansions ProcessExpansions) Expand(value string) string {
+	return expansionPattern.ReplaceAllStringFunc(value, func(expression string) string {
+		match := expansionPattern.FindStringSubmatch(expression)
+
+		expansion, ok := expansions[match[1]]
+		if !ok {
+			return expression
+		}
+
+		width, verb := match[2], match[3]
+		switch expansion := expansion.(type) {
+		case int:
+			if verb == "s" {
+				return fmt.Sprintf("%"+width+"s", strconv.Itoa(expansion))
+			}
+			return fmt.Sprintf("%"+width+"d", expansion)
+		default:
+			return fmt.Sprintf("%"+width+"s", expansion)
+		}
+	})
+}
+
+// Expanded returns the configuration with the expressions of its command, working
+// directory, outputs and env expanded, and with variables telling processes who
+// they are, which override the ones of env.
+func (config ProgramConfiguration) Expanded(expansions ProcessExpansions) ProgramConfiguration {
+	config.Cmd = expansions.Expand(config.Cmd)
+	config.Workingdir = expansions.Expand(config.Workingdir)
+	config.Stdout = expansions.Expand(config.Stdout)
+	config.Stderr = expansions.Expand(config.Stderr)
+
+	env := make(map[string]string, len(config.Env)+4)
+	for name, value := range config.Env {
+		env[name] = expansions.Expand(value)
+	}
+
+	env[EnvTaskmasterProgram] = fmt.Sprint(expansions[ExpansionProgramName])
+	env[EnvTaskmasterProcessID] = fmt.Sprint(expansions[ExpansionProcessID])
+	env[EnvTaskmasterProcessNum] = fmt.Sprint(expansions[ExpansionProcessNum])
+	if port, ok := expansions[ExpansionPort]; ok {
+		env[EnvTaskmasterPort] = fmt.Sprint(port)
+	}
+	config.Env = env
+
+	return config
+}
+
+// ForProcess returns the configuration the process with this ID runs with.
+func (config ProgramConfiguration) ForProcess(processID string) ProgramConfiguration {
+	return config.Expanded(config.ProcessExpansions(processID))
+}
+
+// validateExpansions tells whether every expression of value can be expanded.
+func validateExpansions(value string, hasBasePort bool) error {
+	for _, match := range expansionPattern.FindAllStringSubmatch(value, -1) {
+		if width := strings.TrimPrefix(match[2], "-"); width != "" {
+			if width, err := strconv.Atoi(width); err != nil || width > expansionMaxWidth {
+				return ValidationIssueExpansionWidth
+			}
+		}
+
+		switch match[1] {
+		case ExpansionProgramName, ExpansionProcessNum, ExpansionProcessID:
+		case ExpansionPort:
+			if !hasBasePort {
+				return ValidationIssueNoBasePort
+			}
+		default:
+			return ValidationIssueUnknownExpansion
+		}
+	}
+
+	return nil
+}
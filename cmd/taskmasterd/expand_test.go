@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestForProcessExpandsExpressions(t *testing.T) {
+	program := ProgramYaml{
+		Cmd:        strToPointer("/bin/web --port %(port)d --name %(program_name)s-%(process_num)02d"),
+		Numprocs:   intToPointer(3),
+		BasePort:   intToPointer(8000),
+		Workingdir: strToPointer("/srv/%(process_id)s"),
+		Stdout:     strToPointer("/var/log/web-%(process_num)d.log"),
+		Stderr:     strToPointer(string(StdTypeNone)),
+		Env: EnvYamlFromValues(map[string]string{
+			"LISTEN":             ":%(port)d",
+			EnvTaskmasterProgram: "overridden",
+		}),
+	}
+
+	config, err := program.Validate(ProgramYamlValidateArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Name = "web"
+
+	processConfig := config.ForProcess(createProcessName("web", 2))
+
+	expectedValues := map[string]string{
+		"cmd":        "/bin/web --port 8002 --name web-02",
+		"workingdir": "/srv/web_2",
+		"stdout":     "/var/log/web-2.log",
+		"stderr":     string(StdTypeNone),
+	}
+	values := map[string]string{
+		"cmd":        processConfig.Cmd,
+		"workingdir": processConfig.Workingdir,
+		"stdout":     processConfig.Stdout,
+		"stderr":     processConfig.Stderr,
+	}
+	for field, expected := range expectedValues {
+		if values[field] != expected {
+			t.Errorf("%s is %q; expected %q", field, values[field], expected)
+		}
+	}
+
+	expectedEnv := map[string]string{
+		"LISTEN":                ":8002",
+		EnvTaskmasterProgram:    "web",
+		EnvTaskmasterProcessID:  "web_2",
+		EnvTaskmasterProcessNum: "2",
+		EnvTaskmasterPort:       "8002",
+	}
+	for name, expected := range expectedEnv {
+		if processConfig.Env[name] != expected {
+			t.Errorf("%s is %q; expected %q", name, processConfig.Env[name], expected)
+		}
+	}
+
+	if config.Env["LISTEN"] != ":%(port)d" {
+		t.Error("Expanding modified the configuration of the program")
+	}
+}
+
+func TestForProcessWithoutBasePort(t *testing.T) {
+	config := ProgramConfiguration{
+		Name: "worker",
+		Cmd:  "date +%s",
+	}
+
+	processConfig := config.ForProcess(createProcessName("worker", 1))
+
+	if processConfig.Cmd != "date +%s" {
+		t.Errorf("Command is %q; expected it unchanged", processConfig.Cmd)
+	}
+	if _, ok := processConfig.Env[EnvTaskmasterPort]; ok {
+		t.Errorf("%s is set without base_port", EnvTaskmasterPort)
+	}
+}
+
+func TestExpressionsAreValidated(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd: strToPointer("/bin/web --port %(port)d"),
+				Env: EnvYamlFromValues(map[string]string{
+					"GROUP": "%(group_name)s",
+				}),
+			},
+			"api": {
+				Cmd:      strToPointer("/bin/api"),
+				Numprocs: intToPointer(10),
+				BasePort: intToPointer(PortMax - 5),
+				Stdout:   strToPointer("/tmp/api-%(process_num)999999999d.log"),
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+
+	var errs *ErrProgramsYamlValidations
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	expected := map[string]error{
+		"Programs[api].BasePort":   ValidationIssueValueOutsideBounds,
+		"Programs[api].Stdout":     ValidationIssueExpansionWidth,
+		"Programs[web].Cmd":        ValidationIssueNoBasePort,
+		"Programs[web].Env[GROUP]": ValidationIssueUnknownExpansion,
+	}
+	if len(errs.Errors) != len(expected) {
+		t.Fatalf("Got errors %v; expected %v", errs, expected)
+	}
+	for _, validationErr := range errs.Errors {
+		if expected[validationErr.Field] != validationErr.Issue {
+			t.Errorf("Unexpected error %v", validationErr)
+		}
+	}
+}
+
+func TestExportSystemdTemplateUsesInstance(t *testing.T) {
+	programsYaml := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd:      strToPointer("/bin/web --id %(process_id)s --port %(port)d"),
+				Numprocs: intToPointer(2),
+				BasePort: intToPointer(8000),
+			},
+		},
+	}
+
+	configs, err := programsYaml.Validate()
+	if err != nil {
+		t.Fatalf("Could not validate configuration: %v", err)
+	}
+
+	unit := ExportSystemdUnit("web", configs["web"])
+
+	for _, expectedLine := range []string{
+		"ExecStart=/bin/web --id web_%i --port 8001",
+		"Environment=TASKMASTER_PROCESS_NUM=%i",
+		"Environment=TASKMASTER_PROCESS_ID=web_%i",
+	} {
+		if !strings.Contains(unit.Data, expectedLine+"\n") {
+			t.Errorf("Missing %q in unit:\n%s", expectedLine, unit.Data)
+		}
+	}
+}
@@ -1,41 +1,60 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/42Taskmaster/taskmaster/machine"
-	"gopkg.in/yaml.v2"
 )
 
 type HttpHandleFunc func(http.ResponseWriter, *http.Request)
 type HttpEndpointFunc func(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request)
 
 var httpEndpoints = map[string]HttpEndpointFunc{
-	"/status":                httpEndpointStatus,
-	"/start":                 httpEndpointStart,
-	"/start/all":             httpEndpointStartAll,
-	"/stop":                  httpEndpointStop,
-	"/stop/all":              httpEndpointStopAll,
-	"/restart":               httpEndpointRestart,
-	"/restart/all":           httpEndpointRestartAll,
-	"/configuration":         httpEndpointConfiguration,
-	"/configuration/refresh": httpEndpointRefreshConfiguration,
-	"/programs/create":       httpEndpointCreateProgram,
-	"/programs/edit":         httpEndpointEditProgram,
-	"/programs/delete":       httpEndpointDeleteProgram,
-	"/logs":                  httpEndpointLogs,
-	"/shutdown":              httpEndpointShutdown,
-	"/version":               httpEndpointVersion,
-	"/":                      httpNotFound,
+	"/status":                           httpEndpointStatus,
+	"/start":                            httpEndpointStart,
+	"/start/all":                        httpEndpointStartAll,
+	"/stop":                             httpEndpointStop,
+	"/stop/all":                         httpEndpointStopAll,
+	"/restart":                          httpEndpointRestart,
+	"/restart/all":                      httpEndpointRestartAll,
+	"/pause":                            httpEndpointPause,
+	"/pause/all":                        httpEndpointPauseAll,
+	"/resume":                           httpEndpointResume,
+	"/resume/all":                       httpEndpointResumeAll,
+	"/override/clear":                   httpEndpointClearOverride,
+	"/override/clear/all":               httpEndpointClearOverrideAll,
+	"/configuration":                    httpEndpointConfiguration,
+	"/configuration/refresh":            httpEndpointRefreshConfiguration,
+	"/configuration/plan":               httpEndpointPlanConfiguration,
+	"/configuration/check":              httpEndpointCheckConfiguration,
+	"/configuration/schema":             httpEndpointConfigurationSchema,
+	"/configuration/versions":           httpEndpointConfigurationVersions,
+	"/configuration/import/supervisord": httpEndpointImportSupervisord,
+	"/configuration/import/procfile":    httpEndpointImportProcfile,
+	"/configuration/export/systemd":     httpEndpointExportSystemd,
+	"/configuration/diff":               httpEndpointConfigurationDiff,
+	"/configuration/rollback":           httpEndpointConfigurationRollback,
+	"/programs/create":                  httpEndpointCreateProgram,
+	"/programs/edit":                    httpEndpointEditProgram,
+	"/programs/delete":                  httpEndpointDeleteProgram,
+	"/logs":                             httpEndpointLogs,
+	"/shutdown":                         httpEndpointShutdown,
+	"/upgrade":                          httpEndpointUpgrade,
+	"/version":                          httpEndpointVersion,
+	"/":                                 httpNotFound,
 }
 
 type HttpJSONResponse struct {
@@ -49,6 +68,7 @@ type HttpProgramNameInputJSON struct {
 
 type HttpPrograms struct {
 	Programs []HttpProgram `json:"programs"`
+	Orphans  []HttpOrphan  `json:"orphans"`
 }
 
 type HttpProgram struct {
@@ -56,6 +76,20 @@ type HttpProgram struct {
 	State         ProgramState         `json:"state"`
 	Configuration ProgramConfiguration `json:"configuration"`
 	Processes     []HttpProcess        `json:"processes"`
+	Orphans       []HttpOrphan         `json:"orphans"`
+	Override      *ProgramOverride     `json:"override,omitempty"`
+	Canary        *HttpCanary          `json:"canary,omitempty"`
+}
+
+type HttpCanary struct {
+	ProcessID string    `json:"process_id"`
+	Since     time.Time `json:"since"`
+	Window    int       `json:"window"`
+}
+
+type HttpOrphan struct {
+	Pid       int    `json:"pid"`
+	ProcessID string `json:"processId,omitempty"`
 }
 
 type HttpProcess struct {
@@ -65,16 +99,81 @@ type HttpProcess struct {
 
 	StartedAt time.Time `json:"startedAt"`
 	EndedAt   time.Time `json:"endedAt"`
+
+	History []ProcessHistoryEntry `json:"history"`
 }
 
+// HttpConfigurationEndpointInputJSON holds a whole configuration, in the format
+// of the configuration file of the daemon unless another one is given.
 type HttpConfigurationEndpointInputJSON struct {
 	ConfigurationData string `json:"data"`
+	Format            string `json:"format,omitempty"`
+}
+
+func (input *HttpConfigurationEndpointInputJSON) ConfigFormat(taskmasterd *Taskmasterd) ConfigFormat {
+	if input.Format != "" {
+		return ConfigFormat(input.Format)
+	}
+
+	return taskmasterd.Args.ConfigFormat()
 }
 
 type HttpConfiguration struct {
 	Data string `json:"data"`
 }
 
+// HttpConfigurationIssue is a problem found in a configuration. Its field is empty
+// for syntax errors, and its line is 0 when its position is unknown.
+type HttpConfigurationIssue struct {
+	Field  string `json:"field,omitempty"`
+	Issue  string `json:"issue"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+type HttpConfigurationCheck struct {
+	Valid  bool                     `json:"valid"`
+	Issues []HttpConfigurationIssue `json:"issues"`
+}
+
+// HttpImportSupervisordInputJSON designates a supervisord configuration by the path
+// of its file on the host of the daemon, or gives its content. Only files read from
+// a path can include others.
+type HttpImportSupervisordInputJSON struct {
+	Path   string `json:"path,omitempty"`
+	Data   string `json:"data,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// HttpImportProcfileInputJSON gives a Procfile, the content of its optional
+// environment file, and the number of processes of some of its types.
+type HttpImportProcfileInputJSON struct {
+	Data        string         `json:"data"`
+	Env         string         `json:"env,omitempty"`
+	Concurrency map[string]int `json:"concurrency,omitempty"`
+	Format      string         `json:"format,omitempty"`
+}
+
+type HttpConfigImport struct {
+	Data     string                `json:"data"`
+	Warnings []ConfigImportWarning `json:"warnings"`
+}
+
+type HttpConfigurationVersions struct {
+	Versions []ConfigVersion `json:"versions"`
+}
+
+// HttpConfigurationDiffInputJSON designates versions of the configuration file,
+// 0 being the current one.
+type HttpConfigurationDiffInputJSON struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type HttpConfigurationRollbackInputJSON struct {
+	Version int `json:"version"`
+}
+
 type HttpLogs struct {
 	Data string `json:"data"`
 }
@@ -84,8 +183,16 @@ type HttpCreateProgramInputJSON struct {
 }
 
 type HttpEditProgramInputJSON struct {
-	Id            string      `json:"id"`
-	Configuration ProgramYaml `json:"configuration"`
+	Id            string                     `json:"id"`
+	Configuration ProgramYaml                `json:"configuration"`
+	Canary        *HttpEditProgramCanaryJSON `json:"canary,omitempty"`
+}
+
+// HttpEditProgramCanaryJSON asks for the configuration to be tried on a single process
+// for Window seconds before being applied to the whole program.
+type HttpEditProgramCanaryJSON struct {
+	ProcessID string `json:"process_id,omitempty"`
+	Window    int    `json:"window,omitempty"`
 }
 
 type HttpDeleteProgramInputJSON struct {
@@ -102,6 +209,11 @@ func RespondJSON(resp HttpJSONResponse, w http.ResponseWriter) {
 func httpEndpointStatus(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
+		redact, ok := httpRedaction(w, r)
+		if !ok {
+			return
+		}
+
 		programs, err := taskmasterd.GetSortedPrograms()
 		if err != nil {
 			RespondJSON(HttpJSONResponse{
@@ -131,16 +243,29 @@ func httpEndpointStatus(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http
 			}
 
 			httpProgram := HttpProgram{
-				Id:            program.configuration.Name,
+				Id:            program.name,
 				Configuration: config,
 				State:         GetProgramState(processes),
 			}
+			if redact {
+				httpProgram.Configuration = config.Redacted()
+			}
+			if override, ok := stateStore.Override(program.name); ok {
+				httpProgram.Override = &override
+			}
+			if canary, err := program.GetCanary(); err == nil && canary != nil {
+				httpProgram.Canary = &HttpCanary{
+					ProcessID: canary.ProcessID,
+					Since:     canary.Since,
+					Window:    int(canary.Window / time.Second),
+				}
+			}
 
 			for _, process := range processes {
 				processState := process.GetStateMachineCurrentState()
 
 				pid := 0
-				if processState == ProcessStateRunning {
+				if processState == ProcessStateRunning || processState == ProcessStatePaused {
 					if cmd := process.GetCmd(); cmd != nil && cmd.Process != nil {
 						pid = cmd.Process.Pid
 					}
@@ -155,14 +280,20 @@ func httpEndpointStatus(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http
 
 					StartedAt: serializedProcess.StartedAt,
 					EndedAt:   serializedProcess.EndedAt,
+
+					History: serializedProcess.History,
 				}
 
 				httpProgram.Processes = append(httpProgram.Processes, httpProcess)
 			}
 
+			httpProgram.Orphans = httpOrphans(childrenRegistry.Orphans(config.Name))
+
 			httpPrograms.Programs = append(httpPrograms.Programs, httpProgram)
 		}
 
+		httpPrograms.Orphans = httpOrphans(childrenRegistry.Orphans(""))
+
 		RespondJSON(HttpJSONResponse{
 			Result: httpPrograms,
 		}, w)
@@ -171,7 +302,19 @@ func httpEndpointStatus(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http
 	}
 }
 
-func httpEndpointStart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+func httpOrphans(orphans []Orphan) []HttpOrphan {
+	httpOrphans := make([]HttpOrphan, 0, len(orphans))
+	for _, orphan := range orphans {
+		httpOrphans = append(httpOrphans, HttpOrphan{
+			Pid:       orphan.Pid,
+			ProcessID: orphan.ProcessID,
+		})
+	}
+	return httpOrphans
+}
+
+// httpProgramAction applies action to the program designated by the body of a POST request.
+func httpProgramAction(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request, action func(programID string, program Program)) {
 	switch r.Method {
 	case "POST":
 		var input HttpProgramNameInputJSON
@@ -192,7 +335,7 @@ func httpEndpointStart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.
 			return
 		}
 
-		program.Start()
+		action(input.ProgramID, program)
 
 		RespondJSON(HttpJSONResponse{}, w)
 	default:
@@ -200,7 +343,8 @@ func httpEndpointStart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.
 	}
 }
 
-func httpEndpointStartAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+// httpProgramsAction applies action to every program on a POST request.
+func httpProgramsAction(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request, action func(programID string, program Program)) {
 	switch r.Method {
 	case "POST":
 		programs, err := taskmasterd.GetPrograms()
@@ -211,8 +355,8 @@ func httpEndpointStartAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *ht
 			return
 		}
 
-		for _, program := range programs {
-			program.Start()
+		for programID, program := range programs {
+			action(programID, program)
 		}
 
 		RespondJSON(HttpJSONResponse{}, w)
@@ -221,7 +365,76 @@ func httpEndpointStartAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *ht
 	}
 }
 
+func httpStartProgram(taskmasterd *Taskmasterd) func(programID string, program Program) {
+	return func(programID string, program Program) {
+		taskmasterd.SetOverride(programID, ProgramIntentStarted)
+		program.Start()
+	}
+}
+
+func httpStopProgram(taskmasterd *Taskmasterd) func(programID string, program Program) {
+	return func(programID string, program Program) {
+		taskmasterd.SetOverride(programID, ProgramIntentStopped)
+		program.Stop()
+	}
+}
+
+func httpRestartProgram(taskmasterd *Taskmasterd) func(programID string, program Program) {
+	return func(programID string, program Program) {
+		taskmasterd.SetOverride(programID, ProgramIntentStarted)
+		program.Restart()
+	}
+}
+
+func httpPauseProgram(programID string, program Program) {
+	program.Pause()
+}
+
+func httpResumeProgram(programID string, program Program) {
+	program.Resume()
+}
+
+func httpEndpointStart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramAction(taskmasterd, w, r, httpStartProgram(taskmasterd))
+}
+
+func httpEndpointStartAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramsAction(taskmasterd, w, r, httpStartProgram(taskmasterd))
+}
+
 func httpEndpointStop(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramAction(taskmasterd, w, r, httpStopProgram(taskmasterd))
+}
+
+func httpEndpointStopAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramsAction(taskmasterd, w, r, httpStopProgram(taskmasterd))
+}
+
+func httpEndpointRestart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramAction(taskmasterd, w, r, httpRestartProgram(taskmasterd))
+}
+
+func httpEndpointRestartAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramsAction(taskmasterd, w, r, httpRestartProgram(taskmasterd))
+}
+
+func httpEndpointPause(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramAction(taskmasterd, w, r, httpPauseProgram)
+}
+
+func httpEndpointPauseAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramsAction(taskmasterd, w, r, httpPauseProgram)
+}
+
+func httpEndpointResume(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramAction(taskmasterd, w, r, httpResumeProgram)
+}
+
+func httpEndpointResumeAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	httpProgramsAction(taskmasterd, w, r, httpResumeProgram)
+}
+
+func httpEndpointClearOverride(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
 		var input HttpProgramNameInputJSON
@@ -234,15 +447,21 @@ func httpEndpointStop(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.R
 			return
 		}
 
-		program, err := taskmasterd.GetProgramById(input.ProgramID)
-		if err != nil {
+		// Overrides of programs which are not loaded anymore can be cleared too.
+		_, hasOverride := stateStore.Override(input.ProgramID)
+		if _, err := taskmasterd.GetProgramById(input.ProgramID); err != nil && !hasOverride {
 			RespondJSON(HttpJSONResponse{
 				Error: err.Error(),
 			}, w)
 			return
 		}
 
-		program.Stop()
+		if err := stateStore.ClearOverride(input.ProgramID); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
 
 		RespondJSON(HttpJSONResponse{}, w)
 	default:
@@ -250,7 +469,7 @@ func httpEndpointStop(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.R
 	}
 }
 
-func httpEndpointStopAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+func httpEndpointClearOverrideAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
 		programs, err := taskmasterd.GetPrograms()
@@ -261,8 +480,13 @@ func httpEndpointStopAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *htt
 			return
 		}
 
-		for _, program := range programs {
-			program.Stop()
+		for programID := range programs {
+			if err := stateStore.ClearOverride(programID); err != nil {
+				RespondJSON(HttpJSONResponse{
+					Error: err.Error(),
+				}, w)
+				return
+			}
 		}
 
 		RespondJSON(HttpJSONResponse{}, w)
@@ -271,10 +495,43 @@ func httpEndpointStopAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *htt
 	}
 }
 
-func httpEndpointRestart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+func httpEndpointConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
-	case "POST":
-		var input HttpProgramNameInputJSON
+	case "GET":
+		redact, ok := httpRedaction(w, r)
+		if !ok {
+			return
+		}
+
+		programsConfigurationsChan := make(chan ProgramsYaml)
+
+		taskmasterd.ProgramTaskChan <- TaskmasterdTaskGetProgramsConfigurations{
+			TaskBase: TaskBase{
+				Action: TaskmasterdTaskActionGetProgramsConfigurations,
+			},
+			ProgramsConfigurationsChan: programsConfigurationsChan,
+		}
+
+		programsConfigurations := <-programsConfigurationsChan
+		if redact {
+			programsConfigurations = programsConfigurations.Redacted()
+		}
+
+		programsConfigurationsBuffer, err := configEncode(programsConfigurations, taskmasterd.Args.ConfigFormat())
+		if err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		RespondJSON(HttpJSONResponse{
+			Result: HttpConfiguration{
+				Data: string(programsConfigurationsBuffer),
+			},
+		}, w)
+	case "PUT":
+		var input HttpConfigurationEndpointInputJSON
 
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&input); err != nil {
@@ -284,7 +541,27 @@ func httpEndpointRestart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *htt
 			return
 		}
 
-		program, err := taskmasterd.GetProgramById(input.ProgramID)
+		// The configuration replaces the file, which keeps its format.
+		if format := input.ConfigFormat(taskmasterd); format != taskmasterd.Args.ConfigFormat() {
+			RespondJSON(HttpJSONResponse{
+				Error: fmt.Sprintf("configuration must be in %s, not %s", taskmasterd.Args.ConfigFormat(), format),
+			}, w)
+			return
+		}
+
+		reader := strings.NewReader(input.ConfigurationData)
+		errorChan := make(chan error)
+
+		taskmasterd.ProgramTaskChan <- TaskmasterdTaskRefreshConfigurationFromReader{
+			TaskBase: TaskBase{
+				Action: TaskmasterdTaskActionRefreshConfigurationFromReader,
+			},
+			Reader:    reader,
+			ErrorChan: errorChan,
+		}
+
+		err := <-errorChan
+
 		if err != nil {
 			RespondJSON(HttpJSONResponse{
 				Error: err.Error(),
@@ -292,7 +569,16 @@ func httpEndpointRestart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *htt
 			return
 		}
 
-		program.Restart()
+		RespondJSON(HttpJSONResponse{}, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func httpEndpointRefreshConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		taskmasterd.ProgramTaskChan <- TaskmasterdTaskActionRefreshConfigurationFromConfigurationFile
 
 		RespondJSON(HttpJSONResponse{}, w)
 	default:
@@ -300,30 +586,236 @@ func httpEndpointRestart(taskmasterd *Taskmasterd, w http.ResponseWriter, r *htt
 	}
 }
 
-func httpEndpointRestartAll(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+// httpEndpointPlanConfiguration tells what a reload of the configuration file (GET),
+// or the replacement of the configuration by the one given (POST), would do.
+func httpEndpointPlanConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader
+	format := taskmasterd.Args.ConfigFormat()
+
 	switch r.Method {
+	case "GET":
+		configFile, err := os.Open(taskmasterd.Args.ConfigPathArg)
+		if err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+		defer configFile.Close()
+
+		reader = configFile
 	case "POST":
-		programs, err := taskmasterd.GetPrograms()
+		var input HttpConfigurationEndpointInputJSON
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		reader = strings.NewReader(input.ConfigurationData)
+		format = input.ConfigFormat(taskmasterd)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	plan, err := taskmasterd.PlanConfiguration(reader, format)
+	if err != nil {
+		RespondJSON(HttpJSONResponse{
+			Error: err.Error(),
+		}, w)
+		return
+	}
+
+	RespondJSON(HttpJSONResponse{
+		Result: plan,
+	}, w)
+}
+
+func httpEndpointCheckConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader
+	format := taskmasterd.Args.ConfigFormat()
+
+	switch r.Method {
+	case "GET":
+		configFile, err := os.Open(taskmasterd.Args.ConfigPathArg)
 		if err != nil {
 			RespondJSON(HttpJSONResponse{
 				Error: err.Error(),
 			}, w)
 			return
 		}
+		defer configFile.Close()
 
-		for _, program := range programs {
-			program.Restart()
+		reader = configFile
+	case "POST":
+		var input HttpConfigurationEndpointInputJSON
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
 		}
 
-		RespondJSON(HttpJSONResponse{}, w)
+		reader = strings.NewReader(input.ConfigurationData)
+		format = input.ConfigFormat(taskmasterd)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	issues, err := configCheck(reader, format)
+	if err != nil {
+		RespondJSON(HttpJSONResponse{
+			Error: err.Error(),
+		}, w)
+		return
+	}
+
+	check := HttpConfigurationCheck{
+		Valid:  len(issues) == 0,
+		Issues: make([]HttpConfigurationIssue, 0, len(issues)),
 	}
+	for _, issue := range issues {
+		check.Issues = append(check.Issues, HttpConfigurationIssue{
+			Field:  issue.Field,
+			Issue:  issue.Issue.Error(),
+			Line:   issue.Line,
+			Column: issue.Column,
+		})
+	}
+
+	RespondJSON(HttpJSONResponse{
+		Result: check,
+	}, w)
 }
 
-func httpEndpointConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+func httpEndpointConfigurationSchema(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
+		RespondJSON(HttpJSONResponse{
+			Result: ConfigurationJSONSchema(),
+		}, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func httpEndpointImportSupervisord(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		var input HttpImportSupervisordInputJSON
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		var imported *ConfigImport
+		if input.Path != "" {
+			// Files are read with the rights of the daemon.
+			if !httpIsSocketRequest(r) {
+				w.WriteHeader(http.StatusForbidden)
+				RespondJSON(HttpJSONResponse{
+					Error: "files can only be imported through the unix socket",
+				}, w)
+				return
+			}
+
+			var err error
+
+			imported, err = ImportSupervisordFile(input.Path, nil)
+			if err != nil {
+				RespondJSON(HttpJSONResponse{
+					Error: err.Error(),
+				}, w)
+				return
+			}
+		} else {
+			imported = ImportSupervisordData([]byte(input.Data))
+		}
+
+		httpRespondConfigImport(imported, input.Format, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func httpEndpointImportProcfile(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		var input HttpImportProcfileInputJSON
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		for processType, count := range input.Concurrency {
+			if count < 0 {
+				RespondJSON(HttpJSONResponse{
+					Error: fmt.Sprintf("invalid concurrency for %s: %d", processType, count),
+				}, w)
+				return
+			}
+		}
+
+		imported := ImportProcfileData([]byte(input.Data), []byte(input.Env), input.Concurrency)
+
+		httpRespondConfigImport(imported, input.Format, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// httpRespondConfigImport encodes imported programs in the requested format, yaml
+// by default.
+func httpRespondConfigImport(imported *ConfigImport, formatInput string, w http.ResponseWriter) {
+	format := ConfigFormatYaml
+	if formatInput != "" {
+		format = ConfigFormat(formatInput)
+	}
+
+	data, err := configEncode(imported.Programs, format)
+	if err != nil {
+		RespondJSON(HttpJSONResponse{
+			Error: err.Error(),
+		}, w)
+		return
+	}
+
+	warnings := imported.Warnings
+	if warnings == nil {
+		warnings = []ConfigImportWarning{}
+	}
+
+	RespondJSON(HttpJSONResponse{
+		Result: HttpConfigImport{
+			Data:     string(data),
+			Warnings: warnings,
+		},
+	}, w)
+}
+
+func httpEndpointExportSystemd(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		redact, ok := httpRedaction(w, r)
+		if !ok {
+			return
+		}
+
 		programsConfigurationsChan := make(chan ProgramsYaml)
 
 		taskmasterd.ProgramTaskChan <- TaskmasterdTaskGetProgramsConfigurations{
@@ -333,9 +825,34 @@ func httpEndpointConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter,
 			ProgramsConfigurationsChan: programsConfigurationsChan,
 		}
 
-		programsConfigurations := <-programsConfigurationsChan
+		programsYaml := <-programsConfigurationsChan
+
+		programsConfigurations, err := programsYaml.Validate()
+		if err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		if redact {
+			for programName, config := range programsConfigurations {
+				programsConfigurations[programName] = config.Redacted()
+			}
+		}
+
+		RespondJSON(HttpJSONResponse{
+			Result: ExportSystemdUnits(programsConfigurations),
+		}, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
 
-		programsConfigurationsBuffer, err := yaml.Marshal(programsConfigurations)
+func httpEndpointConfigurationVersions(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		versions, err := NewConfigHistory(taskmasterd.Args.ConfigPathArg).Versions()
 		if err != nil {
 			RespondJSON(HttpJSONResponse{
 				Error: err.Error(),
@@ -343,13 +860,73 @@ func httpEndpointConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter,
 			return
 		}
 
+		RespondJSON(HttpJSONResponse{
+			Result: HttpConfigurationVersions{
+				Versions: versions,
+			},
+		}, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func httpEndpointConfigurationDiff(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		redact, ok := httpRedaction(w, r)
+		if !ok {
+			return
+		}
+
+		var input HttpConfigurationDiffInputJSON
+
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		history := NewConfigHistory(taskmasterd.Args.ConfigPathArg)
+
+		from, err := history.Read(input.From)
+		if err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		to, err := history.Read(input.To)
+		if err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		diff := unifiedDiff(configVersionName(input.From), configVersionName(input.To), string(from), string(to))
+		if redact {
+			diff = httpRedactVersions(taskmasterd, diff, from, to)
+		}
+
 		RespondJSON(HttpJSONResponse{
 			Result: HttpConfiguration{
-				Data: string(programsConfigurationsBuffer),
+				Data: diff,
 			},
 		}, w)
-	case "PUT":
-		var input HttpConfigurationEndpointInputJSON
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// httpEndpointConfigurationRollback applies a previous version of the configuration
+// file as if it had been sent through the configuration endpoint.
+func httpEndpointConfigurationRollback(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		var input HttpConfigurationRollbackInputJSON
 
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&input); err != nil {
@@ -359,46 +936,70 @@ func httpEndpointConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter,
 			return
 		}
 
-		reader := strings.NewReader(input.ConfigurationData)
+		if input.Version == configCurrentVersion {
+			RespondJSON(HttpJSONResponse{
+				Error: (&ErrConfigVersionNotFound{Version: input.Version}).Error(),
+			}, w)
+			return
+		}
+
+		data, err := NewConfigHistory(taskmasterd.Args.ConfigPathArg).Read(input.Version)
+		if err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
 		errorChan := make(chan error)
 
 		taskmasterd.ProgramTaskChan <- TaskmasterdTaskRefreshConfigurationFromReader{
 			TaskBase: TaskBase{
 				Action: TaskmasterdTaskActionRefreshConfigurationFromReader,
 			},
-			Reader:    reader,
+			Reader:    bytes.NewReader(data),
 			ErrorChan: errorChan,
 		}
 
-		err := <-errorChan
-
-		if err != nil {
+		if err := <-errorChan; err != nil {
 			RespondJSON(HttpJSONResponse{
 				Error: err.Error(),
 			}, w)
 			return
 		}
 
+		log.Printf("Configuration rolled back to version %d", input.Version)
+
 		RespondJSON(HttpJSONResponse{}, w)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-func httpEndpointRefreshConfiguration(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "PUT":
-		taskmasterd.ProgramTaskChan <- TaskmasterdTaskActionRefreshConfigurationFromConfigurationFile
+// httpRedactVersions masks in text the sensitive values of versions of the
+// configuration file, and the ones of every configuration loaded since the start.
+func httpRedactVersions(taskmasterd *Taskmasterd, text string, versions ...[]byte) string {
+	redactor := NewRedactor()
 
-		RespondJSON(HttpJSONResponse{}, w)
-	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	for _, version := range versions {
+		// Versions which cannot be decoded anymore are only redacted from known values.
+		programs, err := configDecode(bytes.NewReader(version), taskmasterd.Args.ConfigFormat())
+		if err == nil {
+			redactor.Add(programs.SensitiveValues()...)
+		}
 	}
+
+	return sensitiveValues.Redact(redactor.Redact(text))
 }
 
 func httpEndpointLogs(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
+		redact, ok := httpRedaction(w, r)
+		if !ok {
+			return
+		}
+
 		configFileData, err := ioutil.ReadFile(taskmasterd.Args.LogPathArg)
 		if err != nil {
 			RespondJSON(HttpJSONResponse{
@@ -407,9 +1008,15 @@ func httpEndpointLogs(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.R
 			return
 		}
 
+		logs := string(configFileData)
+		if redact {
+			// Logs written before values were known to be sensitive are redacted too.
+			logs = sensitiveValues.Redact(logs)
+		}
+
 		RespondJSON(HttpJSONResponse{
 			Result: HttpLogs{
-				Data: string(configFileData),
+				Data: logs,
 			},
 		}, w)
 	case "DELETE":
@@ -480,6 +1087,21 @@ func httpEndpointEditProgram(taskmasterd *Taskmasterd, w http.ResponseWriter, r
 			return
 		}
 
+		var canary *CanaryOptions
+		if editProgram.Canary != nil {
+			if editProgram.Canary.Window < 0 {
+				RespondJSON(HttpJSONResponse{
+					Error: "canary window must be positive",
+				}, w)
+				return
+			}
+
+			canary = &CanaryOptions{
+				ProcessID: editProgram.Canary.ProcessID,
+				Window:    time.Duration(editProgram.Canary.Window) * time.Second,
+			}
+		}
+
 		errorChan := make(chan error)
 
 		taskmasterd.ProgramTaskChan <- TaskmasterdTaskEditProgram{
@@ -488,6 +1110,7 @@ func httpEndpointEditProgram(taskmasterd *Taskmasterd, w http.ResponseWriter, r
 			},
 			ProgramId:            editProgram.Id,
 			ProgramConfiguration: editProgram.Configuration,
+			Canary:               canary,
 			ErrorChan:            errorChan,
 		}
 
@@ -573,10 +1196,57 @@ func httpEndpointShutdown(taskmasterd *Taskmasterd, w http.ResponseWriter, r *ht
 	}
 }
 
+func httpEndpointUpgrade(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		if err := taskmasterd.Upgrade(); err != nil {
+			RespondJSON(HttpJSONResponse{
+				Error: err.Error(),
+			}, w)
+			return
+		}
+
+		// The HTTP server waits for the response to be sent before shutting down.
+		taskmasterd.HandOver()
+
+		RespondJSON(HttpJSONResponse{
+			Result: true,
+		}, w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func httpNotFound(taskmasterd *Taskmasterd, w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
+// httpIsSocketRequest tells whether the request came through the unix socket,
+// which only the user running the daemon can connect to.
+func httpIsSocketRequest(r *http.Request) bool {
+	localAddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && localAddr.Network() == "unix"
+}
+
+// httpRedaction tells whether sensitive values must be masked in the response,
+// which they are unless the caller asks for them with unredacted=true. Only callers
+// of the unix socket may do so: others are refused, and ok is false.
+func httpRedaction(w http.ResponseWriter, r *http.Request) (redact bool, ok bool) {
+	if r.URL.Query().Get("unredacted") != "true" {
+		return true, true
+	}
+
+	if !httpIsSocketRequest(r) {
+		w.WriteHeader(http.StatusForbidden)
+		RespondJSON(HttpJSONResponse{
+			Error: "unredacted values are only available through the unix socket",
+		}, w)
+		return false, false
+	}
+
+	return false, true
+}
+
 func httpHandleEndpoint(taskmasterd *Taskmasterd, callback HttpEndpointFunc) HttpHandleFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println(r.RemoteAddr, r.Method, r.RequestURI)
@@ -597,10 +1267,52 @@ func httpSetup(taskmasterd *Taskmasterd) {
 	}
 }
 
-func httpListenAndServe(ctx context.Context, port int) chan struct{} {
-	server := http.Server{
-		Addr: ":" + strconv.Itoa(port),
+// httpListenSocket listens on a unix socket only the user running the daemon can
+// connect to. A socket left by a previous daemon is replaced, but no other file.
+func httpListenSocket(path string) (*net.UnixListener, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
 	}
+
+	// The umask of the daemon is left untouched, as programs without one inherit it.
+	// The socket is rather bound in a directory nobody else can enter, and only
+	// moved in place once restricted.
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".taskmasterd-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	boundPath := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{
+		Name: boundPath,
+		Net:  "unix",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A new daemon taking over replaces the socket, which must then outlive this one.
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(boundPath, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(boundPath, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func httpServe(ctx context.Context, listener net.Listener) chan struct{} {
+	server := http.Server{}
 	idleConnectionsClosed := make(chan struct{})
 
 	go func() {
@@ -613,9 +1325,9 @@ func httpListenAndServe(ctx context.Context, port int) chan struct{} {
 		close(idleConnectionsClosed)
 	}()
 
-	log.Printf("Launching HTTP REST API on port :%d", port)
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("HTTP server ListenAndServe: %v", err)
+	log.Printf("Launching HTTP REST API on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("HTTP server Serve: %v", err)
 	}
 
 	return idleConnectionsClosed
@@ -0,0 +1,92 @@
+package main
+
+import "syscall"
+
+// RLIMIT_NPROC is not exported by the syscall package.
+const rlimitNproc = 0x6
+
+const (
+	NiceMin        = -20
+	NiceMax        = 19
+	OomScoreAdjMin = -1000
+	OomScoreAdjMax = 1000
+
+	// RlimitUnlimited can be used as a value to remove a limit.
+	RlimitUnlimited = -1
+)
+
+type ProgramRlimitsYaml struct {
+	Nofile *int64 `yaml:"nofile,omitempty" json:"nofile,omitempty" toml:"nofile,omitempty"`
+	Core   *int64 `yaml:"core,omitempty" json:"core,omitempty" toml:"core,omitempty"`
+	As     *int64 `yaml:"as,omitempty" json:"as,omitempty" toml:"as,omitempty"`
+	Cpu    *int64 `yaml:"cpu,omitempty" json:"cpu,omitempty" toml:"cpu,omitempty"`
+	Nproc  *int64 `yaml:"nproc,omitempty" json:"nproc,omitempty" toml:"nproc,omitempty"`
+}
+
+type ProgramRlimits struct {
+	Nofile *int64 `json:"nofile,omitempty"`
+	Core   *int64 `json:"core,omitempty"`
+	As     *int64 `json:"as,omitempty"`
+	Cpu    *int64 `json:"cpu,omitempty"`
+	Nproc  *int64 `json:"nproc,omitempty"`
+}
+
+// Validate returns the name of the faulty limit along with the issue, if any.
+func (rlimits *ProgramRlimitsYaml) Validate() (ProgramRlimits, string, error) {
+	limits := []struct {
+		Name  string
+		Value *int64
+	}{
+		{"Nofile", rlimits.Nofile},
+		{"Core", rlimits.Core},
+		{"As", rlimits.As},
+		{"Cpu", rlimits.Cpu},
+		{"Nproc", rlimits.Nproc},
+	}
+
+	for _, limit := range limits {
+		if limit.Value != nil && *limit.Value < RlimitUnlimited {
+			return ProgramRlimits{}, limit.Name, ValidationIssueValueOutsideBounds
+		}
+	}
+
+	return ProgramRlimits{
+		Nofile: rlimits.Nofile,
+		Core:   rlimits.Core,
+		As:     rlimits.As,
+		Cpu:    rlimits.Cpu,
+		Nproc:  rlimits.Nproc,
+	}, "", nil
+}
+
+func (rlimits ProgramRlimits) toChildRlimits() []ChildRlimit {
+	limits := []struct {
+		Resource int
+		Value    *int64
+	}{
+		{syscall.RLIMIT_NOFILE, rlimits.Nofile},
+		{syscall.RLIMIT_CORE, rlimits.Core},
+		{syscall.RLIMIT_AS, rlimits.As},
+		{syscall.RLIMIT_CPU, rlimits.Cpu},
+		{rlimitNproc, rlimits.Nproc},
+	}
+
+	childRlimits := []ChildRlimit{}
+	for _, limit := range limits {
+		if limit.Value == nil {
+			continue
+		}
+
+		value := uint64(*limit.Value)
+		if *limit.Value == RlimitUnlimited {
+			value = ^uint64(0)
+		}
+
+		childRlimits = append(childRlimits, ChildRlimit{
+			Resource: limit.Resource,
+			Value:    value,
+		})
+	}
+
+	return childRlimits
+}
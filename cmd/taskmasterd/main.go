@@ -3,46 +3,119 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"os"
+	"sort"
+	"strings"
 )
 
-func rootCheck(bypass bool) {
-	if os.Geteuid() == 0 && !bypass {
-		log.Print("Taskmasterd should not be launched as root. Please use a non-root user.")
-		log.Print("Use -r argument to launch as root anyway.")
-		os.Exit(1)
+// rootCheck forbids running the daemon as root, unless -r is given or every
+// program drops its privileges by specifying a non-root user.
+func rootCheck(bypass bool, configs ProgramsConfigurations) {
+	if os.Geteuid() != 0 || bypass {
+		return
+	}
+
+	programsRunningAsRoot := []string{}
+	for _, config := range configs {
+		if config.runAs == nil || config.runAs.Credential.Uid == 0 {
+			programsRunningAsRoot = append(programsRunningAsRoot, config.Name)
+		}
 	}
+	if len(programsRunningAsRoot) == 0 {
+		return
+	}
+
+	sort.Strings(programsRunningAsRoot)
+
+	log.Print("Taskmasterd should not be launched as root. Please use a non-root user.")
+	log.Printf("Programs that would run as root: %s", strings.Join(programsRunningAsRoot, ", "))
+	log.Print("Set a non-root user for these programs, or use -r argument to launch as root anyway.")
+	os.Exit(1)
 }
 
 func main() {
+	if childHelperIsRequested() {
+		childHelperMain()
+	}
+
+	if configSubcommandIsRequested() {
+		configSubcommandMain()
+	}
+
+	upgrade := upgradeIsRequested()
+
 	var args Args
 	args.Parse()
 
-	logLogo()
+	if format := args.ConfigFormat(); !format.Valid() {
+		log.Fatal(&ErrConfigFormatUnknown{
+			Format: string(format),
+		})
+	}
 
-	rootCheck(args.BypassRootArg)
+	if args.CheckArg {
+		checkModeMain(args)
+	}
+
+	logLogo()
 
 	configReader, err := configGetFileReader(args.ConfigPathArg)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	programsYamlConfiguration, programsConfigurations, err := configParse(configReader)
+	programsYamlConfiguration, programsConfigurations, err := configParse(configReader, args.ConfigFormat())
 	if err != nil {
 		log.Fatalf("Error parsing configuration file: %s: %v\n", args.ConfigPathArg, err)
 		os.Exit(1)
 	}
 	configReader.Close()
 
+	rootCheck(args.BypassRootArg, programsConfigurations)
+
 	daemonInit(args)
 
 	// Daemon only code
 
+	log.SetOutput(sensitiveValues.Writer(os.Stderr))
+
 	log.Printf("Started as daemon with PID %d", os.Getpid())
 
 	lockFileCreate()
 	defer lockFileRemove()
 
+	listener, err := httpListen(args.PortArg, upgrade)
+	if err != nil {
+		log.Fatalf("HTTP server Listen: %v", err)
+	}
+
+	var socketListener net.Listener
+	if args.SocketPathArg != "" {
+		unixListener, err := httpListenSocket(args.SocketPathArg)
+		if err != nil {
+			log.Fatalf("HTTP server Listen: %v", err)
+		}
+		defer os.Remove(args.SocketPathArg)
+
+		socketListener = unixListener
+	}
+
+	if upgrade {
+		log.Print("Configuration is valid, waiting for the previous daemon to hand over...")
+		if err := upgradeTakeOver(); err != nil {
+			log.Fatalf("Could not take over from the previous daemon: %v", err)
+		}
+	}
+
+	if err := stateStore.Open(args.StatePathArg); err != nil {
+		log.Printf("Could not open state file %s, running processes will not be adopted: %v", args.StatePathArg, err)
+	}
+
+	if err := subreaperSetup(); err != nil {
+		log.Printf("Could not become a subreaper, orphans will escape supervision: %v", err)
+	}
+
 	context, cancel := context.WithCancel(context.Background())
 
 	taskmasterd := NewTaskmasterd(NewTaskmasterdArgs{
@@ -50,13 +123,29 @@ func main() {
 		ProgramsConfiguration: programsYamlConfiguration,
 		Context:               context,
 		Cancel:                cancel,
+		Listener:              listener,
 	})
 	taskmasterd.SignalsSetup()
-	go taskmasterd.LoadProgramsConfigurations(programsConfigurations)
+	go func() {
+		if err := taskmasterd.LoadProgramsConfigurations(programsConfigurations); err != nil {
+			return
+		}
+
+		terminateUnadoptedProcesses()
+	}()
 
 	httpSetup(taskmasterd)
-	<-httpListenAndServe(context, args.PortArg)
+	if socketListener != nil {
+		go httpServe(context, socketListener)
+	}
+	<-httpServe(context, listener)
 	<-taskmasterd.Closed
 
+	select {
+	case <-taskmasterd.HandedOver:
+		taskmasterd.handOverExit()
+	default:
+	}
+
 	log.Println("Exited gracefully, bye!")
 }
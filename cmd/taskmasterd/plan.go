@@ -0,0 +1,170 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ConfigurationPlan describes what loading a configuration would do to the running programs.
+type ConfigurationPlan struct {
+	Added     []string             `json:"added"`
+	Removed   []string             `json:"removed"`
+	Scaled    []ProgramScalePlan   `json:"scaled"`
+	Restarted []ProgramRestartPlan `json:"restarted"`
+}
+
+type ProgramScalePlan struct {
+	Program string `json:"program"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Delta   int    `json:"delta"`
+}
+
+type ProgramRestartPlan struct {
+	Program   string   `json:"program"`
+	Fields    []string `json:"fields"`
+	Processes []string `json:"processes"`
+}
+
+// restartTriggeringFields returns the fields whose change requires the processes
+// of a program to be restarted. Changed environment variables are listed one by one.
+func restartTriggeringFields(current, next ProgramConfiguration) []string {
+	fields := []string{}
+
+	if next.Cmd != current.Cmd {
+		fields = append(fields, "cmd")
+	}
+	fields = append(fields, changedEnvFields(current, next)...)
+	if !reflect.DeepEqual(next.EnvFiles, current.EnvFiles) {
+		fields = append(fields, "env_file")
+	}
+
+	comparisons := []struct {
+		Field   string
+		Changed bool
+	}{
+		{"umask", next.Umask != current.Umask},
+		{"stdout", next.Stdout != current.Stdout},
+		{"stderr", next.Stderr != current.Stderr},
+		{"workingdir", next.Workingdir != current.Workingdir},
+		{"base_port", next.BasePort != current.BasePort},
+		{"user", next.User != current.User},
+		{"group", next.Group != current.Group},
+		{"rlimits", !reflect.DeepEqual(next.Rlimits, current.Rlimits)},
+		{"nice", !reflect.DeepEqual(next.Nice, current.Nice)},
+		{"oomscoreadj", !reflect.DeepEqual(next.Oomscoreadj, current.Oomscoreadj)},
+		{"processgroup", next.Processgroup != current.Processgroup},
+		{"inherit_env", next.InheritEnv != current.InheritEnv},
+		{"inherit_env_allow", !reflect.DeepEqual(next.InheritEnvAllow, current.InheritEnvAllow)},
+	}
+	for _, comparison := range comparisons {
+		if comparison.Changed {
+			fields = append(fields, comparison.Field)
+		}
+	}
+
+	return fields
+}
+
+// changedEnvFields compares env values and their secret references, as secrets
+// themselves are only known by processes.
+func changedEnvFields(current, next ProgramConfiguration) []string {
+	changed := make(map[string]bool)
+
+	for name, value := range next.Env {
+		if currentValue, ok := current.Env[name]; !ok || currentValue != value {
+			changed[name] = true
+		}
+	}
+	for name := range current.Env {
+		if _, ok := next.Env[name]; !ok {
+			changed[name] = true
+		}
+	}
+	for name, secret := range next.EnvSecrets {
+		if currentSecret, ok := current.EnvSecrets[name]; !ok || currentSecret != secret {
+			changed[name] = true
+		}
+	}
+	for name := range current.EnvSecrets {
+		if _, ok := next.EnvSecrets[name]; !ok {
+			changed[name] = true
+		}
+	}
+
+	fields := []string{}
+	for name := range changed {
+		fields = append(fields, "env."+name)
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+// PlanConfiguration computes what Program.setConfig and the loading of configurations
+// would do when replacing current configurations by next ones, without applying anything.
+func PlanConfiguration(current, next ProgramsConfigurations) ConfigurationPlan {
+	plan := ConfigurationPlan{
+		Added:     []string{},
+		Removed:   []string{},
+		Scaled:    []ProgramScalePlan{},
+		Restarted: []ProgramRestartPlan{},
+	}
+
+	for name := range current {
+		if _, ok := next[name]; !ok {
+			plan.Removed = append(plan.Removed, name)
+		}
+	}
+
+	for name, nextConfig := range next {
+		currentConfig, ok := current[name]
+		if !ok {
+			plan.Added = append(plan.Added, name)
+			continue
+		}
+
+		if delta := nextConfig.Numprocs - currentConfig.Numprocs; delta != 0 {
+			plan.Scaled = append(plan.Scaled, ProgramScalePlan{
+				Program: name,
+				From:    currentConfig.Numprocs,
+				To:      nextConfig.Numprocs,
+				Delta:   delta,
+			})
+		}
+
+		fields := restartTriggeringFields(currentConfig, nextConfig)
+		if len(fields) == 0 || programRestartIsPrevented(name) {
+			continue
+		}
+
+		// Processes being removed are stopped, not restarted.
+		keptProcesses := currentConfig.Numprocs
+		if nextConfig.Numprocs < keptProcesses {
+			keptProcesses = nextConfig.Numprocs
+		}
+
+		processes := make([]string, 0, keptProcesses)
+		for index := 1; index <= keptProcesses; index++ {
+			processes = append(processes, createProcessName(name, index))
+		}
+
+		plan.Restarted = append(plan.Restarted, ProgramRestartPlan{
+			Program:   name,
+			Fields:    fields,
+			Processes: processes,
+		})
+	}
+
+	sort.Strings(plan.Added)
+	sort.Strings(plan.Removed)
+	sort.Slice(plan.Scaled, func(i, j int) bool {
+		return plan.Scaled[i].Program < plan.Scaled[j].Program
+	})
+	sort.Slice(plan.Restarted, func(i, j int) bool {
+		return plan.Restarted[i].Program < plan.Restarted[j].Program
+	})
+
+	return plan
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanConfigurationListsRestartTriggeringFields(t *testing.T) {
+	current := ProgramsConfigurations{
+		"web": ProgramConfiguration{
+			Name:     "web",
+			Cmd:      "/bin/web",
+			Numprocs: 3,
+			Env: map[string]string{
+				"PATH": "/bin",
+			},
+		},
+		"old": ProgramConfiguration{
+			Name:     "old",
+			Cmd:      "/bin/old",
+			Numprocs: 1,
+		},
+	}
+	next := ProgramsConfigurations{
+		"web": ProgramConfiguration{
+			Name:     "web",
+			Cmd:      "/bin/web",
+			Numprocs: 2,
+			Umask:    "077",
+			Env: map[string]string{
+				"PAHT": "/bin",
+			},
+		},
+		"new": ProgramConfiguration{
+			Name:     "new",
+			Cmd:      "/bin/new",
+			Numprocs: 1,
+		},
+	}
+
+	plan := PlanConfiguration(current, next)
+
+	expected := ConfigurationPlan{
+		Added:   []string{"new"},
+		Removed: []string{"old"},
+		Scaled: []ProgramScalePlan{
+			{Program: "web", From: 3, To: 2, Delta: -1},
+		},
+		Restarted: []ProgramRestartPlan{
+			{
+				Program:   "web",
+				Fields:    []string{"env.PAHT", "env.PATH", "umask"},
+				Processes: []string{"web_1", "web_2"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("incorrect plan %+v; expected %+v", plan, expected)
+	}
+}
+
+func TestPlanConfigurationIgnoresFieldsNotRequiringRestart(t *testing.T) {
+	current := ProgramsConfigurations{
+		"web": ProgramConfiguration{
+			Name:      "web",
+			Cmd:       "/bin/web",
+			Numprocs:  1,
+			Stoptime:  5,
+			Autostart: true,
+		},
+	}
+	next := ProgramsConfigurations{
+		"web": ProgramConfiguration{
+			Name:      "web",
+			Cmd:       "/bin/web",
+			Numprocs:  1,
+			Stoptime:  10,
+			Autostart: false,
+		},
+	}
+
+	plan := PlanConfiguration(current, next)
+
+	if len(plan.Added)+len(plan.Removed)+len(plan.Scaled)+len(plan.Restarted) != 0 {
+		t.Errorf("unexpected changes in plan %+v; expected none", plan)
+	}
+}
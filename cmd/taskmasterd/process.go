@@ -14,8 +14,20 @@ type ProcessSerialized struct {
 	ID                 string
 	State              machine.StateType
 	StartedAt, EndedAt time.Time
+	History            []ProcessHistoryEntry
 }
 
+// ProcessHistoryEntry records something that happened to a process,
+// like a state transition or a signal sent to stop it.
+type ProcessHistoryEntry struct {
+	Time    time.Time         `json:"time"`
+	State   machine.StateType `json:"state"`
+	Message string            `json:"message,omitempty"`
+}
+
+// Only the most recent entries of the history of a process are kept.
+const processHistoryMaxLength = 50
+
 type Processer interface {
 	GetConfig() (ProgramConfiguration, error)
 	GetContext() context.Context
@@ -23,11 +35,15 @@ type Processer interface {
 	GetCmd() *exec.Cmd
 	SetCmd(*exec.Cmd)
 	SetStdoutStderrCloser(stdout, stderr io.WriteCloser)
+	AppendHistory(state machine.StateType, message string)
 	StartChronometer()
 	StopChronometer()
+	RestoreChronometer(startedAt time.Time)
 	Start()
 	Stop()
 	Restart()
+	Pause()
+	Resume()
 	Kill()
 	Wait()
 	GetDeadChannel() chan struct{}
@@ -46,6 +62,7 @@ type Process struct {
 	stdoutClose, stderrClose                       func() error
 	machine                                        *machine.Machine
 	startedAt, endedAt                             time.Time
+	history                                        []ProcessHistoryEntry
 
 	deadCh chan struct{}
 }
@@ -54,6 +71,10 @@ type NewProcessArgs struct {
 	ID              string
 	Context         context.Context
 	ProgramTaskChan chan<- Tasker
+
+	// Adoption is set when the process has been left running by a previous daemon.
+	// It is adopted instead of being started on next start event.
+	Adoption *ProcessStateRecord
 }
 
 func NewProcess(args NewProcessArgs) *Process {
@@ -67,6 +88,7 @@ func NewProcess(args NewProcessArgs) *Process {
 	}
 
 	process.machine = NewProcessMachine(process)
+	process.machine.Context.(*ProcessMachineContext).Adoption = args.Adoption
 
 	go process.monitor()
 
@@ -91,6 +113,10 @@ func (process *Process) monitor() {
 					<-process.deadCh
 					process.machine.Send(ProcessEventStart)
 				}()
+			case ProcessTaskActionPause:
+				go process.machine.Send(ProcessEventPause)
+			case ProcessTaskActionResume:
+				go process.machine.Send(ProcessEventResume)
 			case ProcessTaskActionKill:
 				go process.cmd.Process.Signal(syscall.SIGKILL)
 			}
@@ -102,17 +128,23 @@ func (process *Process) monitor() {
 				process.endedAt = time.Time{}
 			case ProcessTaskActionStopChronometer:
 				process.endedAt = time.Now()
+			case ProcessTaskActionRestoreChronometer:
+				taskWithPayload := task.(ProcessInternalTaskWithPayload)
+
+				process.startedAt = taskWithPayload.Payload.(time.Time)
+				process.endedAt = time.Time{}
 			case ProcessTaskActionGetProgramConfig:
 				taskWithResponse := task.(ProcessInternalTaskWithResponse)
 				responseChan := taskWithResponse.ResponseChan
 				programResponseChan := make(chan interface{})
 
 				select {
-				case process.programMonitorChannel <- ProgramTaskRootActionWithResponse{
-					ProgramTaskRootAction: ProgramTaskRootAction{
+				case process.programMonitorChannel <- ProcessTaskWithResponse{
+					ProcessTask: ProcessTask{
 						TaskBase: TaskBase{
-							Action: ProgramTaskActionGetConfig,
+							Action: ProgramTaskActionGetProcessConfig,
 						},
+						ProcessID: process.id,
 					},
 
 					ResponseChan: programResponseChan,
@@ -136,11 +168,15 @@ func (process *Process) monitor() {
 				taskWithResponse := task.(ProcessInternalTaskWithResponse)
 				responseChan := taskWithResponse.ResponseChan
 
+				history := make([]ProcessHistoryEntry, len(process.history))
+				copy(history, process.history)
+
 				responseChan <- ProcessSerialized{
 					ID:        process.id,
 					State:     process.machine.UnsafeCurrent(),
 					StartedAt: process.startedAt,
 					EndedAt:   process.endedAt,
+					History:   history,
 				}
 
 				close(responseChan)
@@ -189,6 +225,14 @@ func (process *Process) monitor() {
 
 				process.stdoutClose = stdoutClose
 				process.stderrClose = stderrClose
+			case ProcessTaskActionAppendHistory:
+				taskWithPayload := task.(ProcessInternalTaskWithPayload)
+				entry := taskWithPayload.Payload.(ProcessHistoryEntry)
+
+				process.history = append(process.history, entry)
+				if overflow := len(process.history) - processHistoryMaxLength; overflow > 0 {
+					process.history = process.history[overflow:]
+				}
 			}
 		}
 	}
@@ -216,6 +260,18 @@ func (process *Process) StopChronometer() {
 	}
 }
 
+func (process *Process) RestoreChronometer(startedAt time.Time) {
+	select {
+	case process.internalMonitorChannel <- ProcessInternalTaskWithPayload{
+		TaskBase: TaskBase{
+			Action: ProcessTaskActionRestoreChronometer,
+		},
+		Payload: startedAt,
+	}:
+	case <-process.context.Done():
+	}
+}
+
 func (process *Process) Start() {
 	go func() {
 		select {
@@ -249,6 +305,28 @@ func (process *Process) Restart() {
 	}()
 }
 
+func (process *Process) Pause() {
+	go func() {
+		select {
+		case process.externalMonitorChannel <- ProcessTaskActionPause:
+			return
+		case <-process.context.Done():
+			return
+		}
+	}()
+}
+
+func (process *Process) Resume() {
+	go func() {
+		select {
+		case process.externalMonitorChannel <- ProcessTaskActionResume:
+			return
+		case <-process.context.Done():
+			return
+		}
+	}()
+}
+
 func (process *Process) Kill() {
 	go func() {
 		select {
@@ -402,19 +480,17 @@ func (process *Process) GetStateMachineCurrentState() machine.StateType {
 	}
 }
 
+// SetCmd is synchronous, so that the command can be read back as soon as it returns.
 func (process *Process) SetCmd(cmd *exec.Cmd) {
-	go func() {
-		select {
-		case process.internalMonitorChannel <- ProcessInternalTaskWithPayload{
-			TaskBase: TaskBase{
-				Action: ProcessTaskActionSetCmd,
-			},
-			Payload: cmd,
-		}:
-		case <-process.context.Done():
-			return
-		}
-	}()
+	select {
+	case process.internalMonitorChannel <- ProcessInternalTaskWithPayload{
+		TaskBase: TaskBase{
+			Action: ProcessTaskActionSetCmd,
+		},
+		Payload: cmd,
+	}:
+	case <-process.context.Done():
+	}
 }
 
 func (process *Process) SetStdoutStderrCloser(stdout, stderr io.WriteCloser) {
@@ -447,3 +523,21 @@ func (process *Process) Wait() {
 		<-deadCh
 	}
 }
+
+func (process *Process) AppendHistory(state machine.StateType, message string) {
+	entry := ProcessHistoryEntry{
+		Time:    time.Now(),
+		State:   state,
+		Message: message,
+	}
+
+	select {
+	case process.internalMonitorChannel <- ProcessInternalTaskWithPayload{
+		TaskBase: TaskBase{
+			Action: ProcessTaskActionAppendHistory,
+		},
+		Payload: entry,
+	}:
+	case <-process.context.Done():
+	}
+}
@@ -3,8 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
-	"os/exec"
+	"syscall"
 	"time"
 
 	"github.com/42Taskmaster/taskmaster/machine"
@@ -67,22 +66,47 @@ func ProcessStartAction(stateMachine *machine.Machine, context machine.Context)
 		return machine.NoopEvent, err
 	}
 
-	expandedCommand := os.ExpandEnv(config.Cmd)
-	parsedCommand, err := parser.ParseCommand(expandedCommand)
+	if adoption := processContext.Adoption; adoption != nil {
+		processContext.Adoption = nil
+
+		return processAdopt(stateMachine, process, config, *adoption)
+	}
+
+	serializedProcess := process.Serialize()
+
+	config = config.ForProcess(serializedProcess.ID)
+
+	// Secrets are only read now, and only kept by the daemon to be redacted.
+	secretEnv, err := config.ResolveEnvSecrets()
 	if err != nil {
+		processContext.LastError = err
+
 		return ProcessEventStopped, nil
 	}
+	for _, value := range secretEnv {
+		sensitiveValues.Add(value)
+	}
 
-	cmd := exec.CommandContext(
-		process.GetContext(),
-		parsedCommand.Cmd,
-		parsedCommand.Args...,
-	)
+	env, err := config.CreateCmdEnvironment(secretEnv)
+	if err != nil {
+		processContext.LastError = err
 
-	cmd.Env = config.CreateCmdEnvironment()
-	cmd.Stdin = nil
+		return ProcessEventStopped, nil
+	}
 
-	serializedProcess := process.Serialize()
+	parsedCommand, err := parser.ParseCommand(config.ExpandCmd(env))
+	if err != nil {
+		return ProcessEventStopped, nil
+	}
+
+	cmd, err := config.CreateCmd(parsedCommand, env)
+	if err != nil {
+		processContext.LastError = err
+
+		return ProcessEventStopped, nil
+	}
+
+	cmd.Stdin = nil
 
 	stdout, err := config.CreateCmdStdout(serializedProcess.ID)
 	if err != nil {
@@ -104,17 +128,13 @@ func ProcessStartAction(stateMachine *machine.Machine, context machine.Context)
 
 	deadCh := process.CreateNewDeadChannel()
 
-	SetUmask(config.Umask)
-	if err := cmd.Start(); err != nil {
+	if err := childrenRegistry.Start(cmd, config.Name, serializedProcess.ID); err != nil {
 		processContext.LastError = err
 
-		ResetUmask()
-
 		close(deadCh)
 
 		return ProcessEventStopped, nil
 	}
-	ResetUmask()
 
 	process.StartChronometer()
 
@@ -133,6 +153,7 @@ func ProcessStartAction(stateMachine *machine.Machine, context machine.Context)
 		defer close(deadCh)
 
 		cmd.Wait()
+		childrenRegistry.Release(cmd.Process.Pid)
 
 		process.StopChronometer()
 
@@ -155,7 +176,22 @@ func ProcessStopAction(stateMachine *machine.Machine, context machine.Context) (
 
 	serializedProcess := process.Serialize()
 
-	err = process.GetCmd().Process.Signal(config.Stopsignal.ToOsSignal())
+	tree := NewProcessTree(process.GetCmd().Process.Pid, config)
+
+	// A paused process could not handle the stop signal.
+	if stateMachine.UnsafePrevious() == ProcessStatePaused {
+		if err := tree.Signal(syscall.SIGCONT); err != nil {
+			return machine.NoopEvent, &ErrProcessAction{
+				ID:  serializedProcess.ID,
+				Err: err,
+			}
+		}
+	}
+
+	config.Stopsequence = config.StopSteps()
+
+	firstStep := config.Stopsequence[0]
+	err = sendStopStep(process, config, tree, 0, firstStep)
 	if err != nil {
 		return machine.NoopEvent, &ErrProcessAction{
 			ID:  serializedProcess.ID,
@@ -163,17 +199,114 @@ func ProcessStopAction(stateMachine *machine.Machine, context machine.Context) (
 		}
 	}
 
+	deadCh := process.GetDeadChannel()
+
 	go func() {
-		select {
-		case <-time.After(time.Duration(config.Stoptime) * time.Second):
-			process.Kill()
-		case <-process.GetDeadChannel():
+		if waitProcessTreeExit(tree, deadCh, time.Duration(firstStep.Wait)*time.Second) {
+			return
 		}
+
+		for index, step := range config.Stopsequence[1:] {
+			sendStopStep(process, config, tree, index+1, step)
+
+			if waitProcessTreeExit(tree, deadCh, time.Duration(step.Wait)*time.Second) {
+				return
+			}
+		}
+
+		// Whatever the sequence is, a stopped process must be stopped for real.
+		message := "stop sequence exhausted, sending KILL"
+		log.Printf("Process '%s' of program '%s': %s", serializedProcess.ID, config.Name, message)
+		process.AppendHistory(ProcessStateStopping, message)
+
+		tree.Signal(syscall.SIGKILL)
 	}()
 
 	return machine.NoopEvent, nil
 }
 
+func sendStopStep(process Processer, config ProgramConfiguration, tree *ProcessTree, index int, step StopStep) error {
+	serializedProcess := process.Serialize()
+
+	message := fmt.Sprintf(
+		"stop step %d/%d: sending %s, waiting up to %ds",
+		index+1,
+		len(config.Stopsequence),
+		step.Signal,
+		step.Wait,
+	)
+	log.Printf("Process '%s' of program '%s': %s", serializedProcess.ID, config.Name, message)
+	process.AppendHistory(ProcessStateStopping, message)
+
+	return tree.Signal(step.Signal.ToOsSignal().(syscall.Signal))
+}
+
+// waitProcessTreeExit returns true if the whole tree exited before timeout.
+// Members of the group or descendants of the process may survive it,
+// in which case they are polled until timeout.
+func waitProcessTreeExit(tree *ProcessTree, deadCh <-chan struct{}, timeout time.Duration) bool {
+	const survivorsPollInterval = 200 * time.Millisecond
+
+	deadline := time.After(timeout)
+
+	select {
+	case <-deadCh:
+	case <-deadline:
+		return !tree.Alive()
+	}
+
+	ticker := time.NewTicker(survivorsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if !tree.Alive() {
+			return true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return !tree.Alive()
+		}
+	}
+}
+
+func ProcessPauseAction(stateMachine *machine.Machine, context machine.Context) (machine.EventType, error) {
+	return signalProcessTreeAction(context, syscall.SIGSTOP)
+}
+
+func ProcessResumeAction(stateMachine *machine.Machine, context machine.Context) (machine.EventType, error) {
+	if stateMachine.UnsafePrevious() != ProcessStatePaused {
+		return machine.NoopEvent, nil
+	}
+
+	return signalProcessTreeAction(context, syscall.SIGCONT)
+}
+
+func signalProcessTreeAction(context machine.Context, signal syscall.Signal) (machine.EventType, error) {
+	var (
+		processContext = context.(*ProcessMachineContext)
+		process        = processContext.Process
+	)
+
+	config, err := process.GetConfig()
+	if err != nil {
+		return machine.NoopEvent, err
+	}
+
+	serializedProcess := process.Serialize()
+
+	tree := NewProcessTree(process.GetCmd().Process.Pid, config)
+	if err := tree.Signal(signal); err != nil {
+		return machine.NoopEvent, &ErrProcessAction{
+			ID:  serializedProcess.ID,
+			Err: err,
+		}
+	}
+
+	return machine.NoopEvent, nil
+}
+
 func ProcessBackoffAction(stateMachine *machine.Machine, context machine.Context) (machine.EventType, error) {
 	processContext := context.(*ProcessMachineContext)
 	process := processContext.Process
@@ -224,6 +357,48 @@ func ProcessExitedAction(stateMachine *machine.Machine, context machine.Context)
 	}
 }
 
+// ProcessPersistStateAction records the process in the state file, so that the next
+// daemon can adopt it if this one exits without stopping it.
+func ProcessPersistStateAction(stateMachine *machine.Machine, context machine.Context) (machine.EventType, error) {
+	var (
+		processContext = context.(*ProcessMachineContext)
+		process        = processContext.Process
+	)
+
+	config, err := process.GetConfig()
+	if err != nil {
+		return machine.NoopEvent, err
+	}
+
+	serializedProcess := process.Serialize()
+	currentState := stateMachine.UnsafeCurrent()
+
+	record := ProcessStateRecord{
+		Program:   config.Name,
+		ID:        serializedProcess.ID,
+		State:     currentState,
+		StartedAt: serializedProcess.StartedAt,
+
+		Fingerprint: processFingerprint(config),
+	}
+
+	switch currentState {
+	case ProcessStateStarting, ProcessStateRunning, ProcessStatePaused, ProcessStateStopping:
+		if cmd := process.GetCmd(); cmd != nil && cmd.Process != nil {
+			if stat, err := readProcStat(cmd.Process.Pid); err == nil && !stat.isZombie() {
+				record.Pid = stat.Pid
+				record.StartTime = stat.StartTime
+			}
+		}
+	}
+
+	if err := stateStore.Update(record); err != nil {
+		log.Printf("Could not persist state of process '%s' of program '%s': %v", record.ID, record.Program, err)
+	}
+
+	return machine.NoopEvent, nil
+}
+
 func ProcessResetStarttriesAction(stateMachine *machine.Machine, context machine.Context) (machine.EventType, error) {
 	processContext := context.(*ProcessMachineContext)
 	processContext.Starttries = 0
@@ -249,6 +424,7 @@ func PrintCurrentStateAction(stateMachine *machine.Machine, context machine.Cont
 		ProcessStateStopped:  "is stopped",
 		ProcessStateExited:   "has exited",
 		ProcessStateFatal:    "has fataly exited",
+		ProcessStatePaused:   "is paused",
 	}
 
 	config, err := process.GetConfig()
@@ -259,6 +435,12 @@ func PrintCurrentStateAction(stateMachine *machine.Machine, context machine.Cont
 	serializedProcess := process.Serialize()
 	currentState := stateMachine.UnsafeCurrent()
 
+	message := ""
+	if err := processContext.LastError; err != nil {
+		message = err.Error()
+	}
+	process.AppendHistory(currentState, message)
+
 	if err := processContext.LastError; err != nil {
 		log.Printf(
 			"Process '%s' of program '%s' %s (%s)\n",
@@ -12,6 +12,7 @@ const (
 	ProcessStateStopped  machine.StateType = "STOPPED"
 	ProcessStateExited   machine.StateType = "EXITED"
 	ProcessStateFatal    machine.StateType = "FATAL"
+	ProcessStatePaused   machine.StateType = "PAUSED"
 	ProcessStateUnknown  machine.StateType = "UNKNOWN"
 )
 
@@ -21,12 +22,17 @@ const (
 	ProcessEventStop    machine.EventType = "stop"
 	ProcessEventStopped machine.EventType = "stopped"
 	ProcessEventFatal   machine.EventType = "fatal"
+	ProcessEventPause   machine.EventType = "pause"
+	ProcessEventResume  machine.EventType = "resume"
 )
 
 type ProcessMachineContext struct {
 	Process    Processer
 	Starttries int
 	LastError  error
+
+	// Adoption is the process to adopt on next start, instead of starting a new one.
+	Adoption *ProcessStateRecord
 }
 
 func NewProcessMachine(process *Process) *machine.Machine {
@@ -42,6 +48,7 @@ func NewProcessMachine(process *Process) *machine.Machine {
 			ProcessStateStopped: machine.StateNode{
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
+					ProcessPersistStateAction,
 				},
 
 				On: machine.Events{
@@ -53,6 +60,7 @@ func NewProcessMachine(process *Process) *machine.Machine {
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
 					ProcessStartAction,
+					ProcessPersistStateAction,
 				},
 
 				On: machine.Events{
@@ -65,6 +73,7 @@ func NewProcessMachine(process *Process) *machine.Machine {
 			ProcessStateBackoff: machine.StateNode{
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
+					ProcessPersistStateAction,
 					ProcessBackoffAction,
 				},
 
@@ -77,18 +86,36 @@ func NewProcessMachine(process *Process) *machine.Machine {
 			ProcessStateRunning: machine.StateNode{
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
+					ProcessPersistStateAction,
+					ProcessResumeAction,
 					ProcessResetStarttriesAction,
 				},
 
 				On: machine.Events{
 					ProcessEventStop:    ProcessStateStopping,
 					ProcessEventStopped: ProcessStateExited,
+					ProcessEventPause:   ProcessStatePaused,
+				},
+			},
+
+			ProcessStatePaused: machine.StateNode{
+				Actions: []machine.Action{
+					PrintCurrentStateAction,
+					ProcessPersistStateAction,
+					ProcessPauseAction,
+				},
+
+				On: machine.Events{
+					ProcessEventResume:  ProcessStateRunning,
+					ProcessEventStop:    ProcessStateStopping,
+					ProcessEventStopped: ProcessStateExited,
 				},
 			},
 
 			ProcessStateStopping: machine.StateNode{
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
+					ProcessPersistStateAction,
 					ProcessStopAction,
 					ProcessResetStarttriesAction,
 				},
@@ -101,6 +128,7 @@ func NewProcessMachine(process *Process) *machine.Machine {
 			ProcessStateExited: machine.StateNode{
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
+					ProcessPersistStateAction,
 					ProcessExitedAction,
 				},
 
@@ -112,6 +140,7 @@ func NewProcessMachine(process *Process) *machine.Machine {
 			ProcessStateFatal: machine.StateNode{
 				Actions: []machine.Action{
 					PrintCurrentStateAction,
+					ProcessPersistStateAction,
 					ProcessResetStarttriesAction,
 				},
 
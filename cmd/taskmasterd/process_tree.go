@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+type ProcessGroupType string
+
+const (
+	ProcessGroupNone    ProcessGroupType = "none"
+	ProcessGroupGroup   ProcessGroupType = "group"
+	ProcessGroupSession ProcessGroupType = "session"
+)
+
+var ProcessGroupAvailable = [...]ProcessGroupType{
+	ProcessGroupNone,
+	ProcessGroupGroup,
+	ProcessGroupSession,
+}
+
+func (processGroup ProcessGroupType) Valid() bool {
+	for _, availableProcessGroup := range ProcessGroupAvailable {
+		if availableProcessGroup == processGroup {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProcessTree is the set of system processes a stop must reach:
+// the process itself and, depending on configuration, its process group
+// and every descendant found through /proc.
+type ProcessTree struct {
+	Pid  int
+	main ProcStat
+
+	// Group is true when the process leads its own process group.
+	Group bool
+
+	TrackDescendants bool
+	descendants      []ProcStat
+}
+
+func NewProcessTree(pid int, config ProgramConfiguration) *ProcessTree {
+	tree := &ProcessTree{
+		Pid:              pid,
+		Group:            config.Processgroup == ProcessGroupGroup || config.Processgroup == ProcessGroupSession,
+		TrackDescendants: config.Killdescendants,
+	}
+
+	if stat, err := readProcStat(pid); err == nil {
+		tree.main = stat
+	} else {
+		tree.main = ProcStat{Pid: pid}
+	}
+
+	tree.refresh()
+
+	return tree
+}
+
+// refresh records descendants that appeared since last call.
+// Descendants that have already been reparented can not be found anymore,
+// which is why the tree must be refreshed while the process is still alive.
+func (tree *ProcessTree) refresh() {
+	if !tree.TrackDescendants {
+		return
+	}
+
+	stats, err := listProcStats()
+	if err != nil {
+		return
+	}
+
+	type processIdentity struct {
+		Pid       int
+		StartTime uint64
+	}
+
+	current := make(map[int]ProcStat)
+	children := make(map[int][]ProcStat)
+	for _, stat := range stats {
+		current[stat.Pid] = stat
+		children[stat.Ppid] = append(children[stat.Ppid], stat)
+	}
+
+	known := make(map[processIdentity]bool)
+	parents := []int{tree.Pid}
+	for _, descendant := range tree.descendants {
+		known[processIdentity{descendant.Pid, descendant.StartTime}] = true
+
+		// A dead descendant's pid may have been reused by an unrelated process.
+		if stat, ok := current[descendant.Pid]; ok && stat.StartTime == descendant.StartTime {
+			parents = append(parents, descendant.Pid)
+		}
+	}
+
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+
+		for _, child := range children[parent] {
+			identity := processIdentity{child.Pid, child.StartTime}
+			if known[identity] {
+				continue
+			}
+
+			known[identity] = true
+			tree.descendants = append(tree.descendants, child)
+			parents = append(parents, child.Pid)
+		}
+	}
+}
+
+// isSameProcess protects against signaling a process whose pid has been reused.
+func isSameProcess(stat ProcStat) bool {
+	current, err := readProcStat(stat.Pid)
+	if err != nil {
+		return false
+	}
+
+	return current.StartTime == stat.StartTime && !current.isZombie()
+}
+
+// Signal sends the signal to every process of the tree.
+func (tree *ProcessTree) Signal(signal syscall.Signal) error {
+	tree.refresh()
+
+	var err error
+	if tree.Group {
+		err = syscall.Kill(-tree.Pid, signal)
+	} else if isSameProcess(tree.main) {
+		err = syscall.Kill(tree.Pid, signal)
+	}
+	if errors.Is(err, syscall.ESRCH) {
+		err = nil
+	}
+
+	for _, descendant := range tree.descendants {
+		if isSameProcess(descendant) {
+			syscall.Kill(descendant.Pid, signal)
+		}
+	}
+
+	return err
+}
+
+// Alive reports whether a process of the tree is still running.
+func (tree *ProcessTree) Alive() bool {
+	if tree.Group {
+		if err := syscall.Kill(-tree.Pid, 0); err == nil || errors.Is(err, syscall.EPERM) {
+			return true
+		}
+	} else if isSameProcess(tree.main) {
+		return true
+	}
+
+	for _, descendant := range tree.descendants {
+		if isSameProcess(descendant) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const procfileImportArg = "import-procfile"
+
+// procfileImportMain prints the configuration converted from a Procfile.
+func procfileImportMain(flags *flag.FlagSet, args []string) {
+	envPath := flags.String("e", "", "Environment file, .env beside the Procfile by default")
+	formation := flags.String("m", "", "Concurrency of process types, as web=2,worker=1")
+	format := flags.String("f", string(ConfigFormatYaml), "Output format: yaml, json or toml")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [-e .env] [-m formation] [-f format] <Procfile>\n", os.Args[0], procfileImportArg)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	concurrency, err := ParseProcfileConcurrency(*formation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	imported, err := ImportProcfileFile(flags.Arg(0), *envPath, concurrency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	configImportPrint(imported, ConfigFormat(*format))
+}
+
+var (
+	procfileLine     = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.*)$`)
+	procfileVariable = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+)
+
+// Characters only a shell gives a meaning to, as commands are not run by one.
+const procfileShellCharacters = "|&;<>()`*?~\\"
+
+// ParseProcfileConcurrency parses the formation of foreman, a comma-separated list
+// of type=count.
+func ParseProcfileConcurrency(formation string) (map[string]int, error) {
+	concurrency := make(map[string]int)
+
+	for _, pair := range strings.Split(formation, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		separator := strings.Index(pair, "=")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid concurrency %q, expected type=count", pair)
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(pair[separator+1:]))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid concurrency %q, expected type=count", pair)
+		}
+
+		concurrency[strings.TrimSpace(pair[:separator])] = count
+	}
+
+	return concurrency, nil
+}
+
+// ImportProcfileFile converts the Procfile at path into programs run from its
+// directory. The environment file is read when envPath is given, or when a .env
+// file lies beside the Procfile.
+func ImportProcfileFile(path, envPath string, concurrency map[string]int) (*ConfigImport, error) {
+	procfile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(absolutePath)
+
+	var env []byte
+	if envPath == "" {
+		envPath = filepath.Join(dir, ".env")
+
+		if env, err = ioutil.ReadFile(envPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else if env, err = ioutil.ReadFile(envPath); err != nil {
+		return nil, err
+	}
+
+	importer := &procfileImporter{
+		file:    path,
+		envFile: envPath,
+		dir:     dir,
+	}
+
+	return importer.convert(procfile, env, concurrency), nil
+}
+
+// ImportProcfileData converts a Procfile and an environment file given as a whole.
+// Programs are then run from the working directory of the daemon.
+func ImportProcfileData(procfile, env []byte, concurrency map[string]int) *ConfigImport {
+	importer := &procfileImporter{
+		file:    "<procfile>",
+		envFile: "<env>",
+	}
+
+	return importer.convert(procfile, env, concurrency)
+}
+
+type procfileImporter struct {
+	file     string
+	envFile  string
+	dir      string
+	warnings []ConfigImportWarning
+}
+
+func (importer *procfileImporter) warn(file string, line int, section string, format string, args ...interface{}) {
+	importer.warnings = append(importer.warnings, ConfigImportWarning{
+		File:    file,
+		Line:    line,
+		Section: section,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (importer *procfileImporter) convert(procfile, envData []byte, concurrency map[string]int) *ConfigImport {
+	programs := ProgramsYaml{
+		Programs: make(map[string]ProgramYaml),
+	}
+
+	env := importer.parseEnv(envData)
+
+	for index, line := range strings.Split(string(procfile), "\n") {
+		lineNumber := index + 1
+
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		match := procfileLine.FindStringSubmatch(line)
+		if match == nil {
+			importer.warn(importer.file, lineNumber, "", "line ignored, it is not a process type")
+			continue
+		}
+
+		name := match[1]
+		if _, ok := programs.Programs[name]; ok {
+			importer.warn(importer.file, lineNumber, name, "process type is defined several times, the last definition is kept")
+		}
+
+		programs.Programs[name] = importer.convertProgram(name, lineNumber, match[2], env, concurrency)
+	}
+
+	concurrencyNames := make([]string, 0, len(concurrency))
+	for name := range concurrency {
+		concurrencyNames = append(concurrencyNames, name)
+	}
+	sort.Strings(concurrencyNames)
+
+	for _, name := range concurrencyNames {
+		if _, ok := programs.Programs[name]; !ok {
+			importer.warn(importer.file, 0, name, "concurrency is given for an unknown process type")
+		}
+	}
+
+	return &ConfigImport{
+		Programs: programs,
+		Warnings: append(importer.warnings, configImportValidationWarnings(programs)...),
+	}
+}
+
+func (importer *procfileImporter) convertProgram(name string, line int, command string, env map[string]string, concurrency map[string]int) ProgramYaml {
+	var program ProgramYaml
+
+	// Variables of the environment file are known now, others are expanded by the
+	// daemon from its own environment, as the environment of programs is not used.
+	command = procfileVariable.ReplaceAllStringFunc(command, func(reference string) string {
+		match := procfileVariable.FindStringSubmatch(reference)
+		variable := match[1] + match[2]
+
+		if value, ok := env[variable]; ok {
+			return value
+		}
+
+		importer.warn(importer.file, line, name, "$%s is expanded from the environment of taskmasterd", variable)
+		return reference
+	})
+
+	if procfileNeedsShell(command) {
+		command = "/bin/sh -c '" + strings.Replace(command, "'", `'"'"'`, -1) + "'"
+
+		// Signals must reach the processes the shell started.
+		processGroup := ProcessGroupGroup
+		program.Processgroup = &processGroup
+	}
+	program.Cmd = &command
+
+	if importer.dir != "" {
+		dir := importer.dir
+		program.Workingdir = &dir
+	}
+
+	if len(env) > 0 {
+		program.Env = EnvYamlFromValues(env)
+	}
+
+	if count, ok := concurrency[name]; ok {
+		if count == 0 {
+			autostart := false
+			program.Autostart = &autostart
+		} else {
+			program.Numprocs = &count
+		}
+	}
+
+	return program
+}
+
+// procfileNeedsShell tells whether the command relies on a shell, for instance
+// for pipes, redirections or variables assigned before it.
+func procfileNeedsShell(command string) bool {
+	if strings.ContainsAny(command, procfileShellCharacters) {
+		return true
+	}
+
+	fields := strings.Fields(command)
+	return len(fields) > 0 && strings.Contains(fields[0], "=")
+}
+
+func (importer *procfileImporter) parseEnv(data []byte) map[string]string {
+	env, errs := dotenvParse(data)
+
+	for _, err := range errs {
+		importer.warn(importer.envFile, err.Line, "", "line ignored, it is not a variable")
+	}
+
+	return env
+}
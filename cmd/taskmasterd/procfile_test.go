@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportProcfileData(t *testing.T) {
+	procfile := `# processes
+web: bundle exec puma -p $PORT
+worker: /bin/worker --queue "$QUEUE" 2>&1 | logger
+clock: /bin/clock $INTERVAL
+not a process type
+`
+	env := `# development
+export PORT=5000
+QUEUE="default jobs"
+INTERVAL='60'
+broken line
+`
+
+	imported := ImportProcfileData([]byte(procfile), []byte(env), map[string]int{
+		"web":    2,
+		"clock":  0,
+		"mailer": 1,
+	})
+
+	processGroup := ProcessGroupGroup
+	expectedEnv := map[string]string{
+		"PORT":     "5000",
+		"QUEUE":    "default jobs",
+		"INTERVAL": "60",
+	}
+	expected := map[string]ProgramYaml{
+		"web": {
+			Cmd:      strToPointer("bundle exec puma -p 5000"),
+			Numprocs: intToPointer(2),
+			Env:      EnvYamlFromValues(expectedEnv),
+		},
+		"worker": {
+			Cmd:          strToPointer(`/bin/sh -c '/bin/worker --queue "default jobs" 2>&1 | logger'`),
+			Processgroup: &processGroup,
+			Env:          EnvYamlFromValues(expectedEnv),
+		},
+		"clock": {
+			Cmd:       strToPointer("/bin/clock 60"),
+			Autostart: boolToPointer(false),
+			Env:       EnvYamlFromValues(expectedEnv),
+		},
+	}
+
+	if !reflect.DeepEqual(imported.Programs.Programs, expected) {
+		t.Errorf("Imported programs are %+v; expected %+v", imported.Programs.Programs, expected)
+	}
+
+	warned := make(map[string]bool)
+	for _, warning := range imported.Warnings {
+		warned[warning.File+" "+warning.Section] = true
+	}
+	for _, expectedWarning := range []string{
+		"<procfile> ",
+		"<env> ",
+		"<procfile> mailer",
+	} {
+		if !warned[expectedWarning] {
+			t.Errorf("Missing warning about %q in %v", expectedWarning, imported.Warnings)
+		}
+	}
+	if len(imported.Warnings) != 3 {
+		t.Errorf("Unexpected warnings: %v", imported.Warnings)
+	}
+}
+
+func TestImportProcfileWarnsAboutUnknownVariables(t *testing.T) {
+	imported := ImportProcfileData([]byte("web: /bin/web --port ${PORT}\n"), nil, nil)
+
+	if cmd := *imported.Programs.Programs["web"].Cmd; cmd != "/bin/web --port ${PORT}" {
+		t.Errorf("Command is %q; expected the variable to be kept", cmd)
+	}
+	if len(imported.Warnings) != 1 || imported.Warnings[0].Section != "web" {
+		t.Errorf("Unexpected warnings: %v", imported.Warnings)
+	}
+}
+
+func TestParseProcfileConcurrency(t *testing.T) {
+	concurrency, err := ParseProcfileConcurrency("web=2, worker=0")
+	if err != nil {
+		t.Fatalf("Could not parse concurrency: %v", err)
+	}
+
+	expected := map[string]int{
+		"web":    2,
+		"worker": 0,
+	}
+	if !reflect.DeepEqual(concurrency, expected) {
+		t.Errorf("Concurrency is %v; expected %v", concurrency, expected)
+	}
+
+	for _, formation := range []string{"web", "web=-1", "=2", "web=many"} {
+		if _, err := ParseProcfileConcurrency(formation); err == nil {
+			t.Errorf("Concurrency %q should be rejected", formation)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const procfsPath = "/proc"
+
+var ErrProcStatMalformed = errors.New("malformed /proc stat file")
+
+// ProcStat holds the fields of /proc/[pid]/stat taskmasterd cares about.
+type ProcStat struct {
+	Pid     int
+	State   byte
+	Ppid    int
+	Pgrp    int
+	Session int
+
+	// StartTime is expressed in clock ticks after system boot.
+	// Along with the pid, it identifies a process without ambiguity.
+	StartTime uint64
+}
+
+func parseProcStat(content string) (ProcStat, error) {
+	// The command name is enclosed in parenthesis and can contain spaces and parenthesis,
+	// so we look for the last closing one.
+	commEnd := strings.LastIndexByte(content, ')')
+	commStart := strings.IndexByte(content, '(')
+	if commStart < 0 || commEnd < 0 || commEnd < commStart {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(content[:commStart]))
+	if err != nil {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+
+	// Fields start at index 3 (state) in proc(5).
+	fields := strings.Fields(content[commEnd+1:])
+	if len(fields) < 20 {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+	pgrp, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+	session, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return ProcStat{}, ErrProcStatMalformed
+	}
+
+	return ProcStat{
+		Pid:       pid,
+		State:     fields[0][0],
+		Ppid:      ppid,
+		Pgrp:      pgrp,
+		Session:   session,
+		StartTime: startTime,
+	}, nil
+}
+
+func readProcStat(pid int) (ProcStat, error) {
+	content, err := ioutil.ReadFile(procfsPath + "/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return ProcStat{}, err
+	}
+
+	return parseProcStat(string(content))
+}
+
+// listProcStats returns the stat of every process visible in /proc.
+// Processes vanishing while listing are silently ignored.
+func listProcStats() ([]ProcStat, error) {
+	dir, err := os.Open(procfsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]ProcStat, 0, len(names))
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		stat, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// isZombie reports whether the process has exited but has not been reaped yet.
+func (stat ProcStat) isZombie() bool {
+	return stat.State == 'Z'
+}
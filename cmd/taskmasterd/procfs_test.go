@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseProcStatWithParenthesisInCommandName(t *testing.T) {
+	const content = "4242 (my (weird) cmd) S 1 4242 4242 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 987654 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0\n"
+
+	stat, err := parseProcStat(content)
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	expected := ProcStat{
+		Pid:       4242,
+		State:     'S',
+		Ppid:      1,
+		Pgrp:      4242,
+		Session:   4242,
+		StartTime: 987654,
+	}
+	if stat != expected {
+		t.Fatalf("parsed stat is incorrect %+v; expected %+v", stat, expected)
+	}
+}
+
+func TestParseProcStatRejectsMalformedContent(t *testing.T) {
+	if _, err := parseProcStat("4242 (cmd) S 1"); err != ErrProcStatMalformed {
+		t.Fatalf("unexpected error returned %v; expected %v", err, ErrProcStatMalformed)
+	}
+}
+
+func TestReadProcStatOfCurrentProcess(t *testing.T) {
+	stat, err := readProcStat(os.Getpid())
+	if err != nil {
+		t.Skipf("procfs is not available: %v", err)
+	}
+
+	if stat.Pid != os.Getpid() || stat.Ppid != os.Getppid() {
+		t.Fatalf(
+			"read stat is incorrect (pid %d, ppid %d); expected (pid %d, ppid %d)",
+			stat.Pid,
+			stat.Ppid,
+			os.Getpid(),
+			os.Getppid(),
+		)
+	}
+}
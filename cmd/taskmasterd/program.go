@@ -8,6 +8,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 type ErrProcessNotFound struct {
@@ -29,8 +31,18 @@ type Program struct {
 	LocalContext       context.Context
 	CancelLocalContext context.CancelFunc
 
-	processes     map[string]Processer
-	configuration ProgramConfiguration
+	name      string
+	processes map[string]Processer
+
+	// Each process runs with a configuration generation, which differs from the
+	// current one only for the process a canary is tried on.
+	generations        map[int]ProgramConfiguration
+	currentGeneration  int
+	lastGeneration     int
+	processGenerations map[string]int
+
+	cancelRollingRestart context.CancelFunc
+	canary               *ProgramCanary
 
 	Valid bool
 }
@@ -45,6 +57,7 @@ const (
 	ProgramStateStopped  ProgramState = "STOPPED"
 	ProgramStateExited   ProgramState = "EXITED"
 	ProgramStateFatal    ProgramState = "FATAL"
+	ProgramStatePaused   ProgramState = "PAUSED"
 	ProgramStateUnknown  ProgramState = "UNKNOWN"
 )
 
@@ -64,21 +77,46 @@ func NewProgram(args NewProgramArgs) Program {
 		LocalContext:       localContext,
 		CancelLocalContext: localCancel,
 
-		processes:     make(map[string]Processer),
-		configuration: args.Configuration,
+		name:      args.Configuration.Name,
+		processes: make(map[string]Processer),
+
+		generations:        make(map[int]ProgramConfiguration),
+		processGenerations: make(map[string]int),
 
 		Valid: true,
 	}
+	program.currentGeneration = program.addGeneration(args.Configuration)
+
+	config := program.configuration()
+	fingerprint := processFingerprint(config)
 
-	for index := 1; index <= program.configuration.Numprocs; index++ {
-		id := createProcessName(program.configuration.Name, index)
+	for index := 1; index <= args.Configuration.Numprocs; index++ {
+		id := createProcessName(program.name, index)
 
-		process := NewProcess(NewProcessArgs{
+		args := NewProcessArgs{
 			ID:              id,
 			Context:         localContext,
 			ProgramTaskChan: program.ProcessTaskChan,
-		})
+		}
+		if adoption, ok := stateStore.TakeAdoption(program.name, id); ok {
+			if adoption.Fingerprint == "" || adoption.Fingerprint == fingerprint {
+				args.Adoption = &adoption
+			} else {
+				log.Printf("Process '%s' of program '%s' with PID %d runs another configuration, stopping it", id, program.name, adoption.Pid)
+
+				stopStep := config.StopSteps()[0]
+				terminateForeignProcess(adoption, stopStep.Signal.ToOsSignal().(syscall.Signal), time.Duration(config.Stoptime)*time.Second)
+			}
+		}
+
+		process := NewProcess(args)
 		program.processes[id] = process
+		program.processGenerations[id] = program.currentGeneration
+
+		// Adopted processes are running, whether the program is autostarted or not.
+		if args.Adoption != nil {
+			process.Start()
+		}
 	}
 
 	go program.Monitor()
@@ -86,10 +124,74 @@ func NewProgram(args NewProgramArgs) Program {
 	return program
 }
 
+// programShouldStart tells whether a program must be started once loaded.
+// The intent of an operator prevails over autostart.
+func programShouldStart(config ProgramConfiguration) bool {
+	if override, ok := stateStore.Override(config.Name); ok {
+		return override.Intent == ProgramIntentStarted
+	}
+
+	return config.Autostart
+}
+
+// programRestartIsPrevented tells whether restarting a program would start processes
+// an operator stopped. The new configuration is used on next start anyway.
+func programRestartIsPrevented(programName string) bool {
+	override, ok := stateStore.Override(programName)
+
+	return ok && override.Intent == ProgramIntentStopped
+}
+
+// configuration returns the current configuration of the program.
+func (program *Program) configuration() ProgramConfiguration {
+	return program.generations[program.currentGeneration]
+}
+
+// processConfiguration returns the configuration a process runs with.
+func (program *Program) processConfiguration(processID string) ProgramConfiguration {
+	generation, ok := program.processGenerations[processID]
+	if !ok {
+		return program.configuration()
+	}
+
+	return program.generations[generation]
+}
+
+func (program *Program) addGeneration(config ProgramConfiguration) int {
+	program.lastGeneration++
+	program.generations[program.lastGeneration] = config
+
+	sensitiveValues.Add(config.SensitiveValues()...)
+
+	return program.lastGeneration
+}
+
+// pruneGenerations forgets the configurations no process runs with anymore.
+func (program *Program) pruneGenerations() {
+	used := map[int]bool{
+		program.currentGeneration: true,
+	}
+	for _, generation := range program.processGenerations {
+		used[generation] = true
+	}
+
+	for generation := range program.generations {
+		if !used[generation] {
+			delete(program.generations, generation)
+		}
+	}
+}
+
 func createProcessName(programName string, id int) string {
 	return strings.ReplaceAll(programName, " ", "-") + "_" + strconv.Itoa(id)
 }
 
+// processNumFromID gives back the number a process ID was created from.
+func processNumFromID(processID string) int {
+	processNum, _ := strconv.Atoi(processID[strings.LastIndex(processID, "_")+1:])
+	return processNum
+}
+
 func (program *Program) getProcessByID(id string) (Processer, error) {
 	process, ok := program.processes[id]
 	if !ok {
@@ -136,6 +238,8 @@ func (program *Program) stopSingleProcess(task Tasker) error {
 		return err
 	}
 
+	program.stopRollingRestart()
+
 	process.Stop()
 	return nil
 }
@@ -150,6 +254,26 @@ func (program *Program) restartSingleProcess(task Tasker) error {
 	return nil
 }
 
+func (program *Program) pauseSingleProcess(task Tasker) error {
+	process, err := program.getProcessFromTasker(task)
+	if err != nil {
+		return err
+	}
+
+	process.Pause()
+	return nil
+}
+
+func (program *Program) resumeSingleProcess(task Tasker) error {
+	process, err := program.getProcessFromTasker(task)
+	if err != nil {
+		return err
+	}
+
+	process.Resume()
+	return nil
+}
+
 func (program *Program) killSingleProcess(task Tasker) error {
 	process, err := program.getProcessFromTasker(task)
 	if err != nil {
@@ -161,7 +285,7 @@ func (program *Program) killSingleProcess(task Tasker) error {
 }
 
 func (program *Program) startAllProcesses(task Tasker) error {
-	log.Printf("Starting program '%s' with %d process(es)...", program.configuration.Name, program.configuration.Numprocs)
+	log.Printf("Starting program '%s' with %d process(es)...", program.name, program.configuration().Numprocs)
 	for _, process := range program.processes {
 		process.Start()
 	}
@@ -169,20 +293,37 @@ func (program *Program) startAllProcesses(task Tasker) error {
 }
 
 func (program *Program) stopAllProcesses(task Tasker) error {
-	log.Printf("Stopping program '%s' with %d process(es)...", program.configuration.Name, program.configuration.Numprocs)
+	log.Printf("Stopping program '%s' with %d process(es)...", program.name, program.configuration().Numprocs)
+	program.stopRollingRestart()
 	for _, process := range program.processes {
 		process.Stop()
 	}
+	program.terminateOrphans()
 	return nil
 }
 
+func (program *Program) terminateOrphans() {
+	if !program.configuration().Killorphans {
+		return
+	}
+
+	childrenRegistry.TerminateOrphans(
+		program.name,
+		program.configuration().Stopsignal.ToOsSignal().(syscall.Signal),
+		time.Duration(program.configuration().Stoptime)*time.Second,
+	)
+}
+
 func (program *Program) stopAllProcessesAndWait(task Tasker) error {
+	program.stopRollingRestart()
+
 	go func() {
 		programTaskWithResponse := task.(ProgramTaskRootActionWithResponse)
 
 		for _, process := range program.processes {
 			process.Stop()
 		}
+		program.terminateOrphans()
 
 		for _, process := range program.processes {
 			process.Wait()
@@ -195,42 +336,96 @@ func (program *Program) stopAllProcessesAndWait(task Tasker) error {
 	return nil
 }
 
+func (program *Program) pauseAllProcesses(task Tasker) error {
+	log.Printf("Pausing program '%s' with %d process(es)...", program.name, program.configuration().Numprocs)
+	for _, process := range program.processes {
+		process.Pause()
+	}
+	return nil
+}
+
+func (program *Program) resumeAllProcesses(task Tasker) error {
+	log.Printf("Resuming program '%s' with %d process(es)...", program.name, program.configuration().Numprocs)
+	for _, process := range program.processes {
+		process.Resume()
+	}
+	return nil
+}
+
 func (program *Program) restartAllProcesses(task Tasker) error {
 	log.Printf(
 		"Restarting program '%s' with %d process(es)...",
-		program.configuration.Name,
-		program.configuration.Numprocs,
+		program.name,
+		program.configuration().Numprocs,
 	)
-	for _, process := range program.processes {
-		process.Restart()
-	}
+	program.restartProcesses(program.sortedProcesses())
 	return nil
 }
 
+// sortedProcesses returns the processes of the program by index,
+// leaving aside those being removed.
+func (program *Program) sortedProcesses() []Processer {
+	processes := make([]Processer, 0, program.configuration().Numprocs)
+	for index := 1; index <= program.configuration().Numprocs; index++ {
+		if process, err := program.getProcessByID(createProcessName(program.name, index)); err == nil {
+			processes = append(processes, process)
+		}
+	}
+
+	return processes
+}
+
 func (program *Program) setConfig(task Tasker) error {
 	programTaskWithPayload := task.(ProgramTaskRootActionWithPayload)
 
 	newConfig := programTaskWithPayload.Payload.(ProgramConfiguration)
 
-	restartProcesses := false
-	if newConfig.Cmd != program.configuration.Cmd ||
-		!reflect.DeepEqual(newConfig.Env, program.configuration.Env) ||
-		newConfig.Umask != program.configuration.Umask ||
-		newConfig.Stdout != program.configuration.Stdout ||
-		newConfig.Stderr != program.configuration.Stderr ||
-		newConfig.Workingdir != program.configuration.Workingdir {
-		restartProcesses = true
+	if program.canary != nil {
+		// Reloading an unchanged configuration file must not disturb the canary.
+		if reflect.DeepEqual(newConfig, program.configuration()) {
+			return nil
+		}
+		program.abortCanary()
 	}
 
-	program.configuration = newConfig
+	return program.applyGeneration(program.addGeneration(newConfig))
+}
+
+// switchProcessGeneration moves a process to a configuration generation, and tells
+// whether it must be restarted to run with it.
+func (program *Program) switchProcessGeneration(processID string, generation int) bool {
+	restartFields := restartTriggeringFields(program.processConfiguration(processID), program.generations[generation])
+	program.processGenerations[processID] = generation
+
+	return len(restartFields) > 0
+}
+
+// applyGeneration makes a configuration generation the current one and moves every
+// process to it, restarting those whose configuration changed in a way requiring it.
+func (program *Program) applyGeneration(generation int) error {
+	newConfig := program.generations[generation]
+
+	restartFields := restartTriggeringFields(program.configuration(), newConfig)
+	restartIsPrevented := programRestartIsPrevented(newConfig.Name)
+	if len(restartFields) > 0 && !restartIsPrevented {
+		log.Printf("Program '%s' must be restarted, because of changes in: %s", newConfig.Name, strings.Join(restartFields, ", "))
+	}
+
+	program.currentGeneration = generation
+	defer program.pruneGenerations()
+
+	processesToRestart := []Processer{}
 
 	oldNumProcess := len(program.processes)
 	newNumProcesses := newConfig.Numprocs
 	delta := newNumProcesses - oldNumProcess
 
 	if delta < 0 {
+		// A rolling restart must not start processes being removed.
+		program.stopRollingRestart()
+
 		for index := 1; index <= oldNumProcess; index++ {
-			processID := createProcessName(program.configuration.Name, index)
+			processID := createProcessName(program.name, index)
 
 			process, err := program.getProcessByID(processID)
 			if err != nil {
@@ -252,14 +447,14 @@ func (program *Program) setConfig(task Tasker) error {
 				}()
 
 				process.Stop()
-			} else if restartProcesses {
-				process.Restart()
+			} else if program.switchProcessGeneration(processID, generation) && !restartIsPrevented {
+				processesToRestart = append(processesToRestart, process)
 			}
 		}
-	} else if delta > 0 {
+	} else {
 		for index := 1; index <= newNumProcesses; index++ {
 			if index > oldNumProcess {
-				processID := createProcessName(program.configuration.Name, index)
+				processID := createProcessName(program.name, index)
 
 				process := NewProcess(NewProcessArgs{
 					ID:              processID,
@@ -267,23 +462,28 @@ func (program *Program) setConfig(task Tasker) error {
 					ProgramTaskChan: program.ProcessTaskChan,
 				})
 				program.processes[processID] = process
+				program.processGenerations[processID] = generation
 
-				if program.configuration.Autostart {
+				if programShouldStart(newConfig) {
 					process.Start()
 				}
-			} else if restartProcesses {
-				processID := createProcessName(program.configuration.Name, index)
+			} else {
+				processID := createProcessName(program.name, index)
 
 				process, err := program.getProcessByID(processID)
 				if err != nil {
 					return err
 				}
 
-				process.Restart()
+				if program.switchProcessGeneration(processID, generation) && !restartIsPrevented {
+					processesToRestart = append(processesToRestart, process)
+				}
 			}
 		}
-	} else if restartProcesses {
-		program.restartAllProcesses(nil)
+	}
+
+	if len(processesToRestart) > 0 {
+		program.restartProcesses(processesToRestart)
 	}
 
 	return nil
@@ -293,18 +493,29 @@ func (program *Program) removeSingleProcess(task Tasker) error {
 	processTask := task.(ProcessTask)
 
 	delete(program.processes, processTask.ProcessID)
+	delete(program.processGenerations, processTask.ProcessID)
+	program.pruneGenerations()
 	return nil
 }
 
 func (program *Program) getConfig(task Tasker) error {
 	programTaskWithResponse := task.(ProgramTaskRootActionWithResponse)
 
-	config := program.configuration
+	config := program.configuration()
 	programTaskWithResponse.ResponseChan <- config
 
 	return nil
 }
 
+func (program *Program) getProcessConfig(task Tasker) error {
+	processTaskWithResponse := task.(ProcessTaskWithResponse)
+
+	config := program.processConfiguration(processTaskWithResponse.ProcessID)
+	processTaskWithResponse.ResponseChan <- config
+
+	return nil
+}
+
 func (program *Program) Monitor() {
 	var handlers = map[TaskAction]func(*Program, Tasker) error{
 		ProgramTaskActionGetAll: (*Program).getProcesses,
@@ -319,12 +530,24 @@ func (program *Program) Monitor() {
 		ProgramTaskActionRestart:    (*Program).restartSingleProcess,
 		ProgramTaskActionRestartAll: (*Program).restartAllProcesses,
 
+		ProgramTaskActionPause:    (*Program).pauseSingleProcess,
+		ProgramTaskActionPauseAll: (*Program).pauseAllProcesses,
+
+		ProgramTaskActionResume:    (*Program).resumeSingleProcess,
+		ProgramTaskActionResumeAll: (*Program).resumeAllProcesses,
+
 		ProgramTaskActionKill: (*Program).killSingleProcess,
 
 		ProgramTaskActionRemove: (*Program).removeSingleProcess,
 
 		ProgramTaskActionSetConfig: (*Program).setConfig,
 		ProgramTaskActionGetConfig: (*Program).getConfig,
+
+		ProgramTaskActionGetProcessConfig: (*Program).getProcessConfig,
+
+		ProgramTaskActionCanary:    (*Program).startCanary,
+		ProgramTaskActionEndCanary: (*Program).endCanary,
+		ProgramTaskActionGetCanary: (*Program).getCanary,
 	}
 
 	for {
@@ -392,6 +615,28 @@ func (program *Program) Restart() {
 	}
 }
 
+func (program *Program) Pause() {
+	select {
+	case program.ProcessTaskChan <- ProgramTaskRootAction{
+		TaskBase: TaskBase{
+			Action: ProgramTaskActionPauseAll,
+		},
+	}:
+	case <-program.GlobalContext.Done():
+	}
+}
+
+func (program *Program) Resume() {
+	select {
+	case program.ProcessTaskChan <- ProgramTaskRootAction{
+		TaskBase: TaskBase{
+			Action: ProgramTaskActionResumeAll,
+		},
+	}:
+	case <-program.GlobalContext.Done():
+	}
+}
+
 func (program *Program) GetProcesses() (map[string]Processer, error) {
 	responseChan := make(chan interface{})
 
@@ -470,6 +715,7 @@ func GetProgramState(processes []Processer) ProgramState {
 	stopped := 0
 	exited := 0
 	fatal := 0
+	paused := 0
 	unknown := 0
 
 	for _, process := range processes {
@@ -488,6 +734,8 @@ func GetProgramState(processes []Processer) ProgramState {
 			exited++
 		case ProcessStateFatal:
 			fatal++
+		case ProcessStatePaused:
+			paused++
 		default:
 			unknown++
 		}
@@ -508,6 +756,9 @@ func GetProgramState(processes []Processer) ProgramState {
 	if backoff > 0 {
 		return ProgramStateBackoff
 	}
+	if paused > 0 {
+		return ProgramStatePaused
+	}
 	if stopped == len(processes) {
 		return ProgramStateStopped
 	}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces sensitive values in responses of the API and in logs.
+const RedactedValue = "[REDACTED]"
+
+// Values shorter than this are not redacted from free text, where they would
+// mask unrelated words and numbers.
+const redactMinLength = 4
+
+// DefaultSensitiveEnvPatterns are used when the configuration does not give any.
+var DefaultSensitiveEnvPatterns = []string{
+	"*_TOKEN",
+	"*_PASSWORD",
+	"*_SECRET",
+}
+
+var ValidationIssueRedactedValue = errors.New("value is redacted, the actual one must be given")
+
+// SensitiveEnvNames gives the variables of env whose values are sensitive: the
+// ones listed in sensitive_env, and the ones matching a pattern.
+func (program *ProgramYaml) SensitiveEnvNames(patterns []string) []string {
+	if patterns == nil {
+		patterns = DefaultSensitiveEnvPatterns
+	}
+
+	sensitive := make(map[string]bool)
+	for _, name := range program.SensitiveEnv {
+		sensitive[name] = true
+	}
+	for name := range program.Env {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				sensitive[name] = true
+				break
+			}
+		}
+	}
+
+	if len(sensitive) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(sensitive))
+	for name := range sensitive {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Redacted returns a copy of the configuration whose sensitive values are masked.
+func (config ProgramConfiguration) Redacted() ProgramConfiguration {
+	if len(config.SensitiveEnv) == 0 {
+		return config
+	}
+
+	env := make(map[string]string, len(config.Env))
+	for name, value := range config.Env {
+		env[name] = value
+	}
+	for _, name := range config.SensitiveEnv {
+		if _, ok := env[name]; ok {
+			env[name] = RedactedValue
+		}
+	}
+	config.Env = env
+
+	return config
+}
+
+// SensitiveValues gives the values of the sensitive variables of env.
+func (config ProgramConfiguration) SensitiveValues() []string {
+	values := make([]string, 0, len(config.SensitiveEnv))
+	for _, name := range config.SensitiveEnv {
+		if value, ok := config.Env[name]; ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Redacted returns a copy of the configuration whose sensitive values are masked.
+// Secret references are kept, as they do not hold any value.
+func (programs ProgramsYaml) Redacted() ProgramsYaml {
+	redactedPrograms := make(map[string]ProgramYaml, len(programs.Programs))
+
+	for programName, program := range programs.Programs {
+		sensitiveNames := program.SensitiveEnvNames(programs.SensitiveEnvPatterns)
+
+		if len(sensitiveNames) > 0 {
+			env := make(map[string]EnvValueYaml, len(program.Env))
+			for name, value := range program.Env {
+				env[name] = value
+			}
+			for _, name := range sensitiveNames {
+				if value, ok := env[name]; ok && value.Reference == nil {
+					env[name] = EnvValueYaml{
+						Value: RedactedValue,
+					}
+				}
+			}
+			program.Env = env
+		}
+
+		redactedPrograms[programName] = program
+	}
+
+	programs.Programs = redactedPrograms
+
+	return programs
+}
+
+// SensitiveValues gives the values of the sensitive variables of every program.
+func (programs ProgramsYaml) SensitiveValues() []string {
+	var values []string
+
+	for _, program := range programs.Programs {
+		for _, name := range program.SensitiveEnvNames(programs.SensitiveEnvPatterns) {
+			if value, ok := program.Env[name]; ok && value.Reference == nil {
+				values = append(values, value.Value)
+			}
+		}
+	}
+
+	return values
+}
+
+// Redactor masks known sensitive values in free text, such as logs and diffs.
+// Values are never forgotten, so that logs written before a configuration
+// changed remain redacted.
+type Redactor struct {
+	mutex    sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// sensitiveValues holds the sensitive values of every configuration the daemon
+// loaded, and the secrets processes were started with.
+var sensitiveValues = NewRedactor()
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		values: make(map[string]bool),
+	}
+}
+
+func (redactor *Redactor) Add(values ...string) {
+	redactor.mutex.Lock()
+	defer redactor.mutex.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) < redactMinLength || redactor.values[value] {
+			continue
+		}
+		redactor.values[value] = true
+		added = true
+	}
+	if !added {
+		return
+	}
+
+	// Longer values come first, so that values containing others are masked whole.
+	sortedValues := make([]string, 0, len(redactor.values))
+	for value := range redactor.values {
+		sortedValues = append(sortedValues, value)
+	}
+	sort.Slice(sortedValues, func(i, j int) bool {
+		if len(sortedValues[i]) != len(sortedValues[j]) {
+			return len(sortedValues[i]) > len(sortedValues[j])
+		}
+		return sortedValues[i] < sortedValues[j]
+	})
+
+	replacements := make([]string, 0, 2*len(sortedValues))
+	for _, value := range sortedValues {
+		replacements = append(replacements, value, RedactedValue)
+	}
+	redactor.replacer = strings.NewReplacer(replacements...)
+}
+
+func (redactor *Redactor) Redact(text string) string {
+	redactor.mutex.RLock()
+	defer redactor.mutex.RUnlock()
+
+	if redactor.replacer == nil {
+		return text
+	}
+	return redactor.replacer.Replace(text)
+}
+
+// Writer redacts what is written before passing it to writer. Values split across
+// several writes are not masked, which is fine for loggers writing whole lines.
+func (redactor *Redactor) Writer(writer io.Writer) io.Writer {
+	return &redactedWriter{
+		redactor: redactor,
+		writer:   writer,
+	}
+}
+
+type redactedWriter struct {
+	redactor *Redactor
+	writer   io.Writer
+}
+
+func (writer *redactedWriter) Write(data []byte) (int, error) {
+	if _, err := io.WriteString(writer.writer, writer.redactor.Redact(string(data))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSensitiveEnvMatchesPatternsAndExplicitNames(t *testing.T) {
+	cmd := "ls"
+	program := ProgramYaml{
+		Cmd: &cmd,
+		Env: EnvYamlFromValues(map[string]string{
+			"API_TOKEN":   "token-value",
+			"DB_PASSWORD": "password-value",
+			"DSN":         "postgres://user:pass@db",
+			"LANG":        "C",
+		}),
+		SensitiveEnv: []string{"DSN"},
+	}
+
+	config, err := program.Validate(ProgramYamlValidateArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"API_TOKEN", "DB_PASSWORD", "DSN"}
+	if !reflect.DeepEqual(config.SensitiveEnv, expected) {
+		t.Errorf("Sensitive variables are %v; expected %v", config.SensitiveEnv, expected)
+	}
+
+	redacted := config.Redacted()
+	for _, name := range expected {
+		if redacted.Env[name] != RedactedValue {
+			t.Errorf("%s is %q once redacted", name, redacted.Env[name])
+		}
+	}
+	if redacted.Env["LANG"] != "C" {
+		t.Errorf("LANG is %q once redacted", redacted.Env["LANG"])
+	}
+	if config.Env["API_TOKEN"] != "token-value" {
+		t.Error("Redacting modified the configuration")
+	}
+
+	// Patterns of the configuration replace the default ones.
+	config, err = program.Validate(ProgramYamlValidateArgs{
+		SensitiveEnvPatterns: []string{"LA*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"DSN", "LANG"}
+	if !reflect.DeepEqual(config.SensitiveEnv, expected) {
+		t.Errorf("Sensitive variables are %v; expected %v", config.SensitiveEnv, expected)
+	}
+}
+
+func TestRedactedValuesAreRejected(t *testing.T) {
+	cmd := "ls"
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd: &cmd,
+				Env: EnvYamlFromValues(map[string]string{
+					"API_TOKEN": RedactedValue,
+				}),
+				SensitiveEnv: []string{"1INVALID"},
+			},
+		},
+		SensitiveEnvPatterns: []string{"*-TOKEN"},
+	}
+
+	_, err := programs.Validate()
+
+	var errs *ErrProgramsYamlValidations
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	expected := map[string]error{
+		"SensitiveEnvPatterns":         ValidationIssueUnexpectedValue,
+		"Programs[web].Env[API_TOKEN]": ValidationIssueRedactedValue,
+		"Programs[web].SensitiveEnv":   ValidationIssueUnexpectedValue,
+	}
+	if len(errs.Errors) != len(expected) {
+		t.Fatalf("Got errors %v; expected %v", errs, expected)
+	}
+	for _, validationErr := range errs.Errors {
+		if expected[validationErr.Field] != validationErr.Issue {
+			t.Errorf("Unexpected error %v", validationErr)
+		}
+	}
+}
+
+func TestProgramsYamlRedactedKeepsSecretReferences(t *testing.T) {
+	cmd := "ls"
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd: &cmd,
+				Env: map[string]EnvValueYaml{
+					"API_TOKEN": {
+						Value: "token-value",
+					},
+					"DB_PASSWORD": {
+						Reference: &SecretReference{
+							Secret: "db",
+						},
+					},
+					"PORT": {
+						Value: "8080",
+					},
+				},
+			},
+		},
+	}
+
+	redacted := programs.Redacted()
+
+	env := redacted.Programs["web"].Env
+	if env["API_TOKEN"].Value != RedactedValue {
+		t.Errorf("API_TOKEN is %q once redacted", env["API_TOKEN"].Value)
+	}
+	if env["DB_PASSWORD"].Reference == nil || env["DB_PASSWORD"].Reference.Secret != "db" {
+		t.Errorf("DB_PASSWORD reference was lost: %+v", env["DB_PASSWORD"])
+	}
+	if env["PORT"].Value != "8080" {
+		t.Errorf("PORT is %q once redacted", env["PORT"].Value)
+	}
+	if programs.Programs["web"].Env["API_TOKEN"].Value != "token-value" {
+		t.Error("Redacting modified the configuration")
+	}
+
+	if values := programs.SensitiveValues(); !reflect.DeepEqual(values, []string{"token-value"}) {
+		t.Errorf("Sensitive values are %v", values)
+	}
+}
+
+func TestRedactorMasksKnownValues(t *testing.T) {
+	redactor := NewRedactor()
+	redactor.Add("abc", "secret", "secret-longer")
+
+	var buffer bytes.Buffer
+	writer := redactor.Writer(&buffer)
+
+	if _, err := writer.Write([]byte("abc secret secret-longer\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Short values would mask unrelated words.
+	expected := "abc " + RedactedValue + " " + RedactedValue + "\n"
+	if buffer.String() != expected {
+		t.Errorf("Wrote %q; expected %q", buffer.String(), expected)
+	}
+}
+
+func TestUnredactedRequiresUnixSocket(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/status?unredacted=true", nil)
+
+	if _, ok := httpRedaction(recorder, request); ok {
+		t.Fatal("Unredacted values were given to a TCP caller")
+	}
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Responded %d; expected %d", recorder.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(recorder.Body.String(), "unix socket") {
+		t.Errorf("Unexpected response %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest("GET", "/status", nil)
+
+	if redact, ok := httpRedaction(recorder, request); !ok || !redact {
+		t.Errorf("Values must be redacted by default, got redact=%v ok=%v", redact, ok)
+	}
+}
+
+func TestListenSocketReplacesOnlySockets(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := httpListenSocket(path); err == nil {
+		t.Errorf("A regular file has been replaced by the socket")
+	}
+	if content, err := ioutil.ReadFile(path); err != nil || string(content) != "content" {
+		t.Errorf("Regular file has been modified: %q, %v", content, err)
+	}
+
+	oldUmask := syscall.Umask(022)
+	defer syscall.Umask(oldUmask)
+
+	path = filepath.Join(dir, "socket")
+	for i := 0; i < 2; i++ {
+		listener, err := httpListenSocket(path)
+		if err != nil {
+			t.Fatalf("Could not listen on socket left by a previous daemon: %v", err)
+		}
+		defer listener.Close()
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("Socket has mode %o; expected 600", mode)
+		}
+	}
+
+	if umask := syscall.Umask(022); umask != 022 {
+		t.Errorf("Umask of the daemon changed to %o", umask)
+	}
+
+	// The socket is bound in a temporary directory, which must not be left behind.
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 2 {
+		t.Errorf("Directory of the socket holds %d files; expected the file and the socket: %v", len(files), err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+type RestartStrategy string
+
+const (
+	RestartStrategyAll     RestartStrategy = "all"
+	RestartStrategyRolling RestartStrategy = "rolling"
+)
+
+var RestartStrategyAvailable = [...]RestartStrategy{
+	RestartStrategyAll,
+	RestartStrategyRolling,
+}
+
+func (strategy RestartStrategy) Valid() bool {
+	for _, availableStrategy := range RestartStrategyAvailable {
+		if availableStrategy == strategy {
+			return true
+		}
+	}
+
+	return false
+}
+
+const rollingRestartPollInterval = 200 * time.Millisecond
+
+type ErrProcessUnhealthy struct {
+	ProcessID string
+	State     string
+}
+
+func (err *ErrProcessUnhealthy) Error() string {
+	return fmt.Sprintf("process %s reached %s state", err.ProcessID, err.State)
+}
+
+// restartProcesses restarts the processes according to the restart strategy of the program.
+// A new restart cancels the rolling restart in progress, if any.
+func (program *Program) restartProcesses(processes []Processer) {
+	program.stopRollingRestart()
+
+	config := program.configuration()
+	if config.Restartstrategy != RestartStrategyRolling || config.Restartbatchsize >= len(processes) {
+		for _, process := range processes {
+			process.Restart()
+		}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(program.LocalContext)
+	program.cancelRollingRestart = cancel
+
+	go func() {
+		defer cancel()
+
+		if err := rollingRestart(ctx, processes, config.Restartbatchsize); err != nil {
+			log.Printf("Rolling restart of program '%s' aborted: %v", config.Name, err)
+			return
+		}
+
+		log.Printf("Rolling restart of program '%s' done", config.Name)
+	}()
+}
+
+// stopRollingRestart leaves the processes not restarted yet as they are.
+func (program *Program) stopRollingRestart() {
+	if program.cancelRollingRestart != nil {
+		program.cancelRollingRestart()
+		program.cancelRollingRestart = nil
+	}
+}
+
+// rollingRestart restarts processes by batches, waiting for each batch to be running
+// before restarting the next one.
+func rollingRestart(ctx context.Context, processes []Processer, batchSize int) error {
+	for start := 0; start < len(processes); start += batchSize {
+		end := start + batchSize
+		if end > len(processes) {
+			end = len(processes)
+		}
+		batch := processes[start:end]
+
+		batchStartedAt := time.Now()
+		for _, process := range batch {
+			process.Restart()
+		}
+
+		if err := waitBatchRunning(ctx, batch, batchStartedAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitBatchRunning returns once every process of the batch has been running since
+// the batch restarted, or an error as soon as one of them is backing off or fatal,
+// or leaves the running state once reached. The history of processes is used, as
+// their current state could still be the one preceding the restart.
+func waitBatchRunning(ctx context.Context, batch []Processer, batchStartedAt time.Time) error {
+	ticker := time.NewTicker(rollingRestartPollInterval)
+	defer ticker.Stop()
+
+	for {
+		running := 0
+
+		for _, process := range batch {
+			serializedProcess := process.Serialize()
+
+			isRunning := false
+			for _, entry := range serializedProcess.History {
+				if entry.Time.Before(batchStartedAt) {
+					continue
+				}
+
+				switch {
+				case entry.State == ProcessStateBackoff,
+					entry.State == ProcessStateFatal,
+					isRunning && entry.State != ProcessStateRunning:
+					return &ErrProcessUnhealthy{
+						ProcessID: serializedProcess.ID,
+						State:     string(entry.State),
+					}
+				case entry.State == ProcessStateRunning:
+					isRunning = true
+				}
+			}
+
+			if isRunning {
+				running++
+			}
+		}
+
+		if running == len(batch) {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
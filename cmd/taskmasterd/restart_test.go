@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/42Taskmaster/taskmaster/machine"
+)
+
+// restartTestProcess goes through the states of its script when restarted,
+// one every restartTestStepInterval.
+type restartTestProcess struct {
+	Processer
+
+	id     string
+	script []machine.StateType
+
+	lock    sync.Mutex
+	history []ProcessHistoryEntry
+
+	onRestart func(id string)
+}
+
+const restartTestStepInterval = 20 * time.Millisecond
+
+func (process *restartTestProcess) Restart() {
+	process.onRestart(process.id)
+
+	go func() {
+		for _, state := range process.script {
+			time.Sleep(restartTestStepInterval)
+
+			process.lock.Lock()
+			process.history = append(process.history, ProcessHistoryEntry{
+				Time:  time.Now(),
+				State: state,
+			})
+			process.lock.Unlock()
+		}
+	}()
+}
+
+func (process *restartTestProcess) Serialize() ProcessSerialized {
+	process.lock.Lock()
+	defer process.lock.Unlock()
+
+	return ProcessSerialized{
+		ID:      process.id,
+		History: append([]ProcessHistoryEntry{}, process.history...),
+	}
+}
+
+func (process *restartTestProcess) isRunning() bool {
+	history := process.Serialize().History
+
+	return len(history) > 0 && history[len(history)-1].State == ProcessStateRunning
+}
+
+func newRestartTestProcesses(scripts [][]machine.StateType, onRestart func(id string)) []Processer {
+	processes := make([]Processer, 0, len(scripts))
+	for index, script := range scripts {
+		processes = append(processes, &restartTestProcess{
+			id:        createProcessName("web", index+1),
+			script:    script,
+			onRestart: onRestart,
+		})
+	}
+
+	return processes
+}
+
+func TestRollingRestartWaitsForEachBatch(t *testing.T) {
+	healthy := []machine.StateType{ProcessStateStopping, ProcessStateStopped, ProcessStateStarting, ProcessStateRunning}
+
+	const batchSize = 2
+
+	var (
+		processes []Processer
+		restarted []string
+		errs      []string
+	)
+	processes = newRestartTestProcesses(
+		[][]machine.StateType{healthy, healthy, healthy, healthy, healthy},
+		func(id string) {
+			restarted = append(restarted, id)
+
+			// Processes of previous batches must be running.
+			batchStart := (len(restarted) - 1) / batchSize * batchSize
+			for _, process := range processes[:batchStart] {
+				if testProcess := process.(*restartTestProcess); !testProcess.isRunning() {
+					errs = append(errs, id+" restarted before "+testProcess.id+" was running")
+				}
+			}
+		},
+	)
+
+	if err := rollingRestart(context.Background(), processes, batchSize); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	expected := []string{"web_1", "web_2", "web_3", "web_4", "web_5"}
+	if len(restarted) != len(expected) {
+		t.Fatalf("restarted processes are %v; expected %v", restarted, expected)
+	}
+	for index := range expected {
+		if restarted[index] != expected[index] {
+			t.Fatalf("restarted processes are %v; expected %v", restarted, expected)
+		}
+	}
+	for _, err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRollingRestartAbortsWhenProcessExitsAfterRunning(t *testing.T) {
+	healthy := []machine.StateType{ProcessStateStarting, ProcessStateRunning}
+	exiting := []machine.StateType{ProcessStateStarting, ProcessStateRunning, ProcessStateExited}
+
+	var restarted []string
+	processes := newRestartTestProcesses(
+		[][]machine.StateType{healthy, exiting, healthy},
+		func(id string) {
+			restarted = append(restarted, id)
+		},
+	)
+
+	// web_2 has been running, then exited, by the time the batch is checked.
+	err := rollingRestart(context.Background(), processes, 2)
+
+	var unhealthyErr *ErrProcessUnhealthy
+	if !errors.As(err, &unhealthyErr) {
+		t.Fatalf("unexpected error returned %v; expected %T", err, unhealthyErr)
+	}
+	if unhealthyErr.ProcessID != "web_2" || unhealthyErr.State != string(ProcessStateExited) {
+		t.Errorf("unexpected error returned %v; expected web_2 to reach EXITED", err)
+	}
+
+	if len(restarted) != 2 {
+		t.Errorf("restarted processes are %v; expected the first batch only", restarted)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+const schemaPrintArg = "schema"
+
+// JSONSchema is the subset of JSON Schema needed to describe the configuration.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	PropertyNames        *JSONSchema            `json:"propertyNames,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *int64                 `json:"minimum,omitempty"`
+	Maximum              *int64                 `json:"maximum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+}
+
+func jsonSchemaBounds(min, max int64) *JSONSchema {
+	return &JSONSchema{
+		Type:    "integer",
+		Minimum: &min,
+		Maximum: &max,
+	}
+}
+
+func jsonSchemaMinimum(min int64) *JSONSchema {
+	return &JSONSchema{
+		Type:    "integer",
+		Minimum: &min,
+	}
+}
+
+// Scalars that yaml decodes into strings, for values often written as numbers.
+var jsonSchemaScalar = &JSONSchema{
+	Type: []string{"string", "number", "boolean"},
+}
+
+// jsonSchemaEnums gives the accepted values of enumerated types.
+func jsonSchemaEnums() map[reflect.Type][]string {
+	enums := make(map[reflect.Type][]string)
+
+	for _, value := range AutorestartAvailable {
+		enums[reflect.TypeOf(value)] = append(enums[reflect.TypeOf(value)], string(value))
+	}
+	for _, value := range StopSignalAvailable {
+		enums[reflect.TypeOf(value)] = append(enums[reflect.TypeOf(value)], string(value))
+	}
+	for _, value := range ProcessGroupAvailable {
+		enums[reflect.TypeOf(value)] = append(enums[reflect.TypeOf(value)], string(value))
+	}
+	for _, value := range RestartStrategyAvailable {
+		enums[reflect.TypeOf(value)] = append(enums[reflect.TypeOf(value)], string(value))
+	}
+
+	return enums
+}
+
+// jsonSchemaFields constrains fields beyond their type, as ProgramYaml.Validate
+// does. They are designated by their yaml path.
+func jsonSchemaFields() map[string]*JSONSchema {
+	exitcode := jsonSchemaBounds(ExitcodeMin, ExitcodeMax)
+
+	return map[string]*JSONSchema{
+		"exitcodes": {
+			OneOf: []*JSONSchema{
+				exitcode,
+				{
+					Type:  "array",
+					Items: exitcode,
+				},
+			},
+		},
+		"numprocs":     jsonSchemaBounds(NumprocsMin, NumprocsMax),
+		"startretries": jsonSchemaBounds(StartretriesMin, StartretriesMax),
+		"starttime":    jsonSchemaBounds(DelayMin, DelayMax),
+		"stoptime":     jsonSchemaBounds(DelayMin, DelayMax),
+		"umask": {
+			OneOf: []*JSONSchema{
+				{
+					Type:    "string",
+					Pattern: "^[0-7]*$",
+				},
+				jsonSchemaMinimum(0),
+			},
+		},
+		"env": {
+			Type: "object",
+			PropertyNames: &JSONSchema{
+				Pattern: EnvironmentVariableNamePattern,
+			},
+			AdditionalProperties: &JSONSchema{
+				OneOf: []*JSONSchema{
+					jsonSchemaScalar,
+					{
+						Type: "object",
+						Properties: map[string]*JSONSchema{
+							"file": {
+								Type: "string",
+							},
+							"secret": {
+								Type: "string",
+							},
+						},
+						AdditionalProperties: false,
+					},
+				},
+			},
+		},
+		"env_file": {
+			OneOf: []*JSONSchema{
+				{
+					Type: "string",
+				},
+				{
+					Type: "array",
+					Items: &JSONSchema{
+						Type: "string",
+					},
+				},
+			},
+		},
+		"inherit_env_allow": {
+			Type: "array",
+			Items: &JSONSchema{
+				Type:    "string",
+				Pattern: EnvironmentVariableGlobPattern,
+			},
+		},
+		"sensitive_env": {
+			Type: "array",
+			Items: &JSONSchema{
+				Type:    "string",
+				Pattern: EnvironmentVariableNamePattern,
+			},
+		},
+		"sensitive_env_patterns": {
+			Type: "array",
+			Items: &JSONSchema{
+				Type:    "string",
+				Pattern: EnvironmentVariableGlobPattern,
+			},
+		},
+		"user":              jsonSchemaScalar,
+		"group":             jsonSchemaScalar,
+		"nice":              jsonSchemaBounds(NiceMin, NiceMax),
+		"oomscoreadj":       jsonSchemaBounds(OomScoreAdjMin, OomScoreAdjMax),
+		"base_port":         jsonSchemaBounds(PortMin, PortMax),
+		"restartbatchsize":  jsonSchemaBounds(RestartbatchsizeMin, RestartbatchsizeMax),
+		"stopsequence.wait": jsonSchemaBounds(DelayMin, DelayMax),
+		"rlimits.nofile":    jsonSchemaMinimum(RlimitUnlimited),
+		"rlimits.core":      jsonSchemaMinimum(RlimitUnlimited),
+		"rlimits.as":        jsonSchemaMinimum(RlimitUnlimited),
+		"rlimits.cpu":       jsonSchemaMinimum(RlimitUnlimited),
+		"rlimits.nproc":     jsonSchemaMinimum(RlimitUnlimited),
+	}
+}
+
+// jsonSchemaRequired lists the fields without default value, by yaml path.
+var jsonSchemaRequired = map[string]bool{
+	"programs":            true,
+	"cmd":                 true,
+	"stopsequence.signal": true,
+	"secrets.file":        true,
+	"secrets.keyfile":     true,
+}
+
+// ConfigurationJSONSchema describes the configuration file, from the yaml
+// structures it is decoded into and the constraints of their validation.
+func ConfigurationJSONSchema() *JSONSchema {
+	generator := jsonSchemaGenerator{
+		enums:  jsonSchemaEnums(),
+		fields: jsonSchemaFields(),
+	}
+
+	schema := generator.structSchema(reflect.TypeOf(ProgramsYaml{}), "")
+	schema.Schema = jsonSchemaDraft
+	schema.Title = "Taskmaster configuration"
+	// Other top-level keys are ignored, and can hold anchors shared by programs.
+	schema.AdditionalProperties = nil
+
+	// Every program is described by ProgramYaml.
+	schema.Properties["programs"] = &JSONSchema{
+		Type:                 "object",
+		AdditionalProperties: generator.structSchema(reflect.TypeOf(ProgramYaml{}), ""),
+	}
+
+	return schema
+}
+
+type jsonSchemaGenerator struct {
+	enums  map[reflect.Type][]string
+	fields map[string]*JSONSchema
+}
+
+func (generator *jsonSchemaGenerator) structSchema(structType reflect.Type, path string) *JSONSchema {
+	schema := &JSONSchema{
+		Type:                 "object",
+		Properties:           make(map[string]*JSONSchema),
+		AdditionalProperties: false,
+	}
+
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		schema.Properties[name] = generator.fieldSchema(field.Type, fieldPath)
+
+		if jsonSchemaRequired[fieldPath] {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+func (generator *jsonSchemaGenerator) fieldSchema(fieldType reflect.Type, path string) *JSONSchema {
+	if schema := generator.fields[path]; schema != nil {
+		return schema
+	}
+
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	if values, ok := generator.enums[fieldType]; ok {
+		enum := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			enum = append(enum, value)
+
+			// Unquoted booleans are decoded into strings as they are written.
+			if value == "true" || value == "false" {
+				enum = append(enum, value == "true")
+			}
+		}
+
+		return &JSONSchema{
+			Enum: enum,
+		}
+	}
+
+	switch fieldType.Kind() {
+	case reflect.String:
+		return &JSONSchema{
+			Type: "string",
+		}
+	case reflect.Bool:
+		return &JSONSchema{
+			Type: "boolean",
+		}
+	case reflect.Int, reflect.Int64:
+		return &JSONSchema{
+			Type: "integer",
+		}
+	case reflect.Slice:
+		return &JSONSchema{
+			Type:  "array",
+			Items: generator.fieldSchema(fieldType.Elem(), path),
+		}
+	case reflect.Map:
+		return &JSONSchema{
+			Type:                 "object",
+			AdditionalProperties: generator.fieldSchema(fieldType.Elem(), path),
+		}
+	case reflect.Struct:
+		return generator.structSchema(fieldType, path)
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// schemaPrintMain prints the JSON Schema of the configuration, for editors and
+// linters to validate configuration files without a running daemon.
+func schemaPrintMain(flags *flag.FlagSet, args []string) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s\n", os.Args[0], schemaPrintArg)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	data, err := json.MarshalIndent(ConfigurationJSONSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(append(data, '\n'))
+}
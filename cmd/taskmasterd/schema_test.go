@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationJSONSchemaDescribesEveryField(t *testing.T) {
+	schema := ConfigurationJSONSchema()
+
+	program, ok := schema.Properties["programs"].AdditionalProperties.(*JSONSchema)
+	if !ok {
+		t.Fatalf("Programs are not described")
+	}
+
+	programType := reflect.TypeOf(ProgramYaml{})
+	for index := 0; index < programType.NumField(); index++ {
+		name := strings.Split(programType.Field(index).Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if _, ok := program.Properties[name]; !ok {
+			t.Errorf("Field %s is not described", name)
+		}
+	}
+
+	if !reflect.DeepEqual(program.Required, []string{"cmd"}) {
+		t.Errorf("Required fields are %v; expected [cmd]", program.Required)
+	}
+
+	numprocs := program.Properties["numprocs"]
+	if *numprocs.Minimum != NumprocsMin || *numprocs.Maximum != NumprocsMax {
+		t.Errorf("Numprocs bounds are [%d, %d]; expected [%d, %d]", *numprocs.Minimum, *numprocs.Maximum, NumprocsMin, NumprocsMax)
+	}
+
+	stopsignal := program.Properties["stopsignal"]
+	if len(stopsignal.Enum) != len(StopSignalAvailable) {
+		t.Errorf("Stopsignal accepts %v; expected %v", stopsignal.Enum, StopSignalAvailable)
+	}
+
+	autorestart := program.Properties["autorestart"]
+	expectedAutorestart := []interface{}{"true", true, "false", false, "unexpected"}
+	if !reflect.DeepEqual(autorestart.Enum, expectedAutorestart) {
+		t.Errorf("Autorestart accepts %v; expected %v", autorestart.Enum, expectedAutorestart)
+	}
+
+	stopStep := program.Properties["stopsequence"].Items
+	if !reflect.DeepEqual(stopStep.Required, []string{"signal"}) {
+		t.Errorf("Required stop step fields are %v; expected [signal]", stopStep.Required)
+	}
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const secretsSealArg = "seal-secrets"
+
+// Secrets files start with this line, followed by the encrypted secrets in base64.
+const secretsFileHeader = "taskmaster-secrets-v1\n"
+
+// The key file holds an AES-256 key in hexadecimal.
+const secretsKeySize = 32
+
+var (
+	ValidationIssueNoSecretsFile = errors.New("secret references require a secrets file")
+
+	ErrSecretsFileInvalid = errors.New("not a taskmaster secrets file")
+	ErrSecretsKeyInvalid  = errors.New("key file must hold a 32 bytes key in hexadecimal")
+)
+
+type ErrSecretNotFound struct {
+	Secret string
+}
+
+func (err *ErrSecretNotFound) Error() string {
+	return fmt.Sprintf("secret %s not found", err.Secret)
+}
+
+type ErrEnvSecret struct {
+	Name string
+	Err  error
+}
+
+func (err *ErrEnvSecret) Error() string {
+	return fmt.Sprintf("could not resolve the secret of env.%s: %v", err.Name, err.Err)
+}
+
+func (err *ErrEnvSecret) Unwrap() error {
+	return err.Err
+}
+
+// SecretsYaml designates the encrypted secrets file that env values can reference
+// by name, and the key file unlocking it.
+type SecretsYaml struct {
+	File    *string `yaml:"file,omitempty" json:"file,omitempty" toml:"file,omitempty"`
+	Keyfile *string `yaml:"keyfile,omitempty" json:"keyfile,omitempty" toml:"keyfile,omitempty"`
+}
+
+func (secrets *SecretsYaml) Validate() error {
+	var errs ErrProgramsYamlValidations
+
+	if secrets.File == nil || *secrets.File == "" {
+		errs.Add("File", ValidationIssueEmptyField)
+	} else if hasNullChar(*secrets.File) {
+		errs.Add("File", ValidationIssueNullChar)
+	}
+
+	if secrets.Keyfile == nil || *secrets.Keyfile == "" {
+		errs.Add("Keyfile", ValidationIssueEmptyField)
+	} else if hasNullChar(*secrets.Keyfile) {
+		errs.Add("Keyfile", ValidationIssueNullChar)
+	}
+
+	return errs.Err()
+}
+
+// SecretReference is an env value read when processes start: either the content
+// of a file, or a secret of the secrets file.
+type SecretReference struct {
+	File   string `yaml:"file,omitempty" json:"file,omitempty" toml:"file,omitempty"`
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty" toml:"secret,omitempty"`
+}
+
+// EnvValueYaml is an env value given as is, or referencing a secret.
+type EnvValueYaml struct {
+	Value     string
+	Reference *SecretReference
+}
+
+// EnvYamlFromValues gives env values all given as is.
+func EnvYamlFromValues(values map[string]string) map[string]EnvValueYaml {
+	if values == nil {
+		return nil
+	}
+
+	env := make(map[string]EnvValueYaml, len(values))
+	for name, value := range values {
+		env[name] = EnvValueYaml{
+			Value: value,
+		}
+	}
+	return env
+}
+
+func (value *EnvValueYaml) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var plainValue string
+	if err := unmarshal(&plainValue); err == nil {
+		*value = EnvValueYaml{
+			Value: plainValue,
+		}
+		return nil
+	}
+
+	var reference SecretReference
+	if err := unmarshal(&reference); err != nil {
+		return err
+	}
+
+	*value = EnvValueYaml{
+		Reference: &reference,
+	}
+	return nil
+}
+
+func (value EnvValueYaml) MarshalYAML() (interface{}, error) {
+	if value.Reference != nil {
+		return value.Reference, nil
+	}
+
+	return value.Value, nil
+}
+
+// UnmarshalJSON accepts numbers and booleans as values, as yaml does.
+func (value *EnvValueYaml) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		var reference SecretReference
+		if err := json.Unmarshal(data, &reference); err != nil {
+			return err
+		}
+
+		*value = EnvValueYaml{
+			Reference: &reference,
+		}
+	case len(data) > 0 && data[0] == '"':
+		var plainValue string
+		if err := json.Unmarshal(data, &plainValue); err != nil {
+			return err
+		}
+
+		*value = EnvValueYaml{
+			Value: plainValue,
+		}
+	default:
+		var scalar interface{}
+		if err := json.Unmarshal(data, &scalar); err != nil {
+			return err
+		}
+		if _, ok := scalar.([]interface{}); ok || scalar == nil {
+			return fmt.Errorf("env value must be a scalar or a secret reference, not %s", data)
+		}
+
+		*value = EnvValueYaml{
+			Value: string(data),
+		}
+	}
+
+	return nil
+}
+
+func (value EnvValueYaml) MarshalJSON() ([]byte, error) {
+	if value.Reference != nil {
+		return json.Marshal(value.Reference)
+	}
+
+	return json.Marshal(value.Value)
+}
+
+func (value *EnvValueYaml) UnmarshalTOML(data interface{}) error {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		var reference SecretReference
+		for key, field := range data {
+			fieldString, ok := field.(string)
+			if !ok {
+				return fmt.Errorf("secret reference %s must be a string", key)
+			}
+
+			switch key {
+			case "file":
+				reference.File = fieldString
+			case "secret":
+				reference.Secret = fieldString
+			}
+		}
+
+		*value = EnvValueYaml{
+			Reference: &reference,
+		}
+	case []interface{}:
+		return fmt.Errorf("env value must be a scalar or a secret reference")
+	default:
+		*value = EnvValueYaml{
+			Value: fmt.Sprint(data),
+		}
+	}
+
+	return nil
+}
+
+// MarshalTOML writes a basic string or an inline table, JSON strings being valid
+// TOML strings.
+func (value EnvValueYaml) MarshalTOML() ([]byte, error) {
+	if value.Reference == nil {
+		return json.Marshal(value.Value)
+	}
+
+	var fields []string
+	if value.Reference.File != "" {
+		file, _ := json.Marshal(value.Reference.File)
+		fields = append(fields, "file = "+string(file))
+	}
+	if value.Reference.Secret != "" {
+		secret, _ := json.Marshal(value.Reference.Secret)
+		fields = append(fields, "secret = "+string(secret))
+	}
+
+	return []byte("{ " + strings.Join(fields, ", ") + " }"), nil
+}
+
+// EnvSecret is a validated secret reference, along with the secrets file it is
+// looked up in. Only references are held by the daemon and returned by the API:
+// secrets are read when processes start.
+type EnvSecret struct {
+	File        string `json:"file,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+	SecretsFile string `json:"secretsfile,omitempty"`
+	Keyfile     string `json:"keyfile,omitempty"`
+}
+
+// validateSecretReference checks that a reference designates a single secret, and
+// that secrets files are configured for named secrets.
+func validateSecretReference(reference SecretReference, secrets *SecretsYaml) (EnvSecret, error) {
+	switch {
+	case reference.File == "" && reference.Secret == "":
+		return EnvSecret{}, ValidationIssueEmptyField
+	case reference.File != "" && reference.Secret != "":
+		return EnvSecret{}, ValidationIssueUnexpectedValue
+	case hasNullChar(reference.File) || hasNullChar(reference.Secret):
+		return EnvSecret{}, ValidationIssueNullChar
+	case reference.File != "":
+		return EnvSecret{
+			File: reference.File,
+		}, nil
+	case secrets == nil || secrets.File == nil || secrets.Keyfile == nil:
+		return EnvSecret{}, ValidationIssueNoSecretsFile
+	default:
+		return EnvSecret{
+			Secret:      reference.Secret,
+			SecretsFile: *secrets.File,
+			Keyfile:     *secrets.Keyfile,
+		}, nil
+	}
+}
+
+// ResolveEnvSecrets reads the secrets of env values. Files are resolved relative
+// to the working directory of processes, and their final newline is dropped.
+func (config *ProgramConfiguration) ResolveEnvSecrets() (map[string]string, error) {
+	names := make([]string, 0, len(config.EnvSecrets))
+	for name := range config.EnvSecrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		values       = make(map[string]string, len(names))
+		secretsFiles = make(map[string]map[string]string)
+	)
+	for _, name := range names {
+		secret := config.EnvSecrets[name]
+
+		if secret.File != "" {
+			path := secret.File
+			if !filepath.IsAbs(path) && config.Workingdir != "" {
+				path = filepath.Join(config.Workingdir, path)
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, &ErrEnvSecret{
+					Name: name,
+					Err:  err,
+				}
+			}
+
+			value := strings.TrimSuffix(string(data), "\n")
+			values[name] = strings.TrimSuffix(value, "\r")
+			continue
+		}
+
+		secrets, ok := secretsFiles[secret.SecretsFile]
+		if !ok {
+			var err error
+
+			secrets, err = openSecretsFile(secret.SecretsFile, secret.Keyfile)
+			if err != nil {
+				return nil, &ErrEnvSecret{
+					Name: name,
+					Err:  err,
+				}
+			}
+			secretsFiles[secret.SecretsFile] = secrets
+		}
+
+		value, ok := secrets[secret.Secret]
+		if !ok {
+			return nil, &ErrEnvSecret{
+				Name: name,
+				Err: &ErrSecretNotFound{
+					Secret: secret.Secret,
+				},
+			}
+		}
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+func readSecretsKey(keyfile string) (cipher.AEAD, error) {
+	data, err := ioutil.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != secretsKeySize {
+		return nil, ErrSecretsKeyInvalid
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// openSecretsFile decrypts a secrets file, which holds a JSON object of secrets
+// encrypted with AES-256-GCM, the nonce prepended.
+func openSecretsFile(path, keyfile string) (map[string]string, error) {
+	aead, err := readSecretsKey(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(secretsFileHeader)) {
+		return nil, ErrSecretsFileInvalid
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(secretsFileHeader):])))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrSecretsFileInvalid
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt secrets, the key may be wrong: %v", err)
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, ErrSecretsFileInvalid
+	}
+
+	return secrets, nil
+}
+
+func sealSecrets(secrets map[string]string, keyfile string) ([]byte, error) {
+	aead, err := readSecretsKey(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+
+	return []byte(secretsFileHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// generateSecretsKey writes a new key file, readable by its owner only.
+func generateSecretsKey(keyfile string) error {
+	key := make([]byte, secretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(keyfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(hex.EncodeToString(key) + "\n")
+	return err
+}
+
+// secretsSealMain encrypts a JSON object of secrets into a secrets file, or
+// decrypts one to edit it. The key file is generated when it does not exist.
+func secretsSealMain(flags *flag.FlagSet, args []string) {
+	keyfile := flags.String("k", "", "Key file, generated when it does not exist")
+	output := flags.String("o", "", "Output file instead of the standard output")
+	decrypt := flags.Bool("d", false, "Decrypt a secrets file into JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s -k keyfile [-d] [-o output] <file>\n", os.Args[0], secretsSealArg)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *keyfile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if *decrypt {
+		var secrets map[string]string
+
+		secrets, err = openSecretsFile(flags.Arg(0), *keyfile)
+		if err == nil {
+			data, err = json.MarshalIndent(secrets, "", "  ")
+			data = append(data, '\n')
+		}
+	} else {
+		var secrets map[string]string
+
+		if data, err = ioutil.ReadFile(flags.Arg(0)); err == nil {
+			err = json.Unmarshal(data, &secrets)
+		}
+		if _, statErr := os.Stat(*keyfile); err == nil && os.IsNotExist(statErr) {
+			if err = generateSecretsKey(*keyfile); err == nil {
+				fmt.Fprintln(os.Stderr, "generated key file", *keyfile)
+			}
+		}
+		if err == nil {
+			data, err = sealSecrets(secrets, *keyfile)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+
+	if err := ioutil.WriteFile(*output, data, 0600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
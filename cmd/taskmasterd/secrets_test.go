@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveEnvSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskmasterd-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyfile := filepath.Join(dir, "secrets.key")
+	if err := generateSecretsKey(keyfile); err != nil {
+		t.Fatalf("Could not generate key: %v", err)
+	}
+
+	sealed, err := sealSecrets(map[string]string{
+		"api": "s3cr3t",
+	}, keyfile)
+	if err != nil {
+		t.Fatalf("Could not seal secrets: %v", err)
+	}
+
+	secretsFile := filepath.Join(dir, "secrets")
+	files := map[string][]byte{
+		"secrets": sealed,
+		"db":      []byte("password\n"),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd:        strToPointer("/bin/web"),
+				Workingdir: strToPointer(dir),
+				Env: map[string]EnvValueYaml{
+					"PORT":        {Value: "8080"},
+					"DB_PASSWORD": {Reference: &SecretReference{File: "db"}},
+					"API_KEY":     {Reference: &SecretReference{Secret: "api"}},
+				},
+			},
+		},
+		Secrets: &SecretsYaml{
+			File:    strToPointer(secretsFile),
+			Keyfile: strToPointer(keyfile),
+		},
+	}
+
+	configs, err := programs.Validate()
+	if err != nil {
+		t.Fatalf("Could not validate configuration: %v", err)
+	}
+
+	config := configs["web"]
+	if !reflect.DeepEqual(config.Env, map[string]string{"PORT": "8080"}) {
+		t.Errorf("Env should only hold plain values, holds %v", config.Env)
+	}
+
+	secretEnv, err := config.ResolveEnvSecrets()
+	if err != nil {
+		t.Fatalf("Could not resolve secrets: %v", err)
+	}
+
+	expected := map[string]string{
+		"DB_PASSWORD": "password",
+		"API_KEY":     "s3cr3t",
+	}
+	if !reflect.DeepEqual(secretEnv, expected) {
+		t.Errorf("Resolved secrets are %v; expected %v", secretEnv, expected)
+	}
+
+	config.EnvSecrets["API_KEY"] = EnvSecret{
+		Secret:      "missing",
+		SecretsFile: secretsFile,
+		Keyfile:     keyfile,
+	}
+
+	var notFoundErr *ErrSecretNotFound
+	if _, err := config.ResolveEnvSecrets(); !errors.As(err, &notFoundErr) {
+		t.Errorf("Incorrect error: %v; expected the secret not to be found", err)
+	}
+}
+
+func TestOpenSecretsFileFailsWithAnotherKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskmasterd-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyfile, otherKeyfile := filepath.Join(dir, "secrets.key"), filepath.Join(dir, "other.key")
+	for _, path := range []string{keyfile, otherKeyfile} {
+		if err := generateSecretsKey(path); err != nil {
+			t.Fatalf("Could not generate key: %v", err)
+		}
+	}
+
+	sealed, err := sealSecrets(map[string]string{"api": "s3cr3t"}, keyfile)
+	if err != nil {
+		t.Fatalf("Could not seal secrets: %v", err)
+	}
+
+	secretsFile := filepath.Join(dir, "secrets")
+	if err := ioutil.WriteFile(secretsFile, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openSecretsFile(secretsFile, otherKeyfile); err == nil {
+		t.Errorf("Secrets should not be decrypted with another key")
+	}
+}
+
+func TestSecretReferenceRequiresSecretsFile(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd: strToPointer("/bin/web"),
+				Env: map[string]EnvValueYaml{
+					"API_KEY": {Reference: &SecretReference{Secret: "api"}},
+				},
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+
+	var validationError *ErrProgramsYamlValidation
+	if !errors.As(err, &validationError) || validationError.Field != "Programs[web].Env[API_KEY]" || !errors.Is(err, ValidationIssueNoSecretsFile) {
+		t.Errorf("Incorrect error: %v; expected a missing secrets file", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 type StopSignal string
@@ -64,9 +65,26 @@ func (signal StopSignal) ToOsSignal() os.Signal {
 		return nil
 	}
 }
+
+// StopStepYaml is a step of the stop sequence as written in the configuration.
+// When Wait is omitted, the program stoptime is used.
+type StopStepYaml struct {
+	Signal *StopSignal `yaml:"signal,omitempty" json:"signal,omitempty" toml:"signal,omitempty"`
+	Wait   *int        `yaml:"wait,omitempty" json:"wait,omitempty" toml:"wait,omitempty"`
+}
+
+// StopStep is a signal to send to a stopping process, and the time to wait
+// for it to exit before going to the next step.
+type StopStep struct {
+	Signal StopSignal `json:"signal"`
+	Wait   int        `json:"wait"`
+}
+
 func (taskmasterd *Taskmasterd) SignalsSetup() {
 	taskmasterd.SignalsExitSetup()
 	taskmasterd.SignalSighupSetup()
+	taskmasterd.SignalSigchldSetup()
+	taskmasterd.SignalSigusr2Setup()
 }
 
 func (taskmasterd *Taskmasterd) SignalsExitSetup() {
@@ -91,3 +109,46 @@ func (taskmasterd *Taskmasterd) SignalSighupSetup() {
 		}
 	}()
 }
+
+// SignalSigchldSetup reaps orphans adopted by taskmasterd as soon as they exit,
+// and periodically refreshes the list of running ones.
+func (taskmasterd *Taskmasterd) SignalSigchldSetup() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGCHLD)
+
+	go func() {
+		ticker := time.NewTicker(orphansScanInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-sigs:
+			case <-ticker.C:
+			case <-taskmasterd.Context.Done():
+				return
+			}
+
+			childrenRegistry.Scan()
+		}
+	}()
+}
+
+// SignalSigusr2Setup upgrades taskmasterd to the binary found on disk.
+func (taskmasterd *Taskmasterd) SignalSigusr2Setup() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+
+	go func() {
+		for range sigs {
+			log.Print("SIGUSR2 received, upgrading taskmasterd")
+
+			if err := taskmasterd.Upgrade(); err != nil {
+				log.Printf("Could not upgrade: %v", err)
+				continue
+			}
+
+			taskmasterd.HandOver()
+			return
+		}
+	}()
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/42Taskmaster/taskmaster/machine"
+)
+
+const stateDefaultPath = "./taskmasterd.state"
+
+// ProcessStateRecord is what taskmasterd remembers of a running process, so that
+// the next daemon can take over its supervision instead of starting it again.
+type ProcessStateRecord struct {
+	Program   string            `json:"program"`
+	ID        string            `json:"id"`
+	Pid       int               `json:"pid"`
+	StartTime uint64            `json:"startTime"`
+	State     machine.StateType `json:"state"`
+	StartedAt time.Time         `json:"startedAt"`
+
+	// Fingerprint identifies the configuration the process was started with.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+func (record ProcessStateRecord) procStat() ProcStat {
+	return ProcStat{
+		Pid:       record.Pid,
+		StartTime: record.StartTime,
+	}
+}
+
+// ProgramIntent is what an operator asked for a program. It prevails over autostart
+// until cleared, so that reloads and restarts do not undo it.
+type ProgramIntent string
+
+const (
+	ProgramIntentStarted ProgramIntent = "STARTED"
+	ProgramIntentStopped ProgramIntent = "STOPPED"
+)
+
+type ProgramOverride struct {
+	Intent ProgramIntent `json:"intent"`
+	Since  time.Time     `json:"since"`
+}
+
+type StateFile struct {
+	Processes []ProcessStateRecord       `json:"processes"`
+	Overrides map[string]ProgramOverride `json:"overrides,omitempty"`
+}
+
+// processFingerprint hashes the fields of a configuration whose change requires
+// processes to be restarted, as listed by restartTriggeringFields.
+func processFingerprint(config ProgramConfiguration) string {
+	content, err := json.Marshal(struct {
+		Cmd             string
+		Env             map[string]string
+		EnvSecrets      map[string]EnvSecret
+		EnvFiles        []string
+		Umask           string
+		Stdout          string
+		Stderr          string
+		Workingdir      string
+		BasePort        int
+		User            string
+		Group           string
+		Rlimits         ProgramRlimits
+		Nice            *int
+		Oomscoreadj     *int
+		Processgroup    ProcessGroupType
+		InheritEnv      bool
+		InheritEnvAllow []string
+	}{
+		Cmd:             config.Cmd,
+		Env:             config.Env,
+		EnvSecrets:      config.EnvSecrets,
+		EnvFiles:        config.EnvFiles,
+		Umask:           config.Umask,
+		Stdout:          config.Stdout,
+		Stderr:          config.Stderr,
+		Workingdir:      config.Workingdir,
+		BasePort:        config.BasePort,
+		User:            config.User,
+		Group:           config.Group,
+		Rlimits:         config.Rlimits,
+		Nice:            config.Nice,
+		Oomscoreadj:     config.Oomscoreadj,
+		Processgroup:    config.Processgroup,
+		InheritEnv:      config.InheritEnv,
+		InheritEnvAllow: config.InheritEnvAllow,
+	})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+type processStateKey struct {
+	Program string
+	ID      string
+}
+
+// StateStore keeps the state file up to date with the running processes.
+type StateStore struct {
+	lock sync.Mutex
+
+	path      string
+	processes map[processStateKey]ProcessStateRecord
+	overrides map[string]ProgramOverride
+
+	// adoptions are the processes left running by the previous daemon,
+	// waiting for their program to be loaded.
+	adoptions map[processStateKey]ProcessStateRecord
+}
+
+var stateStore = &StateStore{
+	processes: make(map[processStateKey]ProcessStateRecord),
+	overrides: make(map[string]ProgramOverride),
+	adoptions: make(map[processStateKey]ProcessStateRecord),
+}
+
+func readStateFile(path string) (StateFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return StateFile{}, err
+	}
+
+	var stateFile StateFile
+	if err := json.Unmarshal(content, &stateFile); err != nil {
+		return StateFile{}, err
+	}
+
+	return stateFile, nil
+}
+
+// Open reads the state file left by a previous daemon. Processes still running,
+// with the same PID and start time, are kept to be adopted.
+func (store *StateStore) Open(path string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.path = path
+
+	stateFile, err := readStateFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, record := range stateFile.Processes {
+		if record.Pid <= 0 || !isSameProcess(record.procStat()) {
+			log.Printf("Process '%s' of program '%s' with PID %d is not running anymore", record.ID, record.Program, record.Pid)
+			continue
+		}
+
+		key := processStateKey{record.Program, record.ID}
+		store.adoptions[key] = record
+
+		// Until adopted, the process must survive another restart.
+		store.processes[key] = record
+	}
+
+	for program, override := range stateFile.Overrides {
+		store.overrides[program] = override
+	}
+
+	return store.persist()
+}
+
+// Close stops updating the state file, which must be left as is for the next daemon.
+func (store *StateStore) Close() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.path = ""
+}
+
+// TakeAdoption returns the record of a process to adopt, at most once.
+func (store *StateStore) TakeAdoption(program, id string) (ProcessStateRecord, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	key := processStateKey{program, id}
+	record, ok := store.adoptions[key]
+	delete(store.adoptions, key)
+
+	return record, ok
+}
+
+// TakeUnadopted returns the processes nobody adopted once the configuration has
+// been loaded, and forgets them: their program was removed or has fewer processes.
+func (store *StateStore) TakeUnadopted() ([]ProcessStateRecord, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	records := make([]ProcessStateRecord, 0, len(store.adoptions))
+	for key, record := range store.adoptions {
+		records = append(records, record)
+
+		delete(store.adoptions, key)
+		delete(store.processes, key)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Pid < records[j].Pid
+	})
+
+	return records, store.persist()
+}
+
+// Update records the process, or forgets it when it has no PID anymore.
+func (store *StateStore) Update(record ProcessStateRecord) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	key := processStateKey{record.Program, record.ID}
+	if record.Pid > 0 {
+		store.processes[key] = record
+	} else {
+		delete(store.processes, key)
+	}
+
+	return store.persist()
+}
+
+// Override returns the intent of an operator for a program, if any.
+func (store *StateStore) Override(program string) (ProgramOverride, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	override, ok := store.overrides[program]
+	return override, ok
+}
+
+func (store *StateStore) SetOverride(program string, intent ProgramIntent) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.overrides[program] = ProgramOverride{
+		Intent: intent,
+		Since:  time.Now(),
+	}
+
+	return store.persist()
+}
+
+func (store *StateStore) ClearOverride(program string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.overrides[program]; !ok {
+		return nil
+	}
+	delete(store.overrides, program)
+
+	return store.persist()
+}
+
+// persist atomically replaces the state file, so that a crash can never leave it truncated.
+// It is written on every transition of processes, and is not synced to disk.
+func (store *StateStore) persist() error {
+	if len(store.path) == 0 {
+		return nil
+	}
+
+	stateFile := StateFile{
+		Processes: make([]ProcessStateRecord, 0, len(store.processes)),
+		Overrides: store.overrides,
+	}
+	for _, record := range store.processes {
+		stateFile.Processes = append(stateFile.Processes, record)
+	}
+	sort.Slice(stateFile.Processes, func(i, j int) bool {
+		a, b := stateFile.Processes[i], stateFile.Processes[j]
+		if a.Program != b.Program {
+			return a.Program < b.Program
+		}
+		return a.ID < b.ID
+	})
+
+	content, err := json.MarshalIndent(stateFile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), store.path)
+}
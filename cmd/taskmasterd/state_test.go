@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStateStore() *StateStore {
+	return &StateStore{
+		processes: make(map[processStateKey]ProcessStateRecord),
+		overrides: make(map[string]ProgramOverride),
+		adoptions: make(map[processStateKey]ProcessStateRecord),
+	}
+}
+
+func TestStateStoreAdoptsOnlyRunningProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmasterd.state")
+
+	self, err := readProcStat(os.Getpid())
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	previousStore := newTestStateStore()
+	previousStore.path = path
+	previousStore.Update(ProcessStateRecord{
+		Program:   "running",
+		ID:        "running_1",
+		Pid:       self.Pid,
+		StartTime: self.StartTime,
+		State:     ProcessStateRunning,
+		StartedAt: time.Now(),
+	})
+	// Same PID, but another start time: the PID has been reused.
+	previousStore.Update(ProcessStateRecord{
+		Program:   "reused",
+		ID:        "reused_1",
+		Pid:       self.Pid,
+		StartTime: self.StartTime + 1,
+		State:     ProcessStateRunning,
+	})
+
+	store := newTestStateStore()
+	if err := store.Open(path); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	if _, ok := store.TakeAdoption("reused", "reused_1"); ok {
+		t.Errorf("process with reused PID must not be adopted")
+	}
+
+	record, ok := store.TakeAdoption("running", "running_1")
+	if !ok {
+		t.Fatalf("running process must be adopted")
+	}
+	if record.Pid != self.Pid || record.State != ProcessStateRunning {
+		t.Errorf("adopted record is incorrect %+v", record)
+	}
+
+	if _, ok := store.TakeAdoption("running", "running_1"); ok {
+		t.Errorf("process must be adopted at most once")
+	}
+}
+
+func TestStateStoreForgetsProcessesWithoutPid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmasterd.state")
+
+	store := newTestStateStore()
+	store.path = path
+
+	store.Update(ProcessStateRecord{
+		Program: "program",
+		ID:      "program_1",
+		Pid:     4242,
+		State:   ProcessStateRunning,
+	})
+	store.Update(ProcessStateRecord{
+		Program: "program",
+		ID:      "program_1",
+		State:   ProcessStateStopped,
+	})
+
+	stateFile, err := readStateFile(path)
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if len(stateFile.Processes) != 0 {
+		t.Errorf("unexpected processes in state file %+v; expected none", stateFile.Processes)
+	}
+}
+
+func TestStateStoreOpenWithoutStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmasterd.state")
+
+	store := newTestStateStore()
+	if err := store.Open(path); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected state file to be created; received %v", err)
+	}
+}
+
+func TestStateStoreOverridesSurviveRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmasterd.state")
+
+	previousStore := newTestStateStore()
+	if err := previousStore.Open(path); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	previousStore.SetOverride("stopped", ProgramIntentStopped)
+	previousStore.SetOverride("started", ProgramIntentStarted)
+	previousStore.SetOverride("cleared", ProgramIntentStopped)
+	previousStore.ClearOverride("cleared")
+
+	store := newTestStateStore()
+	if err := store.Open(path); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	expectedIntents := map[string]ProgramIntent{
+		"stopped": ProgramIntentStopped,
+		"started": ProgramIntentStarted,
+	}
+	for program, expectedIntent := range expectedIntents {
+		override, ok := store.Override(program)
+		if !ok || override.Intent != expectedIntent {
+			t.Errorf("incorrect override for program %s: (%v, %v); expected (%v, true)", program, override.Intent, ok, expectedIntent)
+		}
+	}
+
+	if override, ok := store.Override("cleared"); ok {
+		t.Errorf("unexpected override for cleared program: %v", override.Intent)
+	}
+}
+
+func TestStateStoreTakesUnadoptedProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmasterd.state")
+
+	self, err := readProcStat(os.Getpid())
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	previousStore := newTestStateStore()
+	previousStore.path = path
+	for _, id := range []string{"program_1", "program_2"} {
+		previousStore.Update(ProcessStateRecord{
+			Program:   "program",
+			ID:        id,
+			Pid:       self.Pid,
+			StartTime: self.StartTime,
+			State:     ProcessStateRunning,
+		})
+	}
+
+	store := newTestStateStore()
+	if err := store.Open(path); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+
+	// The program has been scaled down to a single process.
+	if _, ok := store.TakeAdoption("program", "program_1"); !ok {
+		t.Fatalf("running process must be adopted")
+	}
+
+	records, err := store.TakeUnadopted()
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "program_2" {
+		t.Fatalf("unadopted records are %+v; expected program_2", records)
+	}
+
+	if records, _ := store.TakeUnadopted(); len(records) != 0 {
+		t.Errorf("unadopted records must be taken at most once, received %+v", records)
+	}
+
+	stateFile, err := readStateFile(path)
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if len(stateFile.Processes) != 1 || stateFile.Processes[0].ID != "program_1" {
+		t.Errorf("state file processes are %+v; expected program_1 only", stateFile.Processes)
+	}
+}
+
+func TestProcessFingerprintIgnoresFieldsNotRequiringRestart(t *testing.T) {
+	config := ProgramConfiguration{
+		Name:     "program",
+		Cmd:      "sleep 10",
+		Numprocs: 1,
+	}
+	fingerprint := processFingerprint(config)
+
+	scaled := config
+	scaled.Numprocs = 4
+	scaled.Autostart = true
+	if processFingerprint(scaled) != fingerprint {
+		t.Errorf("fingerprint changed with numprocs and autostart")
+	}
+
+	edited := config
+	edited.Cmd = "sleep 20"
+	if processFingerprint(edited) == fingerprint {
+		t.Errorf("fingerprint did not change with cmd")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// PR_SET_CHILD_SUBREAPER is not exported by the syscall package.
+const prSetChildSubreaper = 36
+
+const orphansScanInterval = 5 * time.Second
+
+// ManagedChild is a process directly started by taskmasterd.
+type ManagedChild struct {
+	ProgramName string
+	ProcessID   string
+	Pid         int
+	Pgrp        int
+	Session     int
+}
+
+// Orphan is a process adopted by taskmasterd acting as a subreaper.
+// ProgramName and ProcessID are empty when it could not be attributed.
+type Orphan struct {
+	ProcStat
+
+	ProgramName string
+	ProcessID   string
+}
+
+// ChildrenRegistry keeps track of the processes started by taskmasterd, so that
+// adopted orphans can be told apart from them and reaped without stealing
+// the exit status of a managed process.
+type ChildrenRegistry struct {
+	lock sync.Mutex
+
+	managed map[int]ManagedChild
+	orphans []Orphan
+}
+
+var childrenRegistry = &ChildrenRegistry{
+	managed: make(map[int]ManagedChild),
+}
+
+func subreaperSetup() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Start starts the command and registers it as managed, while preventing
+// the registry from reaping it in-between.
+func (registry *ChildrenRegistry) Start(cmd *exec.Cmd, programName, processID string) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	child := ManagedChild{
+		ProgramName: programName,
+		ProcessID:   processID,
+		Pid:         cmd.Process.Pid,
+	}
+	if stat, err := readProcStat(child.Pid); err == nil {
+		child.Pgrp = stat.Pgrp
+		child.Session = stat.Session
+	}
+
+	registry.managed[child.Pid] = child
+
+	return nil
+}
+
+// Release must be called once the managed process has been waited for.
+func (registry *ChildrenRegistry) Release(pid int) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	delete(registry.managed, pid)
+}
+
+// attribute finds the managed process an orphan comes from, using its process group
+// or session. Groups and sessions shared with the daemon itself are meaningless.
+func (registry *ChildrenRegistry) attribute(orphan ProcStat) (ManagedChild, bool) {
+	daemon, _ := readProcStat(os.Getpid())
+
+	for _, child := range registry.managed {
+		if child.Pgrp != 0 && child.Pgrp != daemon.Pgrp && child.Pgrp == orphan.Pgrp {
+			return child, true
+		}
+		if child.Session != 0 && child.Session != daemon.Session && child.Session == orphan.Session {
+			return child, true
+		}
+	}
+
+	for _, previousOrphan := range registry.orphans {
+		if previousOrphan.Pid == orphan.Pid && previousOrphan.StartTime == orphan.StartTime {
+			return ManagedChild{
+				ProgramName: previousOrphan.ProgramName,
+				ProcessID:   previousOrphan.ProcessID,
+			}, previousOrphan.ProgramName != ""
+		}
+	}
+
+	return ManagedChild{}, false
+}
+
+// Scan reaps exited orphans and refreshes the list of running ones.
+func (registry *ChildrenRegistry) Scan() {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	stats, err := listProcStats()
+	if err != nil {
+		return
+	}
+
+	daemonPid := os.Getpid()
+
+	orphans := []Orphan{}
+	for _, stat := range stats {
+		if stat.Ppid != daemonPid {
+			continue
+		}
+		if _, ok := registry.managed[stat.Pid]; ok {
+			continue
+		}
+
+		child, attributed := registry.attribute(stat)
+
+		if stat.isZombie() {
+			var status syscall.WaitStatus
+			if _, err := syscall.Wait4(stat.Pid, &status, syscall.WNOHANG, nil); err == nil {
+				if attributed {
+					log.Printf("Reaped orphan %d of process '%s' of program '%s'", stat.Pid, child.ProcessID, child.ProgramName)
+				} else {
+					log.Printf("Reaped orphan %d", stat.Pid)
+				}
+			}
+			continue
+		}
+
+		orphans = append(orphans, Orphan{
+			ProcStat:    stat,
+			ProgramName: child.ProgramName,
+			ProcessID:   child.ProcessID,
+		})
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Pid < orphans[j].Pid
+	})
+
+	registry.orphans = orphans
+}
+
+// Orphans returns the running orphans attributed to a program,
+// or the unattributed ones when programName is empty.
+func (registry *ChildrenRegistry) Orphans(programName string) []Orphan {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	orphans := []Orphan{}
+	for _, orphan := range registry.orphans {
+		if orphan.ProgramName == programName {
+			orphans = append(orphans, orphan)
+		}
+	}
+
+	return orphans
+}
+
+// TerminateOrphans sends signal to the orphans of a program, and kills those still
+// alive after stoptime.
+func (registry *ChildrenRegistry) TerminateOrphans(programName string, signal syscall.Signal, stoptime time.Duration) {
+	orphans := registry.Orphans(programName)
+	if len(orphans) == 0 {
+		return
+	}
+
+	log.Printf("Terminating %d orphan(s) of program '%s'", len(orphans), programName)
+
+	for _, orphan := range orphans {
+		if isSameProcess(orphan.ProcStat) {
+			syscall.Kill(orphan.Pid, signal)
+		}
+	}
+
+	go func() {
+		<-time.After(stoptime)
+
+		for _, orphan := range orphans {
+			if isSameProcess(orphan.ProcStat) {
+				syscall.Kill(orphan.Pid, syscall.SIGKILL)
+			}
+		}
+	}()
+}
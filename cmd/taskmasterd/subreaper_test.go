@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestChildrenRegistry(t *testing.T) *ChildrenRegistry {
+	if err := subreaperSetup(); err != nil {
+		t.Skipf("cannot act as a subreaper: %v", err)
+	}
+
+	return &ChildrenRegistry{
+		managed: make(map[int]ManagedChild),
+	}
+}
+
+// startOrphan starts a managed shell which forks a grandchild, then kills the shell
+// so that the grandchild is adopted by the test process.
+func startOrphan(t *testing.T, registry *ChildrenRegistry, sysProcAttr *syscall.SysProcAttr) (parentPid int, orphanPid int) {
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60 & echo $!; wait")
+	cmd.SysProcAttr = sysProcAttr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Start(cmd, "web", "web_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphanPid, err = strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	return cmd.Process.Pid, orphanPid
+}
+
+// waitOrphanReaped scans until the orphan has been reaped.
+func waitOrphanReaped(t *testing.T, registry *ChildrenRegistry, orphanPid int) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		registry.Scan()
+
+		if _, err := readProcStat(orphanPid); err != nil {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("orphan %d was not reaped", orphanPid)
+}
+
+func TestOrphanIsAttributedToItsProgramAndTerminated(t *testing.T) {
+	registry := newTestChildrenRegistry(t)
+
+	parentPid, orphanPid := startOrphan(t, registry, &syscall.SysProcAttr{
+		Setpgid: true,
+	})
+	defer syscall.Kill(orphanPid, syscall.SIGKILL)
+
+	registry.Scan()
+
+	orphans := registry.Orphans("web")
+	if len(orphans) != 1 || orphans[0].Pid != orphanPid || orphans[0].ProcessID != "web_1" {
+		t.Fatalf("orphans of web are %+v; expected %d of process web_1", orphans, orphanPid)
+	}
+	if orphans := registry.Orphans(""); len(orphans) != 0 {
+		t.Errorf("unattributed orphans are %+v; expected none", orphans)
+	}
+
+	// The orphan stays attributed once its parent has been released.
+	registry.Release(parentPid)
+	registry.Scan()
+
+	if orphans := registry.Orphans("web"); len(orphans) != 1 || orphans[0].Pid != orphanPid {
+		t.Fatalf("orphans of web are %+v after release; expected %d", orphans, orphanPid)
+	}
+
+	registry.TerminateOrphans("web", syscall.SIGTERM, time.Second)
+
+	waitOrphanReaped(t, registry, orphanPid)
+
+	if orphans := registry.Orphans("web"); len(orphans) != 0 {
+		t.Errorf("orphans of web are %+v after termination; expected none", orphans)
+	}
+}
+
+func TestOrphanSharingTheDaemonGroupIsNotAttributed(t *testing.T) {
+	registry := newTestChildrenRegistry(t)
+
+	parentPid, orphanPid := startOrphan(t, registry, nil)
+	defer syscall.Kill(orphanPid, syscall.SIGKILL)
+
+	registry.Release(parentPid)
+	registry.Scan()
+
+	if orphans := registry.Orphans("web"); len(orphans) != 0 {
+		t.Errorf("orphans of web are %+v; expected none", orphans)
+	}
+
+	orphans := registry.Orphans("")
+	if len(orphans) != 1 || orphans[0].Pid != orphanPid {
+		t.Fatalf("unattributed orphans are %+v; expected %d", orphans, orphanPid)
+	}
+
+	registry.TerminateOrphans("", syscall.SIGKILL, 0)
+
+	waitOrphanReaped(t, registry, orphanPid)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const supervisordImportArg = "import-supervisord"
+
+// supervisordImportMain prints the configuration converted from a supervisord one.
+func supervisordImportMain(flags *flag.FlagSet, args []string) {
+	format := flags.String("f", string(ConfigFormatYaml), "Output format: yaml, json or toml")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [-f format] <supervisord.conf>\n", os.Args[0], supervisordImportArg)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	imported, err := ImportSupervisordFile(flags.Arg(0), os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	configImportPrint(imported, ConfigFormat(*format))
+}
+
+type supervisordValue struct {
+	Value string
+	Line  int
+}
+
+type supervisordSection struct {
+	Name   string
+	File   string
+	Dir    string
+	Line   int
+	Keys   []string
+	Values map[string]supervisordValue
+}
+
+// supervisordImporter reads supervisord configuration files, which are INI files
+// whose [include] sections pull other files in.
+type supervisordImporter struct {
+	sections []*supervisordSection
+	warnings []ConfigImportWarning
+	visited  map[string]bool
+
+	// Data given without a path cannot include files relative to it.
+	includes bool
+
+	// getenv expands %(ENV_*)s expressions. It is nil when importing through the API,
+	// which must not disclose the environment of the daemon.
+	getenv func(key string) string
+}
+
+// ImportSupervisordFile converts the supervisord configuration file at path, and
+// the files it includes, into programs. Environment expressions are expanded with
+// getenv, unless it is nil.
+func ImportSupervisordFile(path string, getenv func(key string) string) (*ConfigImport, error) {
+	importer := &supervisordImporter{
+		visited:  make(map[string]bool),
+		includes: true,
+		getenv:   getenv,
+	}
+
+	if err := importer.readFile(path); err != nil {
+		return nil, err
+	}
+
+	return importer.convert(), nil
+}
+
+// ImportSupervisordData converts a supervisord configuration given as a whole,
+// without following its [include] sections.
+func ImportSupervisordData(data []byte) *ConfigImport {
+	importer := &supervisordImporter{
+		visited: make(map[string]bool),
+	}
+
+	importer.parse("<data>", "", data)
+
+	return importer.convert()
+}
+
+func (importer *supervisordImporter) warn(section *supervisordSection, key string, format string, args ...interface{}) {
+	warning := ConfigImportWarning{
+		File:    section.File,
+		Line:    section.Line,
+		Section: section.Name,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if value, ok := section.Values[key]; ok {
+		warning.Line = value.Line
+	}
+
+	importer.warnings = append(importer.warnings, warning)
+}
+
+func (importer *supervisordImporter) readFile(path string) error {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if importer.visited[absolutePath] {
+		return nil
+	}
+	importer.visited[absolutePath] = true
+
+	data, err := ioutil.ReadFile(absolutePath)
+	if err != nil {
+		return err
+	}
+
+	importer.parse(path, filepath.Dir(absolutePath), data)
+
+	return nil
+}
+
+// parse reads INI sections the way supervisord does: keys are separated from values
+// by '=' or ':', indented lines continue the previous value, and comments start
+// with ';' or '#', or with ';' after a space within a line.
+func (importer *supervisordImporter) parse(file, dir string, data []byte) {
+	var (
+		section *supervisordSection
+		lastKey string
+	)
+
+	for index, line := range strings.Split(string(data), "\n") {
+		lineNumber := index + 1
+		line = strings.TrimRight(line, " \t\r")
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#' {
+			continue
+		}
+
+		if comment := strings.Index(line, " ;"); comment >= 0 {
+			line = strings.TrimRight(line[:comment], " \t")
+			trimmed = strings.TrimSpace(line)
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && section != nil && lastKey != "" {
+			value := section.Values[lastKey]
+			value.Value = strings.TrimSpace(value.Value + "\n" + trimmed)
+			section.Values[lastKey] = value
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			if section != nil {
+				importer.endSection(section, dir)
+			}
+
+			section = &supervisordSection{
+				Name:   strings.TrimSpace(trimmed[1 : len(trimmed)-1]),
+				File:   file,
+				Dir:    dir,
+				Line:   lineNumber,
+				Values: make(map[string]supervisordValue),
+			}
+			lastKey = ""
+			continue
+		}
+
+		separator := strings.IndexAny(trimmed, "=:")
+		if section == nil || separator < 0 {
+			importer.warnings = append(importer.warnings, ConfigImportWarning{
+				File:    file,
+				Line:    lineNumber,
+				Message: "line ignored, it is neither a section nor a key",
+			})
+			continue
+		}
+
+		lastKey = strings.ToLower(strings.TrimSpace(trimmed[:separator]))
+		if _, ok := section.Values[lastKey]; !ok {
+			section.Keys = append(section.Keys, lastKey)
+		}
+		section.Values[lastKey] = supervisordValue{
+			Value: strings.TrimSpace(trimmed[separator+1:]),
+			Line:  lineNumber,
+		}
+	}
+
+	if section != nil {
+		importer.endSection(section, dir)
+	}
+}
+
+func (importer *supervisordImporter) endSection(section *supervisordSection, dir string) {
+	if section.Name != "include" {
+		importer.sections = append(importer.sections, section)
+		return
+	}
+
+	if !importer.includes {
+		importer.warn(section, "files", "included files are only read when importing a file")
+		return
+	}
+
+	for _, pattern := range strings.Fields(section.Values["files"].Value) {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			importer.warn(section, "files", "invalid pattern %s: %v", pattern, err)
+			continue
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			if err := importer.readFile(path); err != nil {
+				importer.warn(section, "files", "could not read %s: %v", path, err)
+			}
+		}
+	}
+}
+
+func (importer *supervisordImporter) convert() *ConfigImport {
+	programs := ProgramsYaml{
+		Programs: make(map[string]ProgramYaml),
+	}
+
+	for _, section := range importer.sections {
+		if !strings.HasPrefix(section.Name, "program:") {
+			importer.warn(section, "", "section is not supported")
+			continue
+		}
+
+		name := strings.TrimPrefix(section.Name, "program:")
+		if _, ok := programs.Programs[name]; ok {
+			importer.warn(section, "", "program is defined several times, the last definition is kept")
+		}
+
+		programs.Programs[name] = importer.convertProgram(name, section)
+	}
+
+	return &ConfigImport{
+		Programs: programs,
+		Warnings: append(importer.warnings, configImportValidationWarnings(programs)...),
+	}
+}
+
+func (importer *supervisordImporter) convertProgram(name string, section *supervisordSection) ProgramYaml {
+	var program ProgramYaml
+
+	// supervisord considers programs started after 1 second by default, not 5.
+	starttime := 1
+	program.Starttime = &starttime
+
+	for _, key := range section.Keys {
+		value := supervisordExpand(section.Values[key].Value, name, section.Dir, importer.getenv)
+
+		invalid := func() {
+			importer.warn(section, key, "invalid value %q, ignored", value)
+		}
+
+		if importer.getenv == nil && supervisordEnvExpansion.MatchString(value) {
+			importer.warn(section, key, "environment variables are only expanded by the %s subcommand", supervisordImportArg)
+		}
+		if strings.Contains(value, "%("+ExpansionProcessNum+")") {
+			importer.warn(section, key, "process_num starts at 1, not at 0 as with supervisord")
+		}
+
+		switch key {
+		case "command":
+			// Continuation lines are arguments, as supervisord splits commands on any space.
+			value = strings.Replace(value, "\n", " ", -1)
+			program.Cmd = &value
+		case "directory":
+			program.Workingdir = &value
+		case "umask":
+			program.Umask = &value
+		case "user":
+			program.User = &value
+		case "stdout_logfile":
+			program.Stdout = &value
+		case "stderr_logfile":
+			program.Stderr = &value
+		case "numprocs":
+			if number, err := strconv.Atoi(value); err == nil {
+				program.Numprocs = &number
+			} else {
+				invalid()
+			}
+		case "startretries":
+			if number, err := strconv.Atoi(value); err == nil {
+				program.Startretries = &number
+			} else {
+				invalid()
+			}
+		case "startsecs":
+			if number, err := strconv.Atoi(value); err == nil {
+				program.Starttime = &number
+			} else {
+				invalid()
+			}
+		case "stopwaitsecs":
+			if number, err := strconv.Atoi(value); err == nil {
+				program.Stoptime = &number
+			} else {
+				invalid()
+			}
+		case "autostart":
+			if boolean, ok := supervisordBool(value); ok {
+				program.Autostart = &boolean
+			} else {
+				invalid()
+			}
+		case "autorestart":
+			autorestart := AutorestartType(strings.ToLower(value))
+			if boolean, ok := supervisordBool(value); ok {
+				autorestart = AutorestartType(strconv.FormatBool(boolean))
+			}
+
+			if autorestart.Valid() {
+				program.Autorestart = &autorestart
+			} else {
+				invalid()
+			}
+		case "stopsignal":
+			signal := StopSignal(strings.TrimPrefix(strings.ToUpper(value), "SIG"))
+			if signal.Valid() {
+				program.Stopsignal = &signal
+			} else {
+				invalid()
+			}
+		case "exitcodes":
+			exitcodes := []interface{}{}
+			for _, exitcode := range strings.Split(value, ",") {
+				number, err := strconv.Atoi(strings.TrimSpace(exitcode))
+				if err != nil {
+					exitcodes = nil
+					break
+				}
+				exitcodes = append(exitcodes, number)
+			}
+
+			if exitcodes != nil {
+				program.Exitcodes = exitcodes
+			} else {
+				invalid()
+			}
+		case "environment":
+			env, err := supervisordEnvironment(value)
+			if err != nil {
+				importer.warn(section, key, "%v, ignored", err)
+			} else {
+				program.Env = EnvYamlFromValues(env)
+			}
+		default:
+			importer.warn(section, key, "key is not supported, ignored")
+		}
+	}
+
+	return program
+}
+
+var (
+	supervisordExpansion    = regexp.MustCompile(`%\(([a-zA-Z0-9_]+)\)[sd]`)
+	supervisordEnvExpansion = regexp.MustCompile(`%\(ENV_[a-zA-Z0-9_]+\)[sd]`)
+)
+
+// supervisordExpand replaces the expressions supervisord expands when reading its
+// configuration, here being the directory of the file. Others, such as process_num,
+// are kept as they are, to be expanded for each process, as are environment
+// expressions without getenv.
+func supervisordExpand(value, programName, here string, getenv func(key string) string) string {
+	return supervisordExpansion.ReplaceAllStringFunc(value, func(expression string) string {
+		name := supervisordExpansion.FindStringSubmatch(expression)[1]
+
+		switch {
+		case name == "program_name":
+			return programName
+		case name == "here" && here != "":
+			return here
+		case strings.HasPrefix(name, "ENV_") && getenv != nil:
+			return getenv(strings.TrimPrefix(name, "ENV_"))
+		default:
+			return expression
+		}
+	})
+}
+
+func supervisordBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// supervisordEnvironment parses KEY="value",OTHER=value lists, whose values may
+// hold commas when they are quoted.
+func supervisordEnvironment(value string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	var (
+		pairs   []string
+		current strings.Builder
+		quote   rune
+	)
+	for _, char := range value {
+		switch {
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote == 0 && (char == '"' || char == '\''):
+			quote = char
+		case quote == 0 && char == ',':
+			pairs = append(pairs, current.String())
+			current.Reset()
+			continue
+		default:
+			current.WriteRune(char)
+			continue
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", value)
+	}
+	pairs = append(pairs, current.String())
+
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		separator := strings.Index(pair, "=")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid variable %q", pair)
+		}
+
+		env[strings.TrimSpace(pair[:separator])] = pair[separator+1:]
+	}
+
+	return env, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportSupervisordFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskmasterd-supervisord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"supervisord.conf": `; supervisord configuration
+[supervisord]
+logfile=/tmp/supervisord.log
+
+[program:web]
+command=/bin/web --port 80 ; inline comment
+numprocs=2
+directory=%(here)s
+autorestart=false
+exitcodes=0,2
+startsecs=3
+stopsignal=SIGQUIT
+stopwaitsecs=7
+stdout_logfile=/tmp/%(program_name)s.out
+environment=A="1",B="x,y"
+priority=10
+
+[include]
+files = conf.d/*.conf
+`,
+		"conf.d/worker.conf": `[program:worker]
+command=/bin/worker
+    --verbose
+autostart=no
+startretries=many
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imported, err := ImportSupervisordFile(filepath.Join(dir, "supervisord.conf"), os.Getenv)
+	if err != nil {
+		t.Fatalf("Could not import configuration: %v", err)
+	}
+
+	expected := map[string]ProgramYaml{
+		"web": {
+			Cmd:         strToPointer("/bin/web --port 80"),
+			Numprocs:    intToPointer(2),
+			Workingdir:  strToPointer(dir),
+			Autorestart: autorestartTypeToPointer(AutorestartOff),
+			Exitcodes:   []interface{}{0, 2},
+			Starttime:   intToPointer(3),
+			Stopsignal:  stopSignalToPointer(StopSignalQuit),
+			Stoptime:    intToPointer(7),
+			Stdout:      strToPointer("/tmp/web.out"),
+			Env: EnvYamlFromValues(map[string]string{
+				"A": "1",
+				"B": "x,y",
+			}),
+		},
+		"worker": {
+			Cmd:       strToPointer("/bin/worker --verbose"),
+			Autostart: boolToPointer(false),
+			// supervisord default, which differs from taskmaster one.
+			Starttime: intToPointer(1),
+		},
+	}
+
+	if !reflect.DeepEqual(imported.Programs.Programs, expected) {
+		t.Errorf("Imported programs are %+v; expected %+v", imported.Programs.Programs, expected)
+	}
+
+	warned := make(map[string]bool)
+	for _, warning := range imported.Warnings {
+		warned[warning.Section+" "+warning.Key] = true
+	}
+	for _, expectedWarning := range []string{
+		"supervisord ",
+		"program:web priority",
+		"program:worker startretries",
+	} {
+		if !warned[expectedWarning] {
+			t.Errorf("Missing warning about %q in %v", expectedWarning, imported.Warnings)
+		}
+	}
+	if len(imported.Warnings) != 3 {
+		t.Errorf("Unexpected warnings: %v", imported.Warnings)
+	}
+}
+
+func TestImportSupervisordDataDoesNotInclude(t *testing.T) {
+	imported := ImportSupervisordData([]byte("[include]\nfiles = /etc/supervisor/conf.d/*.conf\n"))
+
+	if len(imported.Programs.Programs) != 0 {
+		t.Errorf("Unexpected programs: %v", imported.Programs.Programs)
+	}
+	if len(imported.Warnings) != 1 || imported.Warnings[0].Key != "files" {
+		t.Errorf("Unexpected warnings: %v", imported.Warnings)
+	}
+}
+
+func TestImportSupervisordDataDoesNotExpandEnvironment(t *testing.T) {
+	os.Setenv("TASKMASTERD_TEST_SECRET", "secret-value")
+	defer os.Unsetenv("TASKMASTERD_TEST_SECRET")
+
+	imported := ImportSupervisordData([]byte("[program:web]\ncommand=/bin/web %(ENV_TASKMASTERD_TEST_SECRET)s\n"))
+
+	program, ok := imported.Programs.Programs["web"]
+	if !ok || program.Cmd == nil {
+		t.Fatalf("Unexpected programs: %v", imported.Programs.Programs)
+	}
+	if strings.Contains(*program.Cmd, "secret-value") {
+		t.Errorf("Environment of the daemon has been expanded in %q", *program.Cmd)
+	}
+
+	warned := false
+	for _, warning := range imported.Warnings {
+		if warning.Key == "command" && strings.Contains(warning.Message, supervisordImportArg) {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Errorf("Unexpanded environment has not been warned about: %v", imported.Warnings)
+	}
+}
+
+func TestImportSupervisordFileRequiresUnixSocket(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/configuration/import/supervisord", strings.NewReader(`{"path": "/etc/shadow"}`))
+
+	httpEndpointImportSupervisord(nil, recorder, request)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Responded %d; expected %d", recorder.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(recorder.Body.String(), "unix socket") {
+		t.Errorf("Unexpected response %s", recorder.Body.String())
+	}
+}
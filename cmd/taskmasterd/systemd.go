@@ -0,0 +1,330 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/42Taskmaster/taskmaster/parser"
+)
+
+const systemdExportArg = "export-systemd"
+
+// systemdInstance stands for the instance specifier while units are written, as
+// specifiers of values are escaped. It must survive the parsing of commands.
+const systemdInstance = "@taskmaster-systemd-instance@"
+
+// systemdExportMain writes a systemd unit for every program of a configuration
+// file, or prints them when no directory is given.
+func systemdExportMain(flags *flag.FlagSet, args []string) {
+	configPath := flags.String("c", configDefaultPath, "Config file location path")
+	format := flags.String("f", "", "Config file format: yaml, json or toml, guessed from its extension by default")
+	outputDir := flags.String("o", "", "Directory to write units to, instead of printing them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [-c config] [-f format] [-o dir]\n", os.Args[0], systemdExportArg)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	configFormat := ConfigFormat(*format)
+	if configFormat == "" {
+		configFormat = configFormatFromPath(*configPath)
+	}
+
+	file, err := os.Open(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	_, programsConfigurations, err := configParse(file, configFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		os.Exit(1)
+	}
+
+	for _, unit := range ExportSystemdUnits(programsConfigurations) {
+		if *outputDir == "" {
+			fmt.Printf("# %s\n%s\n", unit.Name, unit.Data)
+			continue
+		}
+
+		path := filepath.Join(*outputDir, unit.Name)
+		if err := ioutil.WriteFile(path, []byte(unit.Data), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "wrote", path)
+	}
+}
+
+// SystemdUnit is a service unit file, named after the program it runs.
+type SystemdUnit struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+// ExportSystemdUnits converts every program into a service unit. Programs with
+// several processes become template units, of which an instance is enabled per
+// process.
+func ExportSystemdUnits(configs ProgramsConfigurations) []SystemdUnit {
+	programNames := make([]string, 0, len(configs))
+	for programName := range configs {
+		programNames = append(programNames, programName)
+	}
+	sort.Strings(programNames)
+
+	units := make([]SystemdUnit, 0, len(programNames))
+	for _, programName := range programNames {
+		units = append(units, ExportSystemdUnit(programName, configs[programName]))
+	}
+
+	return units
+}
+
+func ExportSystemdUnit(programName string, config ProgramConfiguration) SystemdUnit {
+	name := systemdEscapeName(programName)
+	if config.Numprocs > 1 {
+		name += "@"
+	}
+	name += ".service"
+
+	var unit strings.Builder
+
+	// Instances of template units are numbered as processes are, systemd giving
+	// their number. Ports cannot be computed by systemd.
+	expansions := config.ProcessExpansions(createProcessName(programName, 1))
+	if config.Numprocs > 1 {
+		expansions[ExpansionProcessNum] = systemdInstance
+		expansions[ExpansionProcessID] = strings.ReplaceAll(programName, " ", "-") + "_" + systemdInstance
+	}
+	config = config.Expanded(expansions)
+
+	unit.WriteString("[Unit]\n")
+	fmt.Fprintf(&unit, "Description=%s\n", systemdEscapeSpecifiers("Taskmaster program "+programName))
+
+	unit.WriteString("\n[Service]\n")
+	unit.WriteString("Type=simple\n")
+	fmt.Fprintf(&unit, "ExecStart=%s\n", systemdExecStart(config))
+
+	if config.Workingdir != "" {
+		fmt.Fprintf(&unit, "WorkingDirectory=%s\n", systemdEscapeSpecifiers(config.Workingdir))
+	}
+
+	envNames := make([]string, 0, len(config.Env))
+	for envName := range config.Env {
+		envNames = append(envNames, envName)
+	}
+	sort.Strings(envNames)
+
+	for _, envFile := range config.EnvFilePaths() {
+		fmt.Fprintf(&unit, "EnvironmentFile=%s\n", systemdEscapeSpecifiers(envFile))
+	}
+	for _, envName := range envNames {
+		fmt.Fprintf(&unit, "Environment=%s\n", systemdQuote(envName+"="+config.Env[envName]))
+	}
+
+	secretNames := make([]string, 0, len(config.EnvSecrets))
+	for secretName := range config.EnvSecrets {
+		secretNames = append(secretNames, secretName)
+	}
+	sort.Strings(secretNames)
+
+	for _, secretName := range secretNames {
+		fmt.Fprintf(&unit, "# %s references a secret, which must be provided separately.\n", secretName)
+	}
+
+	if config.Numprocs > 1 && config.BasePort != 0 {
+		unit.WriteString("# Ports are the ones of the first instance, as systemd cannot compute them.\n")
+	}
+
+	if config.Umask != "" {
+		fmt.Fprintf(&unit, "UMask=%s\n", config.Umask)
+	}
+	if config.User != "" {
+		fmt.Fprintf(&unit, "User=%s\n", config.User)
+	}
+	if config.Group != "" {
+		fmt.Fprintf(&unit, "Group=%s\n", config.Group)
+	}
+
+	switch config.Autorestart {
+	case AutorestartOn:
+		unit.WriteString("Restart=always\n")
+	case AutorestartUnexpected:
+		unit.WriteString("Restart=on-failure\n")
+	default:
+		unit.WriteString("Restart=no\n")
+	}
+
+	var successExitStatus []string
+	for _, exitcode := range config.Exitcodes {
+		if exitcode != 0 {
+			successExitStatus = append(successExitStatus, strconv.Itoa(exitcode))
+		}
+	}
+	if len(successExitStatus) > 0 {
+		fmt.Fprintf(&unit, "SuccessExitStatus=%s\n", strings.Join(successExitStatus, " "))
+	}
+
+	// systemd sends a single signal, then SIGKILL once every step had its time.
+	stoptime := 0
+	for _, step := range config.Stopsequence {
+		stoptime += step.Wait
+	}
+	if len(config.Stopsequence) > 1 {
+		unit.WriteString("# Only the first signal of the stop sequence is sent.\n")
+	}
+	if len(config.Stopsequence) > 0 {
+		fmt.Fprintf(&unit, "KillSignal=SIG%s\n", config.Stopsequence[0].Signal)
+	} else {
+		fmt.Fprintf(&unit, "KillSignal=SIG%s\n", config.Stopsignal)
+		stoptime = config.Stoptime
+	}
+	fmt.Fprintf(&unit, "TimeoutStopSec=%d\n", stoptime)
+
+	if path := systemdOutput(config.Stdout); path != "" {
+		fmt.Fprintf(&unit, "StandardOutput=%s\n", path)
+	}
+	if path := systemdOutput(config.Stderr); path != "" {
+		fmt.Fprintf(&unit, "StandardError=%s\n", path)
+	}
+
+	if config.Nice != nil {
+		fmt.Fprintf(&unit, "Nice=%d\n", *config.Nice)
+	}
+	if config.Oomscoreadj != nil {
+		fmt.Fprintf(&unit, "OOMScoreAdjust=%d\n", *config.Oomscoreadj)
+	}
+
+	limits := []struct {
+		Directive string
+		Value     *int64
+	}{
+		{"LimitNOFILE", config.Rlimits.Nofile},
+		{"LimitCORE", config.Rlimits.Core},
+		{"LimitAS", config.Rlimits.As},
+		{"LimitCPU", config.Rlimits.Cpu},
+		{"LimitNPROC", config.Rlimits.Nproc},
+	}
+	for _, limit := range limits {
+		if limit.Value == nil {
+			continue
+		}
+
+		if *limit.Value == RlimitUnlimited {
+			fmt.Fprintf(&unit, "%s=infinity\n", limit.Directive)
+		} else {
+			fmt.Fprintf(&unit, "%s=%d\n", limit.Directive, *limit.Value)
+		}
+	}
+
+	if config.Autostart {
+		unit.WriteString("\n[Install]\n")
+		unit.WriteString("WantedBy=multi-user.target\n")
+	}
+
+	return SystemdUnit{
+		Name: name,
+		Data: strings.Replace(unit.String(), systemdInstance, "%i", -1),
+	}
+}
+
+// systemdExecStart builds the command line the way processes are started, split
+// into arguments. Variables are left for systemd to expand from the environment
+// of the unit, as the one of the daemon must not end up in exported units. The
+// executable is resolved, as systemd only searches a fixed PATH.
+func systemdExecStart(config ProgramConfiguration) string {
+	parsedCommand, err := parser.ParseCommand(config.Cmd)
+	if err != nil || parsedCommand.Cmd == "" {
+		return systemdEscapeSpecifiers(config.Cmd)
+	}
+
+	executable := parsedCommand.Cmd
+	if !strings.Contains(executable, "$") {
+		env, _ := config.CreateCmdEnvironment(nil)
+		if path, err := config.lookPath(executable, env); err == nil {
+			executable = path
+		}
+		if strings.Contains(executable, "/") && !filepath.IsAbs(executable) && config.Workingdir != "" {
+			executable = filepath.Join(config.Workingdir, executable)
+		}
+	}
+
+	words := make([]string, 0, len(parsedCommand.Args)+1)
+	for _, word := range append([]string{executable}, parsedCommand.Args...) {
+		words = append(words, systemdQuote(systemdVariables(word)))
+	}
+
+	return strings.Join(words, " ")
+}
+
+var systemdVariable = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}|\$([A-Za-z0-9_]+)|\$`)
+
+// systemdVariables writes the variables of a word as ${NAME}, which systemd
+// expands without splitting them into several arguments, and escapes any other
+// dollar sign.
+func systemdVariables(word string) string {
+	return systemdVariable.ReplaceAllStringFunc(word, func(match string) string {
+		if match == "$" {
+			return "$$"
+		}
+		return "${" + strings.Trim(match, "${}") + "}"
+	})
+}
+
+// systemdOutput gives where systemd must write an output of processes, or an
+// empty string for the journal, which replaces the files of AUTO.
+func systemdOutput(path string) string {
+	switch path {
+	case "", string(StdTypeAuto):
+		return ""
+	case string(StdTypeNone):
+		return "null"
+	default:
+		return "append:" + systemdEscapeSpecifiers(path)
+	}
+}
+
+// systemdQuote double-quotes a word when systemd would otherwise split it or
+// interpret some of its characters.
+func systemdQuote(word string) string {
+	word = systemdEscapeSpecifiers(word)
+
+	if word != "" && word != ";" && !strings.ContainsAny(word, " \t\"'\\") {
+		return word
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
+
+func systemdEscapeSpecifiers(value string) string {
+	return strings.Replace(value, "%", "%%", -1)
+}
+
+// systemdEscapeName escapes the characters unit names cannot hold, as
+// systemd-escape does.
+func systemdEscapeName(name string) string {
+	var escaped strings.Builder
+
+	for index := 0; index < len(name); index++ {
+		char := name[index]
+
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9',
+			char == ':', char == '_', char == '-' && index > 0, char == '.' && index > 0:
+			escaped.WriteByte(char)
+		default:
+			fmt.Fprintf(&escaped, `\x%02x`, char)
+		}
+	}
+
+	return escaped.String()
+}
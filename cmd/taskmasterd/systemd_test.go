@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportSystemdUnit(t *testing.T) {
+	programsYaml := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd:         strToPointer(`/bin/web --title "my web" --rate 100%`),
+				Numprocs:    intToPointer(2),
+				Workingdir:  strToPointer("/srv/web"),
+				Umask:       strToPointer("022"),
+				Autorestart: autorestartTypeToPointer(AutorestartUnexpected),
+				Exitcodes:   []interface{}{0, 2},
+				Stopsignal:  stopSignalToPointer(StopSignalQuit),
+				Stoptime:    intToPointer(7),
+				Stdout:      strToPointer("/var/log/web.log"),
+				Stderr:      strToPointer(string(StdTypeNone)),
+				Env: EnvYamlFromValues(map[string]string{
+					"B": "two words",
+					"A": "1",
+				}),
+			},
+		},
+	}
+
+	configs, err := programsYaml.Validate()
+	if err != nil {
+		t.Fatalf("Could not validate configuration: %v", err)
+	}
+
+	units := ExportSystemdUnits(configs)
+	if len(units) != 1 {
+		t.Fatalf("Exported %d units; expected 1", len(units))
+	}
+
+	if units[0].Name != "web@.service" {
+		t.Errorf("Unit is named %q; expected a template unit", units[0].Name)
+	}
+
+	for _, expectedLine := range []string{
+		`ExecStart=/bin/web --title "my web" --rate 100%%`,
+		"WorkingDirectory=/srv/web",
+		`Environment=A=1`,
+		`Environment="B=two words"`,
+		"UMask=022",
+		"Restart=on-failure",
+		"SuccessExitStatus=2",
+		"KillSignal=SIGQUIT",
+		"TimeoutStopSec=7",
+		"StandardOutput=append:/var/log/web.log",
+		"StandardError=null",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(units[0].Data, expectedLine+"\n") {
+			t.Errorf("Missing %q in unit:\n%s", expectedLine, units[0].Data)
+		}
+	}
+}
+
+func TestExportSystemdUnitMapsAutorestart(t *testing.T) {
+	tests := map[AutorestartType]string{
+		AutorestartOn:  "Restart=always",
+		AutorestartOff: "Restart=no",
+	}
+
+	for autorestart, expectedLine := range tests {
+		programsYaml := ProgramsYaml{
+			Programs: map[string]ProgramYaml{
+				"job": {
+					Cmd:         strToPointer("/bin/job"),
+					Autostart:   boolToPointer(false),
+					Autorestart: autorestartTypeToPointer(autorestart),
+				},
+			},
+		}
+
+		configs, err := programsYaml.Validate()
+		if err != nil {
+			t.Fatalf("Could not validate configuration: %v", err)
+		}
+
+		unit := ExportSystemdUnit("job", configs["job"])
+		if unit.Name != "job.service" {
+			t.Errorf("Unit is named %q; expected job.service", unit.Name)
+		}
+		if !strings.Contains(unit.Data, expectedLine+"\n") {
+			t.Errorf("Missing %q in unit:\n%s", expectedLine, unit.Data)
+		}
+		if strings.Contains(unit.Data, "[Install]") {
+			t.Errorf("Program not started automatically should not be installed:\n%s", unit.Data)
+		}
+	}
+}
+
+func TestExportSystemdUnitLeavesVariablesToSystemd(t *testing.T) {
+	os.Setenv("TASKMASTER_DAEMON_ONLY", "daemon-value")
+	defer os.Unsetenv("TASKMASTER_DAEMON_ONLY")
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := ProgramConfiguration{
+		Cmd:        "tool $TASKMASTER_DAEMON_ONLY ${NAME}.log 5$",
+		InheritEnv: true,
+		Env: map[string]string{
+			"PATH": dir,
+			"NAME": "tool",
+		},
+	}
+
+	expected := "ExecStart=" + filepath.Join(dir, "tool") + " ${TASKMASTER_DAEMON_ONLY} ${NAME}.log 5$$"
+	if execStart := "ExecStart=" + systemdExecStart(config); execStart != expected {
+		t.Errorf("Exported %q; expected %q", execStart, expected)
+	}
+}
@@ -32,6 +32,7 @@ const (
 	TaskmasterdTaskActionRefreshConfigurationFromReader            TaskAction = "TASKMASTERD_REFRESH_CONFIGURATION_FROM_READER"
 	TaskmasterdTaskActionGetProgramsConfigurations                 TaskAction = "TASKMASTERD_GET_PROGRAMS_CONFIGURATIONS"
 	TaskmasterdTaskActionPersistProgramsToDisk                     TaskAction = "TASKMASTERD_PERSIST_PROGRAMS_TO_DISK"
+	TaskmasterdTaskActionCommitProgram                             TaskAction = "TASKMASTERD_COMMIT_PROGRAM"
 
 	ProgramTaskActionGet            TaskAction = "PROGRAM_GET"
 	ProgramTaskActionGetAll         TaskAction = "PROGRAM_GET_ALL"
@@ -43,10 +44,19 @@ const (
 	ProgramTaskActionKill           TaskAction = "PROGRAM_KILL"
 	ProgramTaskActionRestart        TaskAction = "PROGRAM_RESTART"
 	ProgramTaskActionRestartAll     TaskAction = "PROGRAM_RESTART_ALL"
+	ProgramTaskActionPause          TaskAction = "PROGRAM_PAUSE"
+	ProgramTaskActionPauseAll       TaskAction = "PROGRAM_PAUSE_ALL"
+	ProgramTaskActionResume         TaskAction = "PROGRAM_RESUME"
+	ProgramTaskActionResumeAll      TaskAction = "PROGRAM_RESUME_ALL"
 	ProgramTaskActionRemove         TaskAction = "PROGRAM_REMOVE"
 	ProgramTaskActionSetConfig      TaskAction = "PROGRAM_SET_CONFIG"
 	ProgramTaskActionGetConfig      TaskAction = "PROGRAM_GET_CONFIG"
 
+	ProgramTaskActionGetProcessConfig TaskAction = "PROGRAM_GET_PROCESS_CONFIG"
+	ProgramTaskActionCanary           TaskAction = "PROGRAM_CANARY"
+	ProgramTaskActionEndCanary        TaskAction = "PROGRAM_END_CANARY"
+	ProgramTaskActionGetCanary        TaskAction = "PROGRAM_GET_CANARY"
+
 	ProcessTaskActionGetContext                  TaskAction = "PROCESS_GET_CONTEXT"
 	ProcessTaskActionSerialize                   TaskAction = "PROCESS_SERIALIZE"
 	ProcessTaskActionCreateNewDeadChannel        TaskAction = "PROCESS_CREATE_NEW_DEAD_CHANNEL"
@@ -56,13 +66,17 @@ const (
 	ProcessTaskActionGetStateMachineCurrentState TaskAction = "PROCESS_GET_STATE_MACHINE_CURRENT_STATE"
 	ProcessTaskActionSetCmd                      TaskAction = "PROCESS_SET_CMD"
 	ProcessTaskActionSetStdoutStderrCloser       TaskAction = "PROCESS_SET_STDOUT_STDERR_CLOSER"
+	ProcessTaskActionAppendHistory               TaskAction = "PROCESS_APPEND_HISTORY"
 	ProcessTaskActionStart                       TaskAction = "PROCESS_START"
 	ProcessTaskActionStop                        TaskAction = "PROCESS_STOP"
 	ProcessTaskActionRestart                     TaskAction = "PROCESS_RESTART"
+	ProcessTaskActionPause                       TaskAction = "PROCESS_PAUSE"
+	ProcessTaskActionResume                      TaskAction = "PROCESS_RESUME"
 	ProcessTaskActionKill                        TaskAction = "PROCESS_KILL"
 
-	ProcessTaskActionStartChronometer TaskAction = "PROCESS_START_CHRONOMETER"
-	ProcessTaskActionStopChronometer  TaskAction = "PROCESS_STOP_CHRONOMETER"
+	ProcessTaskActionStartChronometer   TaskAction = "PROCESS_START_CHRONOMETER"
+	ProcessTaskActionStopChronometer    TaskAction = "PROCESS_STOP_CHRONOMETER"
+	ProcessTaskActionRestoreChronometer TaskAction = "PROCESS_RESTORE_CHRONOMETER"
 )
 
 type TaskBase struct {
@@ -96,7 +110,8 @@ type TaskmasterdTaskGetAll struct {
 type TaskmasterdTaskAdd struct {
 	TaskBase
 
-	Program Program
+	Program       Program
+	Configuration ProgramConfiguration
 }
 
 type TaskmasterdTaskAddProgram struct {
@@ -111,9 +126,17 @@ type TaskmasterdTaskEditProgram struct {
 
 	ProgramId            string
 	ProgramConfiguration ProgramYaml
+	Canary               *CanaryOptions
 	ErrorChan            chan<- error
 }
 
+type TaskmasterdTaskCommitProgram struct {
+	TaskBase
+
+	ProgramId            string
+	ProgramConfiguration ProgramYaml
+}
+
 type TaskmasterdTaskDeleteProgram struct {
 	TaskBase
 
@@ -168,6 +191,13 @@ type ProgramTaskRootActionWithPayload struct {
 	Payload interface{}
 }
 
+type ProgramTaskCanary struct {
+	ProgramTaskRootAction
+
+	Args      ProgramCanaryArgs
+	ErrorChan chan<- error
+}
+
 type ProcessTaskWithResponse struct {
 	ProcessTask
 
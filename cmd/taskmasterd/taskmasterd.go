@@ -1,14 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"sort"
-
-	"gopkg.in/yaml.v2"
 )
 
 const VERSION = "1.0.0"
@@ -25,7 +27,14 @@ type Taskmasterd struct {
 	Context context.Context
 	Cancel  context.CancelFunc
 
+	Listener net.Listener
+
 	Closed chan struct{}
+
+	// HandedOver is closed when the daemon exits to let a new one take over.
+	HandedOver     chan struct{}
+	upgrading      chan struct{}
+	handoverWriter *os.File
 }
 
 type NewTaskmasterdArgs struct {
@@ -33,6 +42,7 @@ type NewTaskmasterdArgs struct {
 	ProgramsConfiguration ProgramsYaml
 	Context               context.Context
 	Cancel                context.CancelFunc
+	Listener              net.Listener
 }
 
 func NewTaskmasterd(args NewTaskmasterdArgs) *Taskmasterd {
@@ -41,8 +51,11 @@ func NewTaskmasterd(args NewTaskmasterdArgs) *Taskmasterd {
 		ProgramsConfiguration: args.ProgramsConfiguration,
 		Context:               args.Context,
 		Cancel:                args.Cancel,
+		Listener:              args.Listener,
 		ProgramTaskChan:       make(chan Tasker),
 		Closed:                make(chan struct{}),
+		HandedOver:            make(chan struct{}),
+		upgrading:             make(chan struct{}, 1),
 	}
 
 	go taskmasterd.WaitDeath()
@@ -65,6 +78,14 @@ func copyProgramMap(programs map[string]Program) map[string]Program {
 func (taskmasterd *Taskmasterd) WaitDeath() {
 	<-taskmasterd.Context.Done()
 
+	// Processes are left running for the new daemon to adopt them.
+	select {
+	case <-taskmasterd.HandedOver:
+		close(taskmasterd.Closed)
+		return
+	default:
+	}
+
 	programsClosed := make(chan struct{})
 
 	programs, err := taskmasterd.GetPrograms()
@@ -117,9 +138,11 @@ func (taskmasterd *Taskmasterd) Monitor() {
 			taskmasterdTask := task.(TaskmasterdTaskAdd)
 
 			program := taskmasterdTask.Program
-			programs[program.configuration.Name] = program
-			if program.configuration.Autostart {
+			programs[program.name] = program
+			if programShouldStart(taskmasterdTask.Configuration) {
 				program.Start()
+			} else if taskmasterdTask.Configuration.Autostart {
+				log.Printf("Program '%s' has been stopped by an operator, not starting it", program.name)
 			}
 		case TaskmasterdTaskActionRemove:
 			taskmasterdTask := task.(TaskmasterdTask)
@@ -128,6 +151,8 @@ func (taskmasterd *Taskmasterd) Monitor() {
 			delete(programs, taskmasterdTask.ProgramID)
 			program.Stop()
 
+			taskmasterd.clearOverride(taskmasterdTask.ProgramID)
+
 		case TaskmasterdTaskActionGetProgramsConfigurations:
 			getProgramsConfigurationsTask := task.(TaskmasterdTaskGetProgramsConfigurations)
 
@@ -141,7 +166,7 @@ func (taskmasterd *Taskmasterd) Monitor() {
 				break
 			}
 
-			programsYamlConfiguration, programsConfigurations, err := configParse(configReader)
+			programsYamlConfiguration, programsConfigurations, err := configParse(configReader, taskmasterd.Args.ConfigFormat())
 
 			taskmasterd.ProgramsConfiguration = programsYamlConfiguration
 
@@ -152,7 +177,9 @@ func (taskmasterd *Taskmasterd) Monitor() {
 			programConfiguration := addProgramConfigurationTask.ProgramConfiguration
 
 			configuration, err := programConfiguration.Validate(ProgramYamlValidateArgs{
-				PickProgramName: true,
+				PickProgramName:      true,
+				Secrets:              taskmasterd.ProgramsConfiguration.Secrets,
+				SensitiveEnvPatterns: taskmasterd.ProgramsConfiguration.SensitiveEnvPatterns,
 			})
 			if err != nil {
 				addProgramConfigurationTask.ErrorChan <- err
@@ -181,13 +208,31 @@ func (taskmasterd *Taskmasterd) Monitor() {
 			programConfiguration := editProgramTask.ProgramConfiguration
 
 			configuration, err := programConfiguration.Validate(ProgramYamlValidateArgs{
-				PickProgramName: true,
+				PickProgramName:      true,
+				Secrets:              taskmasterd.ProgramsConfiguration.Secrets,
+				SensitiveEnvPatterns: taskmasterd.ProgramsConfiguration.SensitiveEnvPatterns,
 			})
 			if err != nil {
 				editProgramTask.ErrorChan <- err
 				break
 			}
 
+			if editProgramTask.Canary != nil {
+				if editProgramTask.ProgramId != configuration.Name {
+					editProgramTask.ErrorChan <- ErrCanaryRename
+					break
+				}
+
+				program, ok := programs[editProgramTask.ProgramId]
+				if !ok {
+					editProgramTask.ErrorChan <- fmt.Errorf("program not found")
+					break
+				}
+
+				go taskmasterd.CanaryProgramConfiguration(program, configuration, editProgramTask)
+				break
+			}
+
 			if editProgramTask.ProgramId != configuration.Name {
 				program, ok := programs[editProgramTask.ProgramId]
 				if !ok {
@@ -209,12 +254,27 @@ func (taskmasterd *Taskmasterd) Monitor() {
 
 			close(editProgramTask.ErrorChan)
 
+		case TaskmasterdTaskActionCommitProgram:
+			commitProgramTask := task.(TaskmasterdTaskCommitProgram)
+
+			if _, ok := programs[commitProgramTask.ProgramId]; !ok {
+				break
+			}
+
+			taskmasterd.ProgramsConfiguration.Programs[commitProgramTask.ProgramId] = commitProgramTask.ProgramConfiguration
+
+			if err := taskmasterd.PersistProgramsConfigurationsToDisk(); err != nil {
+				log.Printf("Could not persist configuration of program '%s': %v", commitProgramTask.ProgramId, err)
+			}
+
 		case TaskmasterdTaskActionDeleteProgram:
 			deleteProgramTask := task.(TaskmasterdTaskDeleteProgram)
 
 			delete(programs, deleteProgramTask.ProgramId)
 			delete(taskmasterd.ProgramsConfiguration.Programs, deleteProgramTask.ProgramId)
 
+			taskmasterd.clearOverride(deleteProgramTask.ProgramId)
+
 			if err := taskmasterd.PersistProgramsConfigurationsToDisk(); err != nil {
 				deleteProgramTask.ErrorChan <- err
 				break
@@ -225,7 +285,13 @@ func (taskmasterd *Taskmasterd) Monitor() {
 		case TaskmasterdTaskActionRefreshConfigurationFromReader:
 			refreshConfigurationFromReaderTask := task.(TaskmasterdTaskRefreshConfigurationFromReader)
 
-			programsYamlConfiguration, programsConfigurations, err := configParse(refreshConfigurationFromReaderTask.Reader)
+			data, err := ioutil.ReadAll(refreshConfigurationFromReaderTask.Reader)
+			if err != nil {
+				refreshConfigurationFromReaderTask.ErrorChan <- err
+				break
+			}
+
+			programsYamlConfiguration, programsConfigurations, err := configParse(bytes.NewReader(data), taskmasterd.Args.ConfigFormat())
 			if err != nil {
 				refreshConfigurationFromReaderTask.ErrorChan <- err
 				break
@@ -235,7 +301,8 @@ func (taskmasterd *Taskmasterd) Monitor() {
 
 			go taskmasterd.LoadProgramsConfigurations(programsConfigurations)
 
-			if err := taskmasterd.PersistProgramsConfigurationsToDisk(); err != nil {
+			// The whole configuration has been given, it is written as it is.
+			if err := NewConfigHistory(taskmasterd.Args.ConfigPathArg).Write(data); err != nil {
 				refreshConfigurationFromReaderTask.ErrorChan <- err
 				break
 			}
@@ -245,18 +312,57 @@ func (taskmasterd *Taskmasterd) Monitor() {
 	}
 }
 
+// SetOverride records the intent of an operator for a program.
+func (taskmasterd *Taskmasterd) SetOverride(programID string, intent ProgramIntent) {
+	if err := stateStore.SetOverride(programID, intent); err != nil {
+		log.Printf("Could not persist operator intent for program '%s': %v", programID, err)
+	}
+}
+
+func (taskmasterd *Taskmasterd) clearOverride(programID string) {
+	if err := stateStore.ClearOverride(programID); err != nil {
+		log.Printf("Could not clear operator intent for program '%s': %v", programID, err)
+	}
+}
+
+// PersistProgramsConfigurationsToDisk replaces the configuration file atomically,
+// keeping its previous content in the configuration history. Only the programs which
+// changed are rewritten, the rest of the file is kept as it is.
 func (taskmasterd *Taskmasterd) PersistProgramsConfigurationsToDisk() error {
-	file, err := os.OpenFile(taskmasterd.Args.ConfigPathArg, os.O_WRONLY|os.O_TRUNC, 0644)
+	history := NewConfigHistory(taskmasterd.Args.ConfigPathArg)
+
+	// Only yaml documents can be edited while keeping comments and formatting.
+	if format := taskmasterd.Args.ConfigFormat(); format != ConfigFormatYaml {
+		data, err := configEncode(taskmasterd.ProgramsConfiguration, format)
+		if err != nil {
+			return err
+		}
+
+		return history.Write(data)
+	}
+
+	var notFoundError *ErrConfigVersionNotFound
+	previous, err := history.Read(configCurrentVersion)
+	if err != nil && !errors.As(err, &notFoundError) {
+		return err
+	}
+
+	document, err := ParseConfigDocument(previous)
 	if err != nil {
+		log.Printf("Could not edit configuration file, rewriting it: %v", err)
+		document = NewConfigDocument()
+	}
+
+	if err := document.SetPrograms(taskmasterd.ProgramsConfiguration.Programs); err != nil {
 		return err
 	}
 
-	encoder := yaml.NewEncoder(file)
-	if err := encoder.Encode(taskmasterd.ProgramsConfiguration); err != nil {
+	data, err := document.Bytes()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return history.Write(data)
 }
 
 func (taskmasterd *Taskmasterd) LoadProgramConfiguration(config ProgramConfiguration) error {
@@ -273,7 +379,8 @@ func (taskmasterd *Taskmasterd) LoadProgramConfiguration(config ProgramConfigura
 			TaskBase: TaskBase{
 				Action: TaskmasterdTaskActionAdd,
 			},
-			Program: program,
+			Program:       program,
+			Configuration: config,
 		}:
 		case <-taskmasterd.Context.Done():
 			return ErrChannelClosed
@@ -294,6 +401,43 @@ func (taskmasterd *Taskmasterd) LoadProgramConfiguration(config ProgramConfigura
 	return nil
 }
 
+// CanaryProgramConfiguration tries the configuration of an edited program on one of its
+// processes. The configuration is persisted only once it has been promoted.
+func (taskmasterd *Taskmasterd) CanaryProgramConfiguration(program Program, config ProgramConfiguration, editProgramTask TaskmasterdTaskEditProgram) {
+	outcome := make(chan error, 1)
+
+	err := program.StartCanary(ProgramCanaryArgs{
+		CanaryOptions: *editProgramTask.Canary,
+		Configuration: config,
+		Outcome:       outcome,
+	})
+	if err != nil {
+		editProgramTask.ErrorChan <- err
+		return
+	}
+	close(editProgramTask.ErrorChan)
+
+	select {
+	case err := <-outcome:
+		if err != nil {
+			return
+		}
+	case <-taskmasterd.Context.Done():
+		return
+	}
+
+	select {
+	case taskmasterd.ProgramTaskChan <- TaskmasterdTaskCommitProgram{
+		TaskBase: TaskBase{
+			Action: TaskmasterdTaskActionCommitProgram,
+		},
+		ProgramId:            config.Name,
+		ProgramConfiguration: editProgramTask.ProgramConfiguration,
+	}:
+	case <-taskmasterd.Context.Done():
+	}
+}
+
 func (taskmasterd *Taskmasterd) LoadProgramsConfigurations(configs ProgramsConfigurations) error {
 	log.Printf("Loading %d program(s) configuration(s)...", len(configs))
 	programs, err := taskmasterd.GetPrograms()
@@ -393,6 +537,31 @@ func (taskmasterd *Taskmasterd) GetSortedPrograms() ([]Program, error) {
 	return sortedPrograms, nil
 }
 
+// PlanConfiguration tells what loading the configuration read from reader would do,
+// without applying anything.
+func (taskmasterd *Taskmasterd) PlanConfiguration(reader io.Reader, format ConfigFormat) (ConfigurationPlan, error) {
+	_, nextConfigurations, err := configParse(reader, format)
+	if err != nil {
+		return ConfigurationPlan{}, err
+	}
+
+	programs, err := taskmasterd.GetPrograms()
+	if err != nil {
+		return ConfigurationPlan{}, err
+	}
+
+	currentConfigurations := make(ProgramsConfigurations)
+	for programID, program := range programs {
+		config, err := program.GetConfig()
+		if err != nil {
+			return ConfigurationPlan{}, err
+		}
+		currentConfigurations[programID] = config
+	}
+
+	return PlanConfiguration(currentConfigurations, nextConfigurations), nil
+}
+
 func (taskmasterd *Taskmasterd) Quit() {
 	taskmasterd.Cancel()
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// When taskmasterd is started with upgradeEnv set, it has been launched by a running
+// daemon, whose binary may have been replaced, and takes over its supervision:
+//   - the listening HTTP socket is inherited as upgradeListenerFd
+//   - upgradeReadyMessage is written to upgradeReadyFd once the configuration is valid
+//   - upgradeHandoverFd is closed by the previous daemon when it exits, after which the
+//     state file is final and its processes can be adopted
+const (
+	upgradeEnv = "TASKMASTERD_UPGRADE"
+
+	upgradeListenerFd = 3
+	upgradeReadyFd    = 4
+	upgradeHandoverFd = 5
+
+	upgradeReadyMessage = "ready"
+	upgradeReadyTimeout = 30 * time.Second
+)
+
+var (
+	ErrUpgradeInProgress   = errors.New("an upgrade is already in progress")
+	ErrUpgradeNotReady     = errors.New("new daemon exited before being ready")
+	ErrUpgradeReadyTimeout = errors.New("new daemon did not get ready in time")
+)
+
+// upgradeIsRequested tells whether the daemon is taking over from a previous one.
+// The variable is removed from the environment so that programs do not inherit it.
+func upgradeIsRequested() bool {
+	_, ok := os.LookupEnv(upgradeEnv)
+	os.Unsetenv(upgradeEnv)
+
+	return ok
+}
+
+// httpListen opens the socket of the HTTP REST API, or takes the one of the previous
+// daemon when upgrading.
+func httpListen(port int, upgrade bool) (net.Listener, error) {
+	if !upgrade {
+		return net.Listen("tcp", ":"+fmt.Sprint(port))
+	}
+
+	listenerFile := os.NewFile(upgradeListenerFd, "listener")
+	defer listenerFile.Close()
+
+	return net.FileListener(listenerFile)
+}
+
+// upgradeTakeOver tells the previous daemon the configuration is valid, and returns
+// once it has given up control.
+func upgradeTakeOver() error {
+	readyFile := os.NewFile(upgradeReadyFd, "ready")
+	if _, err := readyFile.Write([]byte(upgradeReadyMessage)); err != nil {
+		readyFile.Close()
+		return err
+	}
+	readyFile.Close()
+
+	handoverFile := os.NewFile(upgradeHandoverFd, "handover")
+	defer handoverFile.Close()
+
+	_, err := io.Copy(ioutil.Discard, handoverFile)
+	return err
+}
+
+// Upgrade launches the taskmasterd binary found on disk, and waits for it to be ready
+// to take over. The caller must then call HandOver, or the new daemon will wait forever.
+func (taskmasterd *Taskmasterd) Upgrade() error {
+	select {
+	case taskmasterd.upgrading <- struct{}{}:
+	default:
+		return ErrUpgradeInProgress
+	}
+
+	err := taskmasterd.upgrade()
+	if err != nil {
+		<-taskmasterd.upgrading
+	}
+
+	return err
+}
+
+func (taskmasterd *Taskmasterd) upgrade() error {
+	tcpListener, ok := taskmasterd.Listener.(*net.TCPListener)
+	if !ok {
+		return errors.New("listener can not be handed over")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	listenerFile, err := tcpListener.File()
+	if err != nil {
+		return err
+	}
+	defer listenerFile.Close()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	handoverReader, handoverWriter, err := os.Pipe()
+	if err != nil {
+		readyWriter.Close()
+		return err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), upgradeEnv+"=1")
+	cmd.Stdin = nil
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// The order must match upgradeListenerFd, upgradeReadyFd and upgradeHandoverFd.
+	cmd.ExtraFiles = []*os.File{
+		listenerFile,
+		readyWriter,
+		handoverReader,
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+
+	log.Printf("Upgrading: launching %s", executable)
+
+	// The new daemon is registered so that it is not mistaken for an orphan and reaped.
+	err = childrenRegistry.Start(cmd, "", "")
+	readyWriter.Close()
+	handoverReader.Close()
+	if err != nil {
+		handoverWriter.Close()
+		return err
+	}
+
+	readyCh := make(chan error, 1)
+	go func() {
+		message := make([]byte, len(upgradeReadyMessage))
+		if _, err := io.ReadFull(readyReader, message); err != nil || string(message) != upgradeReadyMessage {
+			readyCh <- ErrUpgradeNotReady
+			return
+		}
+		readyCh <- nil
+	}()
+
+	go func() {
+		cmd.Wait()
+		childrenRegistry.Release(cmd.Process.Pid)
+	}()
+
+	select {
+	case err = <-readyCh:
+	case <-time.After(upgradeReadyTimeout):
+		err = ErrUpgradeReadyTimeout
+		cmd.Process.Kill()
+	}
+	if err != nil {
+		handoverWriter.Close()
+		log.Printf("Upgrade aborted: %v", err)
+		return err
+	}
+
+	taskmasterd.handoverWriter = handoverWriter
+
+	log.Printf("Upgrading: new daemon with PID %d is ready", cmd.Process.Pid)
+
+	return nil
+}
+
+// HandOver makes the daemon exit without stopping any process, once the HTTP server
+// has been shut down. It must only be called after a successful Upgrade.
+func (taskmasterd *Taskmasterd) HandOver() {
+	close(taskmasterd.HandedOver)
+	taskmasterd.Cancel()
+}
+
+// handOverExit freezes the state file and lets the new daemon take over.
+// The lock file is kept, as it now belongs to the new daemon.
+func (taskmasterd *Taskmasterd) handOverExit() {
+	stateStore.Close()
+	taskmasterd.handoverWriter.Close()
+
+	log.Println("Handed over to the new daemon, bye!")
+	os.Exit(0)
+}
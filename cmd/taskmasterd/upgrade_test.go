@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+const upgradeTestMessage = "taken over"
+
+// upgradeTestDaemonMain plays the new daemon, launched by TestUpgradeHandsOverListener
+// from the test binary: it answers a single connection once it has taken over.
+func upgradeTestDaemonMain() {
+	listener, err := httpListen(0, true)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if err := upgradeTakeOver(); err != nil {
+		os.Exit(1)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		os.Exit(1)
+	}
+	conn.Write([]byte(upgradeTestMessage))
+	conn.Close()
+
+	os.Exit(0)
+}
+
+func TestUpgradeHandsOverListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	taskmasterd := &Taskmasterd{
+		Listener:   listener,
+		HandedOver: make(chan struct{}),
+		upgrading:  make(chan struct{}, 1),
+	}
+
+	if err := taskmasterd.Upgrade(); err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	defer taskmasterd.handoverWriter.Close()
+
+	if err := taskmasterd.Upgrade(); err != ErrUpgradeInProgress {
+		t.Errorf("unexpected error returned %v; expected %v", err, ErrUpgradeInProgress)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The new daemon must not serve before the previous one has handed over.
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("new daemon served before the handover")
+	}
+
+	taskmasterd.handoverWriter.Close()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	message, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected no error to be returned; received %v", err)
+	}
+	if string(message) != upgradeTestMessage {
+		t.Errorf("new daemon answered %q; expected %q", message, upgradeTestMessage)
+	}
+}
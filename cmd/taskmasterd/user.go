@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// ProgramRunAs holds the resolved identity a program must be launched with.
+type ProgramRunAs struct {
+	Credential syscall.Credential
+	Username   string
+	HomeDir    string
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		if resolvedUser, err := user.LookupId(name); err == nil {
+			return resolvedUser, nil
+		}
+	}
+
+	return user.Lookup(name)
+}
+
+func lookupGroupID(name string) (uint32, error) {
+	if gid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(gid), nil
+	}
+
+	group, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	gid, err := strconv.ParseUint(group.Gid, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(gid), nil
+}
+
+func lookupSupplementaryGroups(resolvedUser *user.User) ([]uint32, error) {
+	groupIDs, err := resolvedUser.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]uint32, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		gid, err := strconv.ParseUint(groupID, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, uint32(gid))
+	}
+
+	return groups, nil
+}
+
+// canRunAs reports whether the daemon has enough privileges to launch
+// processes with the given credential.
+func canRunAs(credential syscall.Credential) bool {
+	if os.Geteuid() == 0 {
+		return true
+	}
+
+	return int(credential.Uid) == os.Geteuid() && int(credential.Gid) == os.Getegid()
+}
+
+// resolveRunAs translates user and group names (or numeric ids) from the configuration
+// into the credential used to launch the program.
+// The returned field name is the one to blame when an error occurs.
+func resolveRunAs(username, groupname string) (*ProgramRunAs, string, error) {
+	runAs := &ProgramRunAs{
+		Credential: syscall.Credential{
+			Uid: uint32(os.Geteuid()),
+			Gid: uint32(os.Getegid()),
+		},
+	}
+
+	if username != "" {
+		resolvedUser, err := lookupUser(username)
+		if err != nil {
+			return nil, "User", ValidationIssueUnknownUser
+		}
+
+		uid, err := strconv.ParseUint(resolvedUser.Uid, 10, 32)
+		if err != nil {
+			return nil, "User", ValidationIssueUnknownUser
+		}
+		gid, err := strconv.ParseUint(resolvedUser.Gid, 10, 32)
+		if err != nil {
+			return nil, "User", ValidationIssueUnknownUser
+		}
+
+		groups, err := lookupSupplementaryGroups(resolvedUser)
+		if err != nil {
+			return nil, "User", ValidationIssueUnknownUser
+		}
+
+		runAs.Credential.Uid = uint32(uid)
+		runAs.Credential.Gid = uint32(gid)
+		runAs.Credential.Groups = groups
+		runAs.Username = resolvedUser.Username
+		runAs.HomeDir = resolvedUser.HomeDir
+	}
+
+	if groupname != "" {
+		gid, err := lookupGroupID(groupname)
+		if err != nil {
+			return nil, "Group", ValidationIssueUnknownGroup
+		}
+
+		runAs.Credential.Gid = gid
+	}
+
+	if !canRunAs(runAs.Credential) {
+		if username != "" {
+			return nil, "User", ValidationIssueInsufficientPrivileges
+		}
+		return nil, "Group", ValidationIssueInsufficientPrivileges
+	}
+
+	// Without an explicit user the supplementary groups of the daemon are kept.
+	runAs.Credential.NoSetGroups = username == ""
+
+	return runAs, "", nil
+}
@@ -4,9 +4,13 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"gopkg.in/yaml.v2"
 )
@@ -19,6 +23,45 @@ const (
 	AutorestartUnexpected AutorestartType = "unexpected"
 )
 
+// AutorestartAvailable lists the accepted values of autorestart.
+var AutorestartAvailable = [...]AutorestartType{
+	AutorestartOn,
+	AutorestartOff,
+	AutorestartUnexpected,
+}
+
+func (autorestart AutorestartType) Valid() bool {
+	for _, availableAutorestart := range AutorestartAvailable {
+		if availableAutorestart == autorestart {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bounds of configuration values, also published in the JSON Schema.
+const (
+	ExitcodeMin         = 0
+	ExitcodeMax         = 255
+	NumprocsMin         = 1
+	NumprocsMax         = 100
+	StartretriesMin     = 0
+	StartretriesMax     = 20
+	DelayMin            = 0
+	DelayMax            = 60 * 60 // seconds, for starttime, stoptime and stop steps.
+	RestartbatchsizeMin = 1
+	RestartbatchsizeMax = 100
+	PortMin             = 1
+	PortMax             = 65535
+)
+
+const EnvironmentVariableNamePattern = "^[a-zA-Z_][a-zA-Z0-9_]*$"
+
+// EnvironmentVariableGlobPattern matches patterns of variable names, in which * matches
+// any characters.
+const EnvironmentVariableGlobPattern = "^[a-zA-Z_*][a-zA-Z0-9_*]*$"
+
 type StdType string
 
 const (
@@ -27,58 +70,149 @@ const (
 )
 
 var (
-	ValidationIssueEmptyField         = errors.New("field is required but empty")
-	ValidationIssueValueOutsideBounds = errors.New("value is outside bounds")
-	ValidationIssueUnexpectedMapKey   = errors.New("unexpected map key")
-	ValidationIssueUnexpectedValue    = errors.New("unexpected value")
-	ValidationIssueUnexpectedType     = errors.New("unexpected type")
-	ValidationIssueInvalidPath        = errors.New("invalid path")
-	ValidationIssueNullChar           = errors.New("string cannot contains null char")
+	ValidationIssueEmptyField             = errors.New("field is required but empty")
+	ValidationIssueValueOutsideBounds     = errors.New("value is outside bounds")
+	ValidationIssueUnexpectedMapKey       = errors.New("unexpected map key")
+	ValidationIssueUnexpectedValue        = errors.New("unexpected value")
+	ValidationIssueUnexpectedType         = errors.New("unexpected type")
+	ValidationIssueInvalidPath            = errors.New("invalid path")
+	ValidationIssueNullChar               = errors.New("string cannot contains null char")
+	ValidationIssueUnknownUser            = errors.New("unknown user")
+	ValidationIssueUnknownGroup           = errors.New("unknown group")
+	ValidationIssueInsufficientPrivileges = errors.New("daemon lacks privileges to run as this user or group")
 )
 
 type ErrProgramsYamlValidation struct {
 	Field string
 	Issue error
+	// Line and Column locate the field in the configuration source, when known.
+	Line   int
+	Column int
 }
 
 func (err *ErrProgramsYamlValidation) Error() string {
-	return "validation error for field " + err.Field + " : " + err.Issue.Error()
+	message := "validation error for field " + err.Field + " : " + err.Issue.Error()
+	if err.Line > 0 {
+		message += " (line " + strconv.Itoa(err.Line) + ", column " + strconv.Itoa(err.Column) + ")"
+	}
+	return message
 }
 
 func (err *ErrProgramsYamlValidation) Unwrap() error {
 	return err.Issue
 }
 
+// ErrProgramsYamlValidations gathers every validation error of a configuration.
+// It unwraps to the first one, so that errors.As finds it as when validation
+// stopped there.
+type ErrProgramsYamlValidations struct {
+	Errors []*ErrProgramsYamlValidation
+}
+
+func (errs *ErrProgramsYamlValidations) Add(field string, issue error) {
+	errs.Errors = append(errs.Errors, &ErrProgramsYamlValidation{
+		Field: field,
+		Issue: issue,
+	})
+}
+
+// Err returns errs, or nil if it does not hold any error.
+func (errs *ErrProgramsYamlValidations) Err() error {
+	if len(errs.Errors) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (errs *ErrProgramsYamlValidations) Error() string {
+	messages := make([]string, 0, len(errs.Errors))
+	for _, err := range errs.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (errs *ErrProgramsYamlValidations) Unwrap() error {
+	if len(errs.Errors) == 0 {
+		return nil
+	}
+	return errs.Errors[0]
+}
+
 type ProgramsConfigurations map[string]ProgramConfiguration
 
 type ProgramsYaml struct {
-	Programs map[string]ProgramYaml `yaml:"programs"`
+	Programs map[string]ProgramYaml `yaml:"programs" json:"programs" toml:"programs"`
+	Secrets  *SecretsYaml           `yaml:"secrets,omitempty" json:"secrets,omitempty" toml:"secrets,omitempty"`
+
+	// SensitiveEnvPatterns replaces DefaultSensitiveEnvPatterns when given.
+	SensitiveEnvPatterns []string `yaml:"sensitive_env_patterns,omitempty" json:"sensitive_env_patterns,omitempty" toml:"sensitive_env_patterns,omitempty"`
 }
 
 func (programs *ProgramsYaml) Validate() (ProgramsConfigurations, error) {
 	programsConfigurations := make(ProgramsConfigurations)
 
+	var errs ErrProgramsYamlValidations
+
 	if programs.Programs == nil {
-		return nil, &ErrProgramsYamlValidation{
-			Field: "Programs",
-			Issue: ValidationIssueEmptyField,
+		errs.Add("Programs", ValidationIssueEmptyField)
+		return nil, &errs
+	}
+
+	secrets := programs.Secrets
+	if secrets != nil {
+		if err := secrets.Validate(); err != nil {
+			var secretsErrs *ErrProgramsYamlValidations
+			if !errors.As(err, &secretsErrs) {
+				return nil, err
+			}
+
+			for _, validationErr := range secretsErrs.Errors {
+				validationErr.Field = "Secrets." + validationErr.Field
+				errs.Errors = append(errs.Errors, validationErr)
+			}
+		}
+	}
+
+	globPattern := regexp.MustCompile(EnvironmentVariableGlobPattern)
+	for _, pattern := range programs.SensitiveEnvPatterns {
+		if !globPattern.MatchString(pattern) {
+			errs.Add("SensitiveEnvPatterns", ValidationIssueUnexpectedValue)
+			break
 		}
 	}
 
-	for programName, programConfiguration := range programs.Programs {
-		parsedConfiguration, err := programConfiguration.Validate(ProgramYamlValidateArgs{})
+	programNames := make([]string, 0, len(programs.Programs))
+	for programName := range programs.Programs {
+		programNames = append(programNames, programName)
+	}
+	sort.Strings(programNames)
+
+	for _, programName := range programNames {
+		programConfiguration := programs.Programs[programName]
+
+		parsedConfiguration, err := programConfiguration.Validate(ProgramYamlValidateArgs{
+			Secrets:              secrets,
+			SensitiveEnvPatterns: programs.SensitiveEnvPatterns,
+		})
 		if err == nil {
 			parsedConfiguration.Name = programName
 			programsConfigurations[programName] = parsedConfiguration
 			continue
 		}
 
-		var validationErr *ErrProgramsYamlValidation
-		if errors.As(err, &validationErr) {
+		var programErrs *ErrProgramsYamlValidations
+		if !errors.As(err, &programErrs) {
+			return nil, err
+		}
+
+		for _, validationErr := range programErrs.Errors {
 			validationErr.Field = "Programs[" + programName + "]." + validationErr.Field
-			return nil, validationErr
+			errs.Errors = append(errs.Errors, validationErr)
 		}
+	}
 
+	if err := errs.Err(); err != nil {
 		return nil, err
 	}
 
@@ -86,33 +220,160 @@ func (programs *ProgramsYaml) Validate() (ProgramsConfigurations, error) {
 }
 
 type ProgramConfiguration struct {
-	Name         string            `json:"name"`
-	Cmd          string            `json:"cmd"`
-	Numprocs     int               `json:"numprocs"`
-	Umask        string            `json:"umask"`
-	Workingdir   string            `json:"workingdir"`
-	Autostart    bool              `json:"autostart"`
-	Autorestart  AutorestartType   `json:"autorestart"`
-	Exitcodes    []int             `json:"exitcodes"`
-	Startretries int               `json:"startretries"`
-	Starttime    int               `json:"starttime"`
-	Stopsignal   StopSignal        `json:"stopsignal"`
-	Stoptime     int               `json:"stoptime"`
-	Stdout       string            `json:"stdout"`
-	Stderr       string            `json:"stderr"`
-	Env          map[string]string `json:"env"`
+	Name         string               `json:"name"`
+	Cmd          string               `json:"cmd"`
+	Numprocs     int                  `json:"numprocs"`
+	Umask        string               `json:"umask"`
+	Workingdir   string               `json:"workingdir"`
+	Autostart    bool                 `json:"autostart"`
+	Autorestart  AutorestartType      `json:"autorestart"`
+	Exitcodes    []int                `json:"exitcodes"`
+	Startretries int                  `json:"startretries"`
+	Starttime    int                  `json:"starttime"`
+	Stopsignal   StopSignal           `json:"stopsignal"`
+	Stoptime     int                  `json:"stoptime"`
+	Stopsequence []StopStep           `json:"stopsequence"`
+	Stdout       string               `json:"stdout"`
+	Stderr       string               `json:"stderr"`
+	Env          map[string]string    `json:"env"`
+	EnvSecrets   map[string]EnvSecret `json:"env_secrets"`
+	EnvFiles     []string             `json:"env_file"`
+	InheritEnv   bool                 `json:"inherit_env"`
+	User         string               `json:"user"`
+	Group        string               `json:"group"`
+	Rlimits      ProgramRlimits       `json:"rlimits"`
+	Nice         *int                 `json:"nice"`
+	Oomscoreadj  *int                 `json:"oomscoreadj"`
+	BasePort     int                  `json:"base_port"`
+
+	InheritEnvAllow []string `json:"inherit_env_allow"`
+
+	// SensitiveEnv lists the variables of env whose values are redacted, be they
+	// given explicitly or matched by a pattern.
+	SensitiveEnv []string `json:"sensitive_env"`
+
+	Processgroup    ProcessGroupType `json:"processgroup"`
+	Killdescendants bool             `json:"killdescendants"`
+	Killorphans     bool             `json:"killorphans"`
+
+	Restartstrategy  RestartStrategy `json:"restartstrategy"`
+	Restartbatchsize int             `json:"restartbatchsize"`
+
+	runAs *ProgramRunAs
 }
 
-func (config *ProgramConfiguration) CreateCmdEnvironment() []string {
-	env := os.Environ()
+// CreateCmdEnvironment starts from the environment of the daemon, or from its
+// allowed variables when programs do not inherit it. Env files are read at each
+// start, and env overrides them, its secrets being resolved by the caller.
+func (config *ProgramConfiguration) CreateCmdEnvironment(secretEnv map[string]string) ([]string, error) {
+	fileEnv, err := dotenvReadFiles(config.EnvFilePaths())
+	if err != nil {
+		return nil, err
+	}
+
+	env := config.inheritedEnvironment()
+	if config.runAs != nil && config.runAs.Username != "" {
+		env = append(
+			env,
+			"HOME="+config.runAs.HomeDir,
+			"USER="+config.runAs.Username,
+			"LOGNAME="+config.runAs.Username,
+		)
+	}
+	for name, value := range fileEnv {
+		env = append(env, name+"="+value)
+	}
 	for name, value := range config.Env {
 		concatenatedKeyValue := name + "=" + value
 
 		env = append(env, concatenatedKeyValue)
 	}
+	for name, value := range secretEnv {
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// ExpandCmd expands the variables of the command from the environment processes
+// get, so that the one of the daemon only shows through when it is inherited.
+func (config *ProgramConfiguration) ExpandCmd(env []string) string {
+	return os.Expand(config.Cmd, func(name string) string {
+		return envLookup(env, name)
+	})
+}
+
+// envLookup returns the last definition of a variable, which is the one
+// processes get.
+func envLookup(env []string, name string) string {
+	value := ""
+	for _, variable := range env {
+		if strings.HasPrefix(variable, name+"=") {
+			value = strings.TrimPrefix(variable, name+"=")
+		}
+	}
+	return value
+}
+
+func (config *ProgramConfiguration) inheritedEnvironment() []string {
+	if config.InheritEnv {
+		return os.Environ()
+	}
+
+	env := []string{}
+	for _, variable := range os.Environ() {
+		name := strings.SplitN(variable, "=", 2)[0]
+
+		for _, pattern := range config.InheritEnvAllow {
+			if matched, _ := path.Match(pattern, name); matched {
+				env = append(env, variable)
+				break
+			}
+		}
+	}
 	return env
 }
 
+// EnvFilePaths resolves env files relative to the working directory of processes.
+func (config *ProgramConfiguration) EnvFilePaths() []string {
+	paths := make([]string, 0, len(config.EnvFiles))
+	for _, envFile := range config.EnvFiles {
+		if !filepath.IsAbs(envFile) && config.Workingdir != "" {
+			envFile = filepath.Join(config.Workingdir, envFile)
+		}
+		paths = append(paths, envFile)
+	}
+	return paths
+}
+
+func (config *ProgramConfiguration) CreateCmdSysProcAttr() *syscall.SysProcAttr {
+	sysProcAttr := &syscall.SysProcAttr{}
+	if config.runAs != nil {
+		credential := config.runAs.Credential
+		sysProcAttr.Credential = &credential
+	}
+	switch config.Processgroup {
+	case ProcessGroupGroup:
+		sysProcAttr.Setpgid = true
+	case ProcessGroupSession:
+		sysProcAttr.Setsid = true
+	}
+	return sysProcAttr
+}
+
+// StopSteps returns the stop sequence, falling back to stopsignal and stoptime
+// for configurations which were not built by validation.
+func (config *ProgramConfiguration) StopSteps() []StopStep {
+	if len(config.Stopsequence) == 0 {
+		return []StopStep{
+			{
+				Signal: config.Stopsignal,
+				Wait:   config.Stoptime,
+			},
+		}
+	}
+	return config.Stopsequence
+}
+
 func (config *ProgramConfiguration) CreateCmdStdout(processID string) (io.WriteCloser, error) {
 	if len(config.Stdout) == 0 || config.Stdout == "NONE" {
 		return nil, nil
@@ -148,21 +409,40 @@ func (config *ProgramConfiguration) CreateCmdStderr(processID string) (io.WriteC
 }
 
 type ProgramYaml struct {
-	Name         *string           `yaml:"-" json:"name,omitempty"`
-	Cmd          *string           `yaml:"cmd,omitempty" json:"cmd,omitempty"`
-	Numprocs     *int              `yaml:"numprocs,omitempty" json:"numprocs,omitempty"`
-	Umask        *string           `yaml:"umask,omitempty" json:"umask,omitempty"`
-	Workingdir   *string           `yaml:"workingdir,omitempty" json:"workingdir,omitempty"`
-	Autostart    *bool             `yaml:"autostart,omitempty" json:"autostart,omitempty"`
-	Autorestart  *AutorestartType  `yaml:"autorestart,omitempty" json:"autorestart,omitempty"`
-	Exitcodes    interface{}       `yaml:"exitcodes,omitempty" json:"exitcodes,omitempty"`
-	Startretries *int              `yaml:"startretries,omitempty" json:"startretries,omitempty"`
-	Starttime    *int              `yaml:"starttime,omitempty" json:"starttime,omitempty"`
-	Stopsignal   *StopSignal       `yaml:"stopsignal,omitempty" json:"stopsignal,omitempty"`
-	Stoptime     *int              `yaml:"stoptime,omitempty" json:"stoptime,omitempty"`
-	Stdout       *string           `yaml:"stdout,omitempty" json:"stdout,omitempty"`
-	Stderr       *string           `yaml:"stderr,omitempty" json:"stderr,omitempty"`
-	Env          map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Name         *string                 `yaml:"-" json:"name,omitempty" toml:"-"`
+	Cmd          *string                 `yaml:"cmd,omitempty" json:"cmd,omitempty" toml:"cmd,omitempty"`
+	Numprocs     *int                    `yaml:"numprocs,omitempty" json:"numprocs,omitempty" toml:"numprocs,omitempty"`
+	Umask        *string                 `yaml:"umask,omitempty" json:"umask,omitempty" toml:"umask,omitempty"`
+	Workingdir   *string                 `yaml:"workingdir,omitempty" json:"workingdir,omitempty" toml:"workingdir,omitempty"`
+	Autostart    *bool                   `yaml:"autostart,omitempty" json:"autostart,omitempty" toml:"autostart,omitempty"`
+	Autorestart  *AutorestartType        `yaml:"autorestart,omitempty" json:"autorestart,omitempty" toml:"autorestart,omitempty"`
+	Exitcodes    interface{}             `yaml:"exitcodes,omitempty" json:"exitcodes,omitempty" toml:"exitcodes,omitempty"`
+	Startretries *int                    `yaml:"startretries,omitempty" json:"startretries,omitempty" toml:"startretries,omitempty"`
+	Starttime    *int                    `yaml:"starttime,omitempty" json:"starttime,omitempty" toml:"starttime,omitempty"`
+	Stopsignal   *StopSignal             `yaml:"stopsignal,omitempty" json:"stopsignal,omitempty" toml:"stopsignal,omitempty"`
+	Stoptime     *int                    `yaml:"stoptime,omitempty" json:"stoptime,omitempty" toml:"stoptime,omitempty"`
+	Stopsequence []StopStepYaml          `yaml:"stopsequence,omitempty" json:"stopsequence,omitempty" toml:"stopsequence,omitempty"`
+	Stdout       *string                 `yaml:"stdout,omitempty" json:"stdout,omitempty" toml:"stdout,omitempty"`
+	Stderr       *string                 `yaml:"stderr,omitempty" json:"stderr,omitempty" toml:"stderr,omitempty"`
+	Env          map[string]EnvValueYaml `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
+	EnvFile      interface{}             `yaml:"env_file,omitempty" json:"env_file,omitempty" toml:"env_file,omitempty"`
+	InheritEnv   *bool                   `yaml:"inherit_env,omitempty" json:"inherit_env,omitempty" toml:"inherit_env,omitempty"`
+	User         *string                 `yaml:"user,omitempty" json:"user,omitempty" toml:"user,omitempty"`
+	Group        *string                 `yaml:"group,omitempty" json:"group,omitempty" toml:"group,omitempty"`
+	Rlimits      *ProgramRlimitsYaml     `yaml:"rlimits,omitempty" json:"rlimits,omitempty" toml:"rlimits,omitempty"`
+	Nice         *int                    `yaml:"nice,omitempty" json:"nice,omitempty" toml:"nice,omitempty"`
+	Oomscoreadj  *int                    `yaml:"oomscoreadj,omitempty" json:"oomscoreadj,omitempty" toml:"oomscoreadj,omitempty"`
+	BasePort     *int                    `yaml:"base_port,omitempty" json:"base_port,omitempty" toml:"base_port,omitempty"`
+
+	InheritEnvAllow []string `yaml:"inherit_env_allow,omitempty" json:"inherit_env_allow,omitempty" toml:"inherit_env_allow,omitempty"`
+	SensitiveEnv    []string `yaml:"sensitive_env,omitempty" json:"sensitive_env,omitempty" toml:"sensitive_env,omitempty"`
+
+	Processgroup    *ProcessGroupType `yaml:"processgroup,omitempty" json:"processgroup,omitempty" toml:"processgroup,omitempty"`
+	Killdescendants *bool             `yaml:"killdescendants,omitempty" json:"killdescendants,omitempty" toml:"killdescendants,omitempty"`
+	Killorphans     *bool             `yaml:"killorphans,omitempty" json:"killorphans,omitempty" toml:"killorphans,omitempty"`
+
+	Restartstrategy  *RestartStrategy `yaml:"restartstrategy,omitempty" json:"restartstrategy,omitempty" toml:"restartstrategy,omitempty"`
+	Restartbatchsize *int             `yaml:"restartbatchsize,omitempty" json:"restartbatchsize,omitempty" toml:"restartbatchsize,omitempty"`
 }
 
 func (program *ProgramYaml) NormalizedExitcodes() ([]int, error) {
@@ -170,9 +450,14 @@ func (program *ProgramYaml) NormalizedExitcodes() ([]int, error) {
 		return []int{0}, nil
 	}
 
+	// Numbers are decoded as float64 from JSON and as int64 from TOML.
 	switch exitcodes := program.Exitcodes.(type) {
 	case int:
 		return []int{exitcodes}, nil
+	case int64:
+		return []int{int(exitcodes)}, nil
+	case float64:
+		return []int{int(exitcodes)}, nil
 	case []interface{}:
 		exitcodesSlice := make([]int, len(exitcodes))
 
@@ -182,6 +467,8 @@ func (program *ProgramYaml) NormalizedExitcodes() ([]int, error) {
 				exitcodesSlice[index] = int(convertedExitcode)
 			case int:
 				exitcodesSlice[index] = convertedExitcode
+			case int64:
+				exitcodesSlice[index] = int(convertedExitcode)
 			default:
 				return nil, ValidationIssueUnexpectedType
 			}
@@ -193,81 +480,84 @@ func (program *ProgramYaml) NormalizedExitcodes() ([]int, error) {
 	}
 }
 
+// NormalizedEnvFiles accepts a single env file as well as a list of them.
+func (program *ProgramYaml) NormalizedEnvFiles() ([]string, error) {
+	switch envFiles := program.EnvFile.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{envFiles}, nil
+	case []string:
+		return envFiles, nil
+	case []interface{}:
+		envFilesSlice := make([]string, len(envFiles))
+
+		for index, envFile := range envFiles {
+			convertedEnvFile, ok := envFile.(string)
+			if !ok {
+				return nil, ValidationIssueUnexpectedType
+			}
+			envFilesSlice[index] = convertedEnvFile
+		}
+
+		return envFilesSlice, nil
+	default:
+		return nil, ValidationIssueUnexpectedType
+	}
+}
+
 type ProgramYamlValidateArgs struct {
 	PickProgramName bool
+	// Secrets is the secrets file of the configuration, if any.
+	Secrets *SecretsYaml
+	// SensitiveEnvPatterns are the patterns of the configuration, the default
+	// ones being used when nil.
+	SensitiveEnvPatterns []string
 }
 
 func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfiguration, error) {
-	const HourInSeconds = 60 * 60
-
-	var config ProgramConfiguration
+	var (
+		config ProgramConfiguration
+		errs   ErrProgramsYamlValidations
+	)
 
 	normalizedExitcodes, err := program.NormalizedExitcodes()
 	if err != nil {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Exitcodes",
-			Issue: err,
-		}
-	}
-	for _, exitcode := range normalizedExitcodes {
-		if !(0 <= exitcode && exitcode <= 255) {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Exitcodes",
-				Issue: ValidationIssueValueOutsideBounds,
+		errs.Add("Exitcodes", err)
+	} else {
+		for _, exitcode := range normalizedExitcodes {
+			if !(ExitcodeMin <= exitcode && exitcode <= ExitcodeMax) {
+				errs.Add("Exitcodes", ValidationIssueValueOutsideBounds)
+				break
 			}
 		}
+		config.Exitcodes = normalizedExitcodes
 	}
-	config.Exitcodes = normalizedExitcodes
 
 	if args.PickProgramName {
 		if program.Name == nil {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Name",
-				Issue: ValidationIssueEmptyField,
-			}
-		}
-
-		programName := strings.TrimSpace(*program.Name)
-
-		if programName == "" {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Name",
-				Issue: ValidationIssueEmptyField,
-			}
-		}
-
-		if hasNullChar(programName) {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Name",
-				Issue: ValidationIssueNullChar,
-			}
+			errs.Add("Name", ValidationIssueEmptyField)
+		} else if programName := strings.TrimSpace(*program.Name); programName == "" {
+			errs.Add("Name", ValidationIssueEmptyField)
+		} else if hasNullChar(programName) {
+			errs.Add("Name", ValidationIssueNullChar)
+		} else {
+			config.Name = programName
 		}
-
-		config.Name = programName
 	}
 
 	if program.Cmd == nil {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Cmd",
-			Issue: ValidationIssueEmptyField,
-		}
-	}
-	if hasNullChar(*program.Cmd) {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Cmd",
-			Issue: ValidationIssueNullChar,
-		}
+		errs.Add("Cmd", ValidationIssueEmptyField)
+	} else if hasNullChar(*program.Cmd) {
+		errs.Add("Cmd", ValidationIssueNullChar)
+	} else {
+		config.Cmd = *program.Cmd
 	}
 
-	config.Cmd = *program.Cmd
-
 	if program.Numprocs == nil {
 		config.Numprocs = 1
-	} else if *program.Numprocs < 1 || *program.Numprocs > 100 {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Numprocs",
-			Issue: ValidationIssueValueOutsideBounds,
-		}
+	} else if *program.Numprocs < NumprocsMin || *program.Numprocs > NumprocsMax {
+		errs.Add("Numprocs", ValidationIssueValueOutsideBounds)
 	} else {
 		config.Numprocs = *program.Numprocs
 	}
@@ -279,15 +569,9 @@ func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfi
 			// Try to parse octal string to an int.
 			// If we fail, the umask property must be rejected.
 			if umaskAsInt, err := strconv.ParseInt(umask, 8, 64); err != nil {
-				return config, &ErrProgramsYamlValidation{
-					Field: "Umask",
-					Issue: ValidationIssueUnexpectedValue,
-				}
+				errs.Add("Umask", ValidationIssueUnexpectedValue)
 			} else if umaskAsInt < 0 {
-				return config, &ErrProgramsYamlValidation{
-					Field: "Umask",
-					Issue: ValidationIssueValueOutsideBounds,
-				}
+				errs.Add("Umask", ValidationIssueValueOutsideBounds)
 			}
 		}
 
@@ -296,10 +580,7 @@ func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfi
 
 	if program.Workingdir != nil {
 		if hasNullChar(*program.Workingdir) {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Workingdir",
-				Issue: ValidationIssueNullChar,
-			}
+			errs.Add("Workingdir", ValidationIssueNullChar)
 		}
 		config.Workingdir = *program.Workingdir
 	}
@@ -312,35 +593,24 @@ func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfi
 
 	if program.Autorestart == nil {
 		config.Autorestart = AutorestartUnexpected
-	} else if !(*program.Autorestart == AutorestartOn ||
-		*program.Autorestart == AutorestartOff ||
-		*program.Autorestart == AutorestartUnexpected) {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Autorestart",
-			Issue: ValidationIssueUnexpectedValue,
-		}
+	} else if !program.Autorestart.Valid() {
+		errs.Add("Autorestart", ValidationIssueUnexpectedValue)
 	} else {
 		config.Autorestart = *program.Autorestart
 	}
 
 	if program.Starttime == nil {
 		config.Starttime = 5
-	} else if *program.Starttime < 0 || *program.Starttime > HourInSeconds {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Starttime",
-			Issue: ValidationIssueValueOutsideBounds,
-		}
+	} else if *program.Starttime < DelayMin || *program.Starttime > DelayMax {
+		errs.Add("Starttime", ValidationIssueValueOutsideBounds)
 	} else {
 		config.Starttime = *program.Starttime
 	}
 
 	if program.Startretries == nil {
 		config.Startretries = 3
-	} else if *program.Startretries < 0 || *program.Startretries > 20 {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Startretries",
-			Issue: ValidationIssueValueOutsideBounds,
-		}
+	} else if *program.Startretries < StartretriesMin || *program.Startretries > StartretriesMax {
+		errs.Add("Startretries", ValidationIssueValueOutsideBounds)
 	} else {
 		config.Startretries = *program.Startretries
 	}
@@ -348,33 +618,64 @@ func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfi
 	if program.Stopsignal == nil {
 		config.Stopsignal = StopSignalTerm
 	} else if !program.Stopsignal.Valid() {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Stopsignal",
-			Issue: ValidationIssueUnexpectedValue,
-		}
+		errs.Add("Stopsignal", ValidationIssueUnexpectedValue)
 	} else {
 		config.Stopsignal = *program.Stopsignal
 	}
 
 	if program.Stoptime == nil {
 		config.Stoptime = 10
-	} else if *program.Stoptime < 0 || *program.Stoptime > HourInSeconds {
-		return config, &ErrProgramsYamlValidation{
-			Field: "Stoptime",
-			Issue: ValidationIssueValueOutsideBounds,
-		}
+	} else if *program.Stoptime < DelayMin || *program.Stoptime > DelayMax {
+		errs.Add("Stoptime", ValidationIssueValueOutsideBounds)
 	} else {
 		config.Stoptime = *program.Stoptime
 	}
 
+	// Without an explicit sequence, the process receives stopsignal and is killed
+	// after stoptime, which is what ends every sequence anyway.
+	if len(program.Stopsequence) == 0 {
+		config.Stopsequence = []StopStep{
+			{
+				Signal: config.Stopsignal,
+				Wait:   config.Stoptime,
+			},
+		}
+	} else {
+		config.Stopsequence = make([]StopStep, 0, len(program.Stopsequence))
+
+		for index, step := range program.Stopsequence {
+			field := "Stopsequence[" + strconv.Itoa(index) + "]"
+
+			if step.Signal == nil {
+				errs.Add(field+".Signal", ValidationIssueEmptyField)
+				continue
+			}
+			if !step.Signal.Valid() {
+				errs.Add(field+".Signal", ValidationIssueUnexpectedValue)
+				continue
+			}
+
+			wait := config.Stoptime
+			if step.Wait != nil {
+				if *step.Wait < DelayMin || *step.Wait > DelayMax {
+					errs.Add(field+".Wait", ValidationIssueValueOutsideBounds)
+					continue
+				}
+				wait = *step.Wait
+			}
+
+			config.Stopsequence = append(config.Stopsequence, StopStep{
+				Signal: *step.Signal,
+				Wait:   wait,
+			})
+		}
+	}
+
 	if program.Stdout == nil {
 		config.Stdout = string(StdTypeAuto)
 	} else {
 		if hasNullChar(*program.Stdout) {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Stdout",
-				Issue: ValidationIssueNullChar,
-			}
+			errs.Add("Stdout", ValidationIssueNullChar)
 		}
 		config.Stdout = *program.Stdout
 	}
@@ -383,10 +684,7 @@ func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfi
 		config.Stderr = string(StdTypeAuto)
 	} else {
 		if hasNullChar(*program.Stderr) {
-			return config, &ErrProgramsYamlValidation{
-				Field: "Stderr",
-				Issue: ValidationIssueNullChar,
-			}
+			errs.Add("Stderr", ValidationIssueNullChar)
 		}
 		config.Stderr = *program.Stderr
 	}
@@ -394,19 +692,210 @@ func (program *ProgramYaml) Validate(args ProgramYamlValidateArgs) (ProgramConfi
 	if program.Env == nil {
 		config.Env = nil
 	} else {
+		keys := make([]string, 0, len(program.Env))
 		for key := range program.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
 			if !isValidEnvironementVariableName(key) {
-				return config, &ErrProgramsYamlValidation{
-					Field: "Env",
-					Issue: ValidationIssueUnexpectedMapKey,
+				errs.Add("Env", ValidationIssueUnexpectedMapKey)
+				break
+			}
+		}
+
+		config.Env = make(map[string]string, len(program.Env))
+		for _, key := range keys {
+			value := program.Env[key]
+
+			if value.Reference == nil {
+				// A redacted configuration sent back must not replace the values it hides.
+				if value.Value == RedactedValue {
+					errs.Add("Env["+key+"]", ValidationIssueRedactedValue)
+					continue
 				}
+
+				config.Env[key] = value.Value
+				continue
+			}
+
+			secret, err := validateSecretReference(*value.Reference, args.Secrets)
+			if err != nil {
+				errs.Add("Env["+key+"]", err)
+				continue
+			}
+
+			if config.EnvSecrets == nil {
+				config.EnvSecrets = make(map[string]EnvSecret)
+			}
+			config.EnvSecrets[key] = secret
+		}
+	}
+
+	if envFiles, err := program.NormalizedEnvFiles(); err != nil {
+		errs.Add("EnvFile", err)
+	} else {
+		for _, envFile := range envFiles {
+			if envFile == "" {
+				errs.Add("EnvFile", ValidationIssueEmptyField)
+				break
+			} else if hasNullChar(envFile) {
+				errs.Add("EnvFile", ValidationIssueNullChar)
+				break
 			}
 		}
 
-		config.Env = program.Env
+		config.EnvFiles = envFiles
+	}
+
+	if program.InheritEnv == nil {
+		config.InheritEnv = true
+	} else {
+		config.InheritEnv = *program.InheritEnv
+	}
+
+	if program.InheritEnvAllow != nil {
+		allowPattern := regexp.MustCompile(EnvironmentVariableGlobPattern)
+
+		// Allowed variables only make sense when the environment is not inherited.
+		if config.InheritEnv {
+			errs.Add("InheritEnvAllow", ValidationIssueUnexpectedValue)
+		} else {
+			for _, pattern := range program.InheritEnvAllow {
+				if !allowPattern.MatchString(pattern) {
+					errs.Add("InheritEnvAllow", ValidationIssueUnexpectedValue)
+					break
+				}
+			}
+		}
+
+		config.InheritEnvAllow = program.InheritEnvAllow
+	}
+
+	for _, name := range program.SensitiveEnv {
+		if !isValidEnvironementVariableName(name) {
+			errs.Add("SensitiveEnv", ValidationIssueUnexpectedValue)
+			break
+		}
+	}
+	config.SensitiveEnv = program.SensitiveEnvNames(args.SensitiveEnvPatterns)
+
+	userValid, groupValid := true, true
+
+	if program.User != nil {
+		if hasNullChar(*program.User) {
+			errs.Add("User", ValidationIssueNullChar)
+			userValid = false
+		}
+		config.User = strings.TrimSpace(*program.User)
+	}
+
+	if program.Group != nil {
+		if hasNullChar(*program.Group) {
+			errs.Add("Group", ValidationIssueNullChar)
+			groupValid = false
+		}
+		config.Group = strings.TrimSpace(*program.Group)
+	}
+
+	if userValid && groupValid && (config.User != "" || config.Group != "") {
+		runAs, field, err := resolveRunAs(config.User, config.Group)
+		if err != nil {
+			errs.Add(field, err)
+		}
+		config.runAs = runAs
+	}
+
+	if program.Rlimits != nil {
+		rlimits, field, err := program.Rlimits.Validate()
+		if err != nil {
+			errs.Add("Rlimits."+field, err)
+		}
+		config.Rlimits = rlimits
+	}
+
+	if program.Nice != nil {
+		if *program.Nice < NiceMin || *program.Nice > NiceMax {
+			errs.Add("Nice", ValidationIssueValueOutsideBounds)
+		}
+		config.Nice = program.Nice
+	}
+
+	if program.Oomscoreadj != nil {
+		if *program.Oomscoreadj < OomScoreAdjMin || *program.Oomscoreadj > OomScoreAdjMax {
+			errs.Add("Oomscoreadj", ValidationIssueValueOutsideBounds)
+		}
+		config.Oomscoreadj = program.Oomscoreadj
+	}
+
+	if program.BasePort != nil {
+		// Every process needs a port, base_port + process_num.
+		if *program.BasePort < PortMin || *program.BasePort+config.Numprocs > PortMax {
+			errs.Add("BasePort", ValidationIssueValueOutsideBounds)
+		}
+		config.BasePort = *program.BasePort
+	}
+
+	// Expressions are expanded for each process when it starts.
+	type expandedField struct {
+		Field string
+		Value string
+	}
+	expandedFields := []expandedField{
+		{"Cmd", config.Cmd},
+		{"Workingdir", config.Workingdir},
+		{"Stdout", config.Stdout},
+		{"Stderr", config.Stderr},
+	}
+	envNames := make([]string, 0, len(config.Env))
+	for name := range config.Env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		expandedFields = append(expandedFields, expandedField{"Env[" + name + "]", config.Env[name]})
+	}
+
+	for _, expandedField := range expandedFields {
+		if err := validateExpansions(expandedField.Value, program.BasePort != nil); err != nil {
+			errs.Add(expandedField.Field, err)
+		}
+	}
+
+	if program.Processgroup == nil {
+		config.Processgroup = ProcessGroupNone
+	} else if !program.Processgroup.Valid() {
+		errs.Add("Processgroup", ValidationIssueUnexpectedValue)
+	} else {
+		config.Processgroup = *program.Processgroup
+	}
+
+	if program.Killdescendants != nil {
+		config.Killdescendants = *program.Killdescendants
+	}
+
+	if program.Killorphans != nil {
+		config.Killorphans = *program.Killorphans
+	}
+
+	if program.Restartstrategy == nil {
+		config.Restartstrategy = RestartStrategyAll
+	} else if !program.Restartstrategy.Valid() {
+		errs.Add("Restartstrategy", ValidationIssueUnexpectedValue)
+	} else {
+		config.Restartstrategy = *program.Restartstrategy
+	}
+
+	if program.Restartbatchsize == nil {
+		config.Restartbatchsize = 1
+	} else if *program.Restartbatchsize < RestartbatchsizeMin || *program.Restartbatchsize > RestartbatchsizeMax {
+		errs.Add("Restartbatchsize", ValidationIssueValueOutsideBounds)
+	} else {
+		config.Restartbatchsize = *program.Restartbatchsize
 	}
 
-	return config, nil
+	return config, errs.Err()
 }
 
 func hasNullChar(s string) bool {
@@ -419,7 +908,7 @@ func hasNullChar(s string) bool {
 }
 
 func isValidEnvironementVariableName(s string) bool {
-	re := regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+	re := regexp.MustCompile(EnvironmentVariableNamePattern)
 
 	return re.MatchString(s)
 }
@@ -2,6 +2,10 @@ package main
 
 import (
 	"errors"
+	"os"
+	"os/user"
+	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -1066,7 +1070,7 @@ func TestEnvFailsForInvalidKeys(t *testing.T) {
 		Programs: map[string]ProgramYaml{
 			"taskmaster": {
 				Cmd: strToPointer("cmd"),
-				Env: env,
+				Env: EnvYamlFromValues(env),
 			},
 		},
 	}
@@ -1106,7 +1110,7 @@ func TestEnvIsValidValue(t *testing.T) {
 		Programs: map[string]ProgramYaml{
 			"taskmaster": {
 				Cmd: strToPointer("cmd"),
-				Env: env,
+				Env: EnvYamlFromValues(env),
 			},
 		},
 	}
@@ -1122,6 +1126,648 @@ func TestEnvIsValidValue(t *testing.T) {
 	}
 }
 
+func TestEnvFileAcceptsStringAndList(t *testing.T) {
+	tests := map[string]interface{}{
+		"single": ".env",
+		"list":   []interface{}{".env", ".env.local"},
+	}
+	expected := map[string][]string{
+		"single": {".env"},
+		"list":   {".env", ".env.local"},
+	}
+
+	for name, envFile := range tests {
+		programs := ProgramsYaml{
+			Programs: map[string]ProgramYaml{
+				"taskmaster": {
+					Cmd:     strToPointer("cmd"),
+					EnvFile: envFile,
+				},
+			},
+		}
+
+		config, err := programs.Validate()
+		if err != nil {
+			t.Errorf("Validate returned an error for %s env_file: %v", name, err)
+			continue
+		}
+
+		if envFiles := config["taskmaster"].EnvFiles; !reflect.DeepEqual(envFiles, expected[name]) {
+			t.Errorf("EnvFiles is %v; expected %v", envFiles, expected[name])
+		}
+	}
+}
+
+func TestEnvFileFailsOnInvalidType(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:     strToPointer("cmd"),
+				EnvFile: []interface{}{".env", 42},
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+
+	var validationError *ErrProgramsYamlValidation
+	if !errors.As(err, &validationError) || validationError.Field != "Programs[taskmaster].EnvFile" || !errors.Is(err, ValidationIssueUnexpectedType) {
+		t.Errorf("Incorrect error: %v; expected an unexpected type of EnvFile", err)
+	}
+}
+
+func TestInheritEnvSetToDefaultValue(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd: strToPointer("cmd"),
+			},
+		},
+	}
+
+	config, _ := programs.Validate()
+
+	if !config["taskmaster"].InheritEnv {
+		t.Errorf("InheritEnv should be true by default")
+	}
+}
+
+func TestInheritEnvAllowRequiresCleanEnvironment(t *testing.T) {
+	tests := []struct {
+		InheritEnv bool
+		Allow      []string
+		Valid      bool
+	}{
+		{false, []string{"PATH", "LC_*"}, true},
+		{false, []string{"NOT-A-NAME"}, false},
+		{true, []string{"PATH"}, false},
+	}
+
+	for _, test := range tests {
+		programs := ProgramsYaml{
+			Programs: map[string]ProgramYaml{
+				"taskmaster": {
+					Cmd:             strToPointer("cmd"),
+					InheritEnv:      boolToPointer(test.InheritEnv),
+					InheritEnvAllow: test.Allow,
+				},
+			},
+		}
+
+		_, err := programs.Validate()
+		if test.Valid && err != nil {
+			t.Errorf("Validate returned an error for %+v: %v", test, err)
+		} else if !test.Valid && !errors.Is(err, ValidationIssueUnexpectedValue) {
+			t.Errorf("Validate should have rejected %+v, returned %v", test, err)
+		}
+	}
+}
+
+func TestUserIsResolvedToCredential(t *testing.T) {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Skipf("could not get current user: %v", err)
+	}
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:  strToPointer("cmd"),
+				User: strToPointer(currentUser.Username),
+			},
+		},
+	}
+
+	config, err := programs.Validate()
+	if err != nil {
+		t.Fatalf("Validation error on valid user: %v", err)
+	}
+
+	runAs := config["taskmaster"].runAs
+	if runAs == nil {
+		t.Fatalf("User has not been resolved")
+	}
+	if uid := strconv.Itoa(int(runAs.Credential.Uid)); uid != currentUser.Uid {
+		t.Errorf(
+			"User resolved to incorrect uid: %v; expected %v",
+			uid,
+			currentUser.Uid,
+		)
+	}
+	if runAs.HomeDir != currentUser.HomeDir {
+		t.Errorf(
+			"User resolved to incorrect home directory: %v; expected %v",
+			runAs.HomeDir,
+			currentUser.HomeDir,
+		)
+	}
+}
+
+func TestUserFailsOnUnknownUser(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:  strToPointer("cmd"),
+				User: strToPointer("taskmaster-unknown-user"),
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].User" && validationError.Issue == ValidationIssueUnknownUser) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].User",
+				ValidationIssueUnknownUser,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestGroupFailsOnUnknownGroup(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:   strToPointer("cmd"),
+				Group: strToPointer("taskmaster-unknown-group"),
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].Group" && validationError.Issue == ValidationIssueUnknownGroup) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Group",
+				ValidationIssueUnknownGroup,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestUserFailsWithoutPrivileges(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("running as root, privileges can not be lacking")
+	}
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:  strToPointer("cmd"),
+				User: strToPointer("0"),
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].User" && validationError.Issue == ValidationIssueInsufficientPrivileges) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].User",
+				ValidationIssueInsufficientPrivileges,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestNiceIsNotOutsideBounds(t *testing.T) {
+	for _, nice := range []int{NiceMin - 1, NiceMax + 1} {
+		programs := ProgramsYaml{
+			Programs: map[string]ProgramYaml{
+				"taskmaster": {
+					Cmd:  strToPointer("cmd"),
+					Nice: intToPointer(nice),
+				},
+			},
+		}
+
+		_, err := programs.Validate()
+		if err == nil {
+			t.Errorf("Validate should have returned an error for nice %d", nice)
+			return
+		}
+
+		var validationError *ErrProgramsYamlValidation
+		if errors.As(err, &validationError) {
+			if validationError.Field == "Programs[taskmaster].Nice" && validationError.Issue == ValidationIssueValueOutsideBounds {
+				continue
+			}
+
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Nice",
+				ValidationIssueValueOutsideBounds,
+			)
+			return
+		}
+
+		t.Errorf("Returned invalid error")
+		return
+	}
+}
+
+func TestOomscoreadjIsNotOutsideBounds(t *testing.T) {
+	for _, oomScoreAdj := range []int{OomScoreAdjMin - 1, OomScoreAdjMax + 1} {
+		programs := ProgramsYaml{
+			Programs: map[string]ProgramYaml{
+				"taskmaster": {
+					Cmd:         strToPointer("cmd"),
+					Oomscoreadj: intToPointer(oomScoreAdj),
+				},
+			},
+		}
+
+		_, err := programs.Validate()
+		if err == nil {
+			t.Errorf("Validate should have returned an error for oomscoreadj %d", oomScoreAdj)
+			return
+		}
+
+		var validationError *ErrProgramsYamlValidation
+		if errors.As(err, &validationError) {
+			if validationError.Field == "Programs[taskmaster].Oomscoreadj" && validationError.Issue == ValidationIssueValueOutsideBounds {
+				continue
+			}
+
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Oomscoreadj",
+				ValidationIssueValueOutsideBounds,
+			)
+			return
+		}
+
+		t.Errorf("Returned invalid error")
+		return
+	}
+}
+
+func TestRlimitsFailsOnNegativeValue(t *testing.T) {
+	invalidValue := int64(-2)
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd: strToPointer("cmd"),
+				Rlimits: &ProgramRlimitsYaml{
+					Nofile: &invalidValue,
+				},
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].Rlimits.Nofile" && validationError.Issue == ValidationIssueValueOutsideBounds) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Rlimits.Nofile",
+				ValidationIssueValueOutsideBounds,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestRlimitsAcceptsUnlimited(t *testing.T) {
+	unlimited := int64(RlimitUnlimited)
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd: strToPointer("cmd"),
+				Rlimits: &ProgramRlimitsYaml{
+					Core: &unlimited,
+				},
+			},
+		},
+	}
+
+	config, err := programs.Validate()
+	if err != nil {
+		t.Fatalf("Validation error on valid configuration: %v", err)
+	}
+
+	rlimits := config["taskmaster"].Rlimits.toChildRlimits()
+	if len(rlimits) != 1 || rlimits[0].Value != ^uint64(0) {
+		t.Errorf("Unlimited core limit not converted to infinity: %v", rlimits)
+	}
+}
+
+func TestProcessgroupIsValidValue(t *testing.T) {
+	invalidProcessgroup := ProcessGroupType("family")
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:          strToPointer("cmd"),
+				Processgroup: &invalidProcessgroup,
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].Processgroup" && validationError.Issue == ValidationIssueUnexpectedValue) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Processgroup",
+				ValidationIssueUnexpectedValue,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestStopsequenceSetToDefaultValue(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:        strToPointer("cmd"),
+				Stopsignal: stopSignalToPointer(StopSignalQuit),
+				Stoptime:   intToPointer(7),
+			},
+		},
+	}
+
+	config, err := programs.Validate()
+	if err != nil {
+		t.Fatalf("Validation error on valid configuration: %v", err)
+	}
+
+	expected := []StopStep{
+		{
+			Signal: StopSignalQuit,
+			Wait:   7,
+		},
+	}
+	if stopsequence := config["taskmaster"].Stopsequence; !reflect.DeepEqual(stopsequence, expected) {
+		t.Errorf(
+			"Stopsequence not set to correct default value: %v; expected %v",
+			stopsequence,
+			expected,
+		)
+	}
+}
+
+func TestStopStepsFallBackToStopsignal(t *testing.T) {
+	config := ProgramConfiguration{
+		Stopsignal: StopSignalInt,
+		Stoptime:   3,
+	}
+
+	expected := []StopStep{
+		{
+			Signal: StopSignalInt,
+			Wait:   3,
+		},
+	}
+	if steps := config.StopSteps(); !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Stop steps of an empty sequence are %v; expected %v", steps, expected)
+	}
+}
+
+func TestStopsequenceIsValidValue(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:      strToPointer("cmd"),
+				Stoptime: intToPointer(3),
+				Stopsequence: []StopStepYaml{
+					{
+						Signal: stopSignalToPointer(StopSignalTerm),
+						Wait:   intToPointer(10),
+					},
+					{
+						Signal: stopSignalToPointer(StopSignalKill),
+					},
+				},
+			},
+		},
+	}
+
+	config, err := programs.Validate()
+	if err != nil {
+		t.Fatalf("Validation error on valid configuration: %v", err)
+	}
+
+	expected := []StopStep{
+		{
+			Signal: StopSignalTerm,
+			Wait:   10,
+		},
+		{
+			Signal: StopSignalKill,
+			Wait:   3,
+		},
+	}
+	if stopsequence := config["taskmaster"].Stopsequence; !reflect.DeepEqual(stopsequence, expected) {
+		t.Errorf(
+			"Stopsequence has not been provided, received: %v; expected %v",
+			stopsequence,
+			expected,
+		)
+	}
+}
+
+func TestStopsequenceFailsOnInvalidSignal(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd: strToPointer("cmd"),
+				Stopsequence: []StopStepYaml{
+					{
+						Signal: stopSignalToPointer(StopSignalTerm),
+					},
+					{
+						Signal: stopSignalToPointer("SEGV"),
+					},
+				},
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].Stopsequence[1].Signal" && validationError.Issue == ValidationIssueUnexpectedValue) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Stopsequence[1].Signal",
+				ValidationIssueUnexpectedValue,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestRestartstrategySetToDefaultValue(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd: strToPointer("cmd"),
+			},
+		},
+	}
+
+	config, err := programs.Validate()
+	if err != nil {
+		t.Fatalf("Validation error on valid configuration: %v", err)
+	}
+
+	if strategy := config["taskmaster"].Restartstrategy; strategy != RestartStrategyAll {
+		t.Errorf("Restartstrategy not set to correct default value: %s; expected %s", strategy, RestartStrategyAll)
+	}
+	if batchSize := config["taskmaster"].Restartbatchsize; batchSize != 1 {
+		t.Errorf("Restartbatchsize not set to correct default value: %d; expected %d", batchSize, 1)
+	}
+}
+
+func TestRestartstrategyIsValidValue(t *testing.T) {
+	invalidRestartstrategy := RestartStrategy("random")
+
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:             strToPointer("cmd"),
+				Restartstrategy: &invalidRestartstrategy,
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].Restartstrategy" && validationError.Issue == ValidationIssueUnexpectedValue) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Restartstrategy",
+				ValidationIssueUnexpectedValue,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
+func TestRestartbatchsizeIsInBounds(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"taskmaster": {
+				Cmd:              strToPointer("cmd"),
+				Restartbatchsize: intToPointer(0),
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned an error")
+		return
+	}
+
+	var validationError *ErrProgramsYamlValidation
+	if errors.As(err, &validationError) {
+		if !(validationError.Field == "Programs[taskmaster].Restartbatchsize" && validationError.Issue == ValidationIssueValueOutsideBounds) {
+			t.Errorf(
+				"Incorrect error: (%s, %s); expected (%s, %s)",
+				validationError.Field,
+				validationError.Issue,
+				"Programs[taskmaster].Restartbatchsize",
+				ValidationIssueValueOutsideBounds,
+			)
+			return
+		}
+		return
+	}
+
+	t.Errorf("Returned invalid error")
+}
+
 func TestParsesValidFullConfiguration(t *testing.T) {
 	exitcodes := []interface{}{0}
 
@@ -1141,9 +1787,9 @@ func TestParsesValidFullConfiguration(t *testing.T) {
 				Stoptime:     intToPointer(10),
 				Stdout:       strToPointer("/dev/stdout"),
 				Stderr:       strToPointer("/dev/stderr"),
-				Env: map[string]string{
+				Env: EnvYamlFromValues(map[string]string{
 					"TERM": "DUMB",
-				},
+				}),
 			},
 		},
 	}
@@ -1153,3 +1799,45 @@ func TestParsesValidFullConfiguration(t *testing.T) {
 		t.Errorf("Validation error on valid configuration: %v", err)
 	}
 }
+
+func TestValidateReportsEveryIssue(t *testing.T) {
+	programs := ProgramsYaml{
+		Programs: map[string]ProgramYaml{
+			"web": {
+				Cmd:       strToPointer("web"),
+				Numprocs:  intToPointer(0),
+				Starttime: intToPointer(-1),
+			},
+			"batch": {
+				Cmd: nil,
+			},
+		},
+	}
+
+	_, err := programs.Validate()
+
+	var validationErrors *ErrProgramsYamlValidations
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("Validate returned %v; expected every validation error", err)
+	}
+
+	expectedFields := []string{
+		"Programs[batch].Cmd",
+		"Programs[web].Numprocs",
+		"Programs[web].Starttime",
+	}
+
+	fields := make([]string, 0, len(validationErrors.Errors))
+	for _, validationError := range validationErrors.Errors {
+		fields = append(fields, validationError.Field)
+	}
+	if !reflect.DeepEqual(fields, expectedFields) {
+		t.Errorf("Validation errors are for %v; expected %v", fields, expectedFields)
+	}
+
+	// The first error is still found on its own.
+	var validationError *ErrProgramsYamlValidation
+	if !errors.As(err, &validationError) || validationError.Field != expectedFields[0] {
+		t.Errorf("Returned invalid first error: %v", validationError)
+	}
+}
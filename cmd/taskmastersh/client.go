@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Client talks to the HTTP REST API of taskmasterd.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Unredacted asks for sensitive values in clear, which the daemon only
+	// accepts through its unix socket.
+	Unredacted bool
+}
+
+type JSONResponse struct {
+	Error  string          `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+type ProgramNameInputJSON struct {
+	ProgramID string `json:"program_id"`
+}
+
+func NewClient(host string, port int) *Client {
+	return &Client{
+		BaseURL: fmt.Sprintf("http://%s:%d", host, port),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// NewSocketClient talks to the daemon through its unix socket.
+func NewSocketClient(path string) *Client {
+	dialer := net.Dialer{}
+
+	return &Client{
+		BaseURL: "http://taskmasterd",
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Do sends input encoded as JSON to the endpoint and decodes the result of
+// the response into result, if not nil.
+func (client *Client) Do(method, endpoint string, input interface{}, result interface{}) error {
+	var body bytes.Buffer
+	if input != nil {
+		if err := json.NewEncoder(&body).Encode(input); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, client.BaseURL+endpoint, &body)
+	if err != nil {
+		return err
+	}
+	if client.Unredacted {
+		request.URL.RawQuery = "unredacted=true"
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		// Refused requests tell why.
+		var jsonResponse JSONResponse
+		if err := json.NewDecoder(response.Body).Decode(&jsonResponse); err == nil && jsonResponse.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, endpoint, jsonResponse.Error)
+		}
+		return fmt.Errorf("%s %s: unexpected status: %s", method, endpoint, response.Status)
+	}
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	// Some endpoints, like shutdown, do not respond with any content.
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+
+	var jsonResponse JSONResponse
+	if err := json.Unmarshal(content, &jsonResponse); err != nil {
+		return err
+	}
+	if jsonResponse.Error != "" {
+		return errors.New(jsonResponse.Error)
+	}
+
+	if result == nil || len(jsonResponse.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(jsonResponse.Result, result)
+}
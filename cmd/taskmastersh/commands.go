@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrUsage = errors.New("invalid arguments")
+
+type Command struct {
+	Usage       string
+	Description string
+	Run         func(client *Client, args []string) error
+}
+
+var commands = map[string]Command{
+	"status": {
+		Usage:       "status",
+		Description: "Show the state of every program and process",
+		Run:         commandStatus,
+	},
+	"start": {
+		Usage:       "start <program>...|all",
+		Description: "Start programs",
+		Run:         programsCommand("/start"),
+	},
+	"stop": {
+		Usage:       "stop <program>...|all",
+		Description: "Stop programs",
+		Run:         programsCommand("/stop"),
+	},
+	"restart": {
+		Usage:       "restart <program>...|all",
+		Description: "Restart programs",
+		Run:         programsCommand("/restart"),
+	},
+	"pause": {
+		Usage:       "pause <program>...|all",
+		Description: "Pause running programs with SIGSTOP",
+		Run:         programsCommand("/pause"),
+	},
+	"resume": {
+		Usage:       "resume <program>...|all",
+		Description: "Resume paused programs with SIGCONT",
+		Run:         programsCommand("/resume"),
+	},
+	"clear-override": {
+		Usage:       "clear-override <program>...|all",
+		Description: "Forget manual starts and stops, autostart applies again",
+		Run:         programsCommand("/override/clear"),
+	},
+	"plan": {
+		Usage:       "plan [configuration file]",
+		Description: "Show what a reload of the configuration would do, without applying it",
+		Run:         commandPlan,
+	},
+	"check": {
+		Usage:       "check [configuration file]",
+		Description: "List every issue of the configuration file, without applying it",
+		Run:         commandCheck,
+	},
+	"schema": {
+		Usage:       "schema",
+		Description: "Print the JSON Schema of the configuration file",
+		Run:         commandSchema,
+	},
+	"versions": {
+		Usage:       "versions",
+		Description: "List the previous versions of the configuration file",
+		Run:         commandVersions,
+	},
+	"diff": {
+		Usage:       "diff <version> [version]",
+		Description: "Show the differences between two versions of the configuration file, the current one by default",
+		Run:         commandDiff,
+	},
+	"rollback": {
+		Usage:       "rollback <version>",
+		Description: "Reload a previous version of the configuration file",
+		Run:         commandRollback,
+	},
+	"version": {
+		Usage:       "version",
+		Description: "Show taskmasterd version",
+		Run:         commandVersion,
+	},
+	"upgrade": {
+		Usage:       "upgrade",
+		Description: "Replace taskmasterd with the binary found on disk, without stopping programs",
+		Run:         commandUpgrade,
+	},
+	"shutdown": {
+		Usage:       "shutdown",
+		Description: "Stop every program and taskmasterd",
+		Run:         commandShutdown,
+	},
+}
+
+func printCommandsHelp(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].Usage, commands[name].Description)
+	}
+	fmt.Fprintf(tw, "  %s\t%s\n", "help", "Show this help")
+	tw.Flush()
+}
+
+func runCommand(client *Client, words []string) error {
+	name, args := words[0], words[1:]
+
+	if name == "help" {
+		printCommandsHelp(os.Stdout)
+		return nil
+	}
+
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command: %s (type help to list commands)", name)
+	}
+
+	err := command.Run(client, args)
+	if errors.Is(err, ErrUsage) {
+		return fmt.Errorf("usage: %s", command.Usage)
+	}
+	return err
+}
+
+// programsCommand creates a command acting on the programs given as arguments,
+// or on every program with "all".
+func programsCommand(endpoint string) func(client *Client, args []string) error {
+	return func(client *Client, args []string) error {
+		if len(args) == 0 {
+			return ErrUsage
+		}
+
+		if len(args) == 1 && args[0] == "all" {
+			return client.Do("POST", endpoint+"/all", nil, nil)
+		}
+
+		for _, programID := range args {
+			err := client.Do("POST", endpoint, ProgramNameInputJSON{
+				ProgramID: programID,
+			}, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %w", programID, err)
+			}
+		}
+		return nil
+	}
+}
+
+type StatusPrograms struct {
+	Programs []StatusProgram `json:"programs"`
+}
+
+type StatusProgram struct {
+	Id        string          `json:"id"`
+	State     string          `json:"state"`
+	Processes []StatusProcess `json:"processes"`
+	Override  *StatusOverride `json:"override"`
+}
+
+type StatusOverride struct {
+	Intent string    `json:"intent"`
+	Since  time.Time `json:"since"`
+}
+
+type StatusProcess struct {
+	ID        string    `json:"id"`
+	Pid       int       `json:"pid"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func commandStatus(client *Client, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+
+	var status StatusPrograms
+	if err := client.Do("GET", "/status", nil, &status); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROGRAM\tPROCESS\tSTATE\tPID\tUPTIME\tOVERRIDE")
+	for _, program := range status.Programs {
+		override := ""
+		if program.Override != nil {
+			override = "manually " + strings.ToLower(program.Override.Intent)
+		}
+		fmt.Fprintf(tw, "%s\t\t%s\t\t\t%s\n", program.Id, program.State, override)
+
+		for _, process := range program.Processes {
+			pid, uptime := "-", "-"
+			if process.Pid != 0 {
+				pid = fmt.Sprint(process.Pid)
+				uptime = time.Since(process.StartedAt).Truncate(time.Second).String()
+			}
+			fmt.Fprintf(tw, "\t%s\t%s\t%s\t%s\t\n", process.ID, process.State, pid, uptime)
+		}
+	}
+	return tw.Flush()
+}
+
+func commandVersion(client *Client, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+
+	var version string
+	if err := client.Do("GET", "/version", nil, &version); err != nil {
+		return err
+	}
+
+	fmt.Println(version)
+	return nil
+}
+
+func commandShutdown(client *Client, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+
+	return client.Do("DELETE", "/shutdown", nil, nil)
+}
+
+func commandUpgrade(client *Client, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+
+	return client.Do("POST", "/upgrade", nil, nil)
+}
+
+type ConfigurationPlan struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Scaled  []struct {
+		Program string `json:"program"`
+		From    int    `json:"from"`
+		To      int    `json:"to"`
+		Delta   int    `json:"delta"`
+	} `json:"scaled"`
+	Restarted []struct {
+		Program   string   `json:"program"`
+		Fields    []string `json:"fields"`
+		Processes []string `json:"processes"`
+	} `json:"restarted"`
+}
+
+type ConfigurationInput struct {
+	Data   string `json:"data"`
+	Format string `json:"format,omitempty"`
+}
+
+// configurationFormat guesses the format of a local configuration file from its
+// extension, letting the daemon assume its own format otherwise.
+func configurationFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return ""
+	}
+}
+
+// commandPlan plans a reload of the configuration file of the daemon,
+// or the replacement of the configuration by a local file.
+func commandPlan(client *Client, args []string) error {
+	var plan ConfigurationPlan
+
+	switch len(args) {
+	case 0:
+		if err := client.Do("GET", "/configuration/plan", nil, &plan); err != nil {
+			return err
+		}
+	case 1:
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := client.Do("POST", "/configuration/plan", ConfigurationInput{
+			Data:   string(data),
+			Format: configurationFormat(args[0]),
+		}, &plan); err != nil {
+			return err
+		}
+	default:
+		return ErrUsage
+	}
+
+	if len(plan.Added)+len(plan.Removed)+len(plan.Scaled)+len(plan.Restarted) == 0 {
+		fmt.Println("No program would be added, removed, scaled or restarted.")
+		return nil
+	}
+
+	if len(plan.Added) > 0 {
+		fmt.Printf("Added: %s\n", strings.Join(plan.Added, ", "))
+	}
+	if len(plan.Removed) > 0 {
+		fmt.Printf("Removed: %s\n", strings.Join(plan.Removed, ", "))
+	}
+	if len(plan.Scaled) > 0 {
+		fmt.Println("Scaled:")
+		for _, scale := range plan.Scaled {
+			fmt.Printf("  %s: %d -> %d (%+d)\n", scale.Program, scale.From, scale.To, scale.Delta)
+		}
+	}
+	if len(plan.Restarted) > 0 {
+		fmt.Println("Restarted:")
+		for _, restart := range plan.Restarted {
+			fmt.Printf("  %s (%s) because of: %s\n", restart.Program, strings.Join(restart.Processes, ", "), strings.Join(restart.Fields, ", "))
+		}
+	}
+
+	return nil
+}
+
+type ConfigurationCheck struct {
+	Valid  bool `json:"valid"`
+	Issues []struct {
+		Field  string `json:"field"`
+		Issue  string `json:"issue"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	} `json:"issues"`
+}
+
+// commandCheck validates the configuration file of the daemon, or a local file.
+func commandCheck(client *Client, args []string) error {
+	var check ConfigurationCheck
+
+	switch len(args) {
+	case 0:
+		if err := client.Do("GET", "/configuration/check", nil, &check); err != nil {
+			return err
+		}
+	case 1:
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := client.Do("POST", "/configuration/check", ConfigurationInput{
+			Data:   string(data),
+			Format: configurationFormat(args[0]),
+		}, &check); err != nil {
+			return err
+		}
+	default:
+		return ErrUsage
+	}
+
+	if check.Valid {
+		fmt.Println("Configuration is valid.")
+		return nil
+	}
+
+	for _, issue := range check.Issues {
+		location := "-"
+		if issue.Line > 0 {
+			location = strconv.Itoa(issue.Line)
+			if issue.Column > 0 {
+				location += ":" + strconv.Itoa(issue.Column)
+			}
+		}
+
+		if issue.Field == "" {
+			fmt.Printf("%s: %s\n", location, issue.Issue)
+		} else {
+			fmt.Printf("%s: %s: %s\n", location, issue.Field, issue.Issue)
+		}
+	}
+
+	return fmt.Errorf("configuration has %d issue(s)", len(check.Issues))
+}
+
+func commandSchema(client *Client, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+
+	var schema json.RawMessage
+	if err := client.Do("GET", "/configuration/schema", nil, &schema); err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, schema, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+
+	_, err := indented.WriteTo(os.Stdout)
+	return err
+}
+
+type ConfigurationVersions struct {
+	Versions []struct {
+		Version int       `json:"version"`
+		Time    time.Time `json:"time"`
+		Size    int64     `json:"size"`
+	} `json:"versions"`
+}
+
+func commandVersions(client *Client, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+
+	var versions ConfigurationVersions
+	if err := client.Do("GET", "/configuration/versions", nil, &versions); err != nil {
+		return err
+	}
+
+	if len(versions.Versions) == 0 {
+		fmt.Println("No previous version of the configuration file.")
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tSAVED AT\tSIZE")
+	for _, version := range versions.Versions {
+		fmt.Fprintf(writer, "%d\t%s\t%d\n", version.Version, version.Time.Format(time.RFC3339), version.Size)
+	}
+
+	return writer.Flush()
+}
+
+type ConfigurationDiffInput struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// commandDiff compares two versions of the configuration file, 0 being the current one.
+func commandDiff(client *Client, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return ErrUsage
+	}
+
+	versions := make([]int, 2)
+	for index, arg := range args {
+		version, err := strconv.Atoi(arg)
+		if err != nil {
+			return ErrUsage
+		}
+		versions[index] = version
+	}
+
+	var diff ConfigurationInput
+	if err := client.Do("POST", "/configuration/diff", ConfigurationDiffInput{
+		From: versions[0],
+		To:   versions[1],
+	}, &diff); err != nil {
+		return err
+	}
+
+	if len(diff.Data) == 0 {
+		fmt.Println("No differences.")
+		return nil
+	}
+
+	fmt.Print(diff.Data)
+	return nil
+}
+
+type ConfigurationRollbackInput struct {
+	Version int `json:"version"`
+}
+
+func commandRollback(client *Client, args []string) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		return ErrUsage
+	}
+
+	return client.Do("POST", "/configuration/rollback", ConfigurationRollbackInput{
+		Version: version,
+	}, nil)
+}
@@ -1,9 +1,80 @@
 package main
 
 import (
-	"log"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 )
 
+type Args struct {
+	HostArg       string
+	PortArg       int
+	SocketPathArg string
+	UnredactedArg bool
+}
+
+func (args *Args) Parse() {
+	flag.StringVar(&args.HostArg, "H", "localhost", "HTTP API Host")
+	flag.IntVar(&args.PortArg, "p", 8080, "HTTP API Port")
+	flag.StringVar(&args.SocketPathArg, "S", "", "Unix socket path of the HTTP API, used instead of host and port")
+	flag.BoolVar(&args.UnredactedArg, "U", false, "Show sensitive values in clear, which requires the unix socket")
+	flag.Usage = usage
+	flag.Parse()
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [command [arguments...]]\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Without command, an interactive shell is started.")
+	fmt.Fprintln(flag.CommandLine.Output(), "\nOptions:")
+	flag.PrintDefaults()
+	fmt.Fprintln(flag.CommandLine.Output(), "\nCommands:")
+	printCommandsHelp(flag.CommandLine.Output())
+}
+
+func shell(client *Client, in io.Reader) {
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Print("taskmaster> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			return
+		}
+
+		if err := runCommand(client, words); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+}
+
 func main() {
-	log.Println("taskmastersh")
+	var args Args
+	args.Parse()
+
+	client := NewClient(args.HostArg, args.PortArg)
+	if args.SocketPathArg != "" {
+		client = NewSocketClient(args.SocketPathArg)
+	}
+	client.Unredacted = args.UnredactedArg
+
+	if flag.NArg() == 0 {
+		shell(client, os.Stdin)
+		return
+	}
+
+	if err := runCommand(client, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
 }
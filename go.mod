@@ -1,5 +1,9 @@
 module github.com/42Taskmaster/taskmaster
 
-go 1.15
+go 1.16
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/BurntSushi/toml v1.2.0
+	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
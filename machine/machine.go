@@ -136,6 +136,12 @@ func (machine *Machine) Previous() StateType {
 	return machine.previous
 }
 
+// UnsafePrevious returns previous state without taking care of active lock.
+// It is meant to be used by actions, which run while the lock is held.
+func (machine *Machine) UnsafePrevious() StateType {
+	return machine.previous
+}
+
 // Current returns current state.
 func (machine *Machine) Current() StateType {
 	machine.lock.Lock()
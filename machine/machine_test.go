@@ -98,3 +98,83 @@ func TestOnOffMachine(t *testing.T) {
 		)
 	}
 }
+
+func TestActionsCanReadPreviousState(t *testing.T) {
+	const (
+		PausedState  machine.StateType = "paused"
+		RunningState machine.StateType = "running"
+		StoppedState machine.StateType = "stopped"
+
+		PauseEvent machine.EventType = "pause"
+		RunEvent   machine.EventType = "run"
+	)
+
+	var previousStates []machine.StateType
+
+	recordPreviousStateAction := func(stateMachine *machine.Machine, context machine.Context) (machine.EventType, error) {
+		previousStates = append(previousStates, stateMachine.UnsafePrevious())
+
+		return machine.NoopEvent, nil
+	}
+
+	pausableMachine := machine.Machine{
+		Initial: StoppedState,
+
+		StateNodes: machine.StateNodes{
+			StoppedState: machine.StateNode{
+				On: machine.Events{
+					RunEvent: RunningState,
+				},
+			},
+			RunningState: machine.StateNode{
+				Actions: []machine.Action{
+					recordPreviousStateAction,
+				},
+
+				On: machine.Events{
+					PauseEvent: PausedState,
+				},
+			},
+			PausedState: machine.StateNode{
+				On: machine.Events{
+					RunEvent: RunningState,
+				},
+			},
+		},
+	}
+	pausableMachine.Init()
+
+	for _, event := range []machine.EventType{RunEvent, PauseEvent, RunEvent} {
+		if _, err := pausableMachine.Send(event); err != nil {
+			t.Fatalf(
+				"transition returned an unexpected error %v",
+				err,
+			)
+		}
+	}
+
+	expectedPreviousStates := []machine.StateType{StoppedState, PausedState}
+	if len(previousStates) != len(expectedPreviousStates) {
+		t.Fatalf(
+			"action has been called an incorrect number of times %v; expected %v",
+			len(previousStates),
+			len(expectedPreviousStates),
+		)
+	}
+	for index, previousState := range previousStates {
+		if previousState != expectedPreviousStates[index] {
+			t.Fatalf(
+				"action read incorrect previous state %v; expected %v",
+				previousState,
+				expectedPreviousStates[index],
+			)
+		}
+	}
+	if previous := pausableMachine.Previous(); previous != PausedState {
+		t.Fatalf(
+			"machine has incorrect previous state %v; expected %v",
+			previous,
+			PausedState,
+		)
+	}
+}
@@ -21,7 +21,7 @@ tearDown() {
 
 testInfinite() {
     cd infinite
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -34,7 +34,7 @@ testInfinite() {
 
 testHotReloadTotalNewConfig() {
     cd hot-reload-total-new-config
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -47,7 +47,7 @@ testHotReloadTotalNewConfig() {
 
 testHotReloadUpdateProgramConfig() {
     cd hot-reload-update-program-config
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -60,7 +60,7 @@ testHotReloadUpdateProgramConfig() {
 
 testNotFoundCommand() {
     cd not-found-command
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -74,7 +74,7 @@ testNotFoundCommand() {
 
 testCreate() {
     cd create-program
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -87,7 +87,7 @@ testCreate() {
 
 testEdit() {
     cd edit-program
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -100,7 +100,7 @@ testEdit() {
 
 testDelete() {
     cd delete-program
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -113,7 +113,7 @@ testDelete() {
 
 testVersion() {
     cd version
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -126,7 +126,7 @@ testVersion() {
 
 testAutomaticallyRestartOnBackoffState() {
     cd automatically-restart-on-backoff-state
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 
@@ -139,7 +139,7 @@ testAutomaticallyRestartOnBackoffState() {
 
 testStartStopRestartAll() {
     cd start-stop-restart-all
-    rm -f taskmasterd.log
+    rm -f taskmasterd.log taskmasterd.state
 
     ./test.sh
 